@@ -0,0 +1,52 @@
+CREATE TABLE users (
+    user_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    username VARCHAR(50) NOT NULL,
+    display_name TEXT,
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_username ON users(username);
+
+CREATE TABLE posts (
+    post_id SERIAL PRIMARY KEY,
+    author_id UUID NOT NULL REFERENCES users(user_id),
+    title VARCHAR(200) NOT NULL,
+    body TEXT,
+    tags TEXT[],
+    published BOOLEAN DEFAULT FALSE,
+    published_at TIMESTAMP
+);
+
+CREATE TABLE comments (
+    comment_id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(post_id),
+    author_id UUID REFERENCES users(user_id),
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_comments_post ON comments(post_id);
+
+CREATE VIEW published_posts AS
+SELECT p.post_id, p.title, u.username, p.published_at
+FROM posts p
+JOIN users u ON p.author_id = u.user_id
+WHERE p.published = TRUE;
+
+INSERT INTO users (username, display_name)
+VALUES ($1, $2)
+RETURNING user_id;
+
+INSERT INTO posts (author_id, title, body, published)
+VALUES ($1, $2, $3, $4)
+RETURNING post_id;
+
+INSERT INTO comments (post_id, author_id, content)
+VALUES ($1, $2, $3);
+
+SELECT p.title, COUNT(c.comment_id) AS comments
+FROM posts p
+LEFT JOIN comments c ON c.post_id = p.post_id
+WHERE p.published_at > NOW() - INTERVAL '30 days'
+GROUP BY p.title
+ORDER BY comments DESC;
@@ -0,0 +1,64 @@
+CREATE TABLE customers (
+    customer_id SERIAL PRIMARY KEY,
+    email VARCHAR(150) NOT NULL UNIQUE,
+    full_name VARCHAR(100) NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE products (
+    product_id SERIAL PRIMARY KEY,
+    sku VARCHAR(32) NOT NULL,
+    name VARCHAR(200) NOT NULL,
+    price NUMERIC(10, 2) NOT NULL CHECK (price >= 0),
+    stock INTEGER DEFAULT 0,
+    attributes JSONB
+);
+
+CREATE UNIQUE INDEX idx_product_sku ON products(sku);
+
+CREATE TABLE orders (
+    order_id BIGSERIAL PRIMARY KEY,
+    customer_id INTEGER NOT NULL REFERENCES customers(customer_id),
+    status VARCHAR(20) DEFAULT 'PENDING',
+    ordered_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_order_status CHECK (status IN ('PENDING', 'PAID', 'SHIPPED', 'CANCELLED'))
+);
+
+CREATE TABLE order_items (
+    order_id BIGINT REFERENCES orders(order_id) ON DELETE CASCADE,
+    product_id INTEGER REFERENCES products(product_id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price NUMERIC(10, 2) NOT NULL,
+    PRIMARY KEY (order_id, product_id)
+);
+
+CREATE INDEX idx_orders_customer ON orders(customer_id, ordered_at);
+
+CREATE VIEW order_totals AS
+SELECT o.order_id, c.email, SUM(oi.quantity * oi.unit_price) AS total
+FROM orders o
+JOIN customers c ON o.customer_id = c.customer_id
+JOIN order_items oi ON oi.order_id = o.order_id
+GROUP BY o.order_id, c.email;
+
+INSERT INTO customers (email, full_name)
+VALUES ($1, $2)
+RETURNING customer_id;
+
+INSERT INTO products (sku, name, price, stock)
+VALUES ($1, $2, $3, $4)
+RETURNING product_id;
+
+INSERT INTO orders (customer_id, status)
+VALUES ($1, $2)
+RETURNING order_id;
+
+INSERT INTO order_items (order_id, product_id, quantity, unit_price)
+VALUES ($1, $2, $3, $4);
+
+SELECT c.full_name, COUNT(o.order_id) AS orders
+FROM customers c
+LEFT JOIN orders o ON o.customer_id = c.customer_id
+WHERE c.email ILIKE '%@example.com'
+GROUP BY c.full_name;
@@ -14,33 +14,29 @@ import (
 )
 
 type SpannerDBTeardown struct {
-	db        *sql.DB
-	repo      repo.Database
-	terminate func()
+	db      *sql.DB
+	repo    repo.Database
+	release func()
 }
 
 func main() {
-	os.Exit(TestGeneratedSQLFiles())
+	code := TestGeneratedSQLFiles()
+	tools.DefaultEmulatorPool().Close()
+	os.Exit(code)
 }
 
 func setupSpannerDB() *SpannerDBTeardown {
-	db, terminate, err := tools.GetDBWithIdentifier(true, "folder-eval")
+	// Every file gets its own database on the shared emulator
+	db, release, err := tools.DefaultEmulatorPool().AcquireDB()
 	if err != nil {
 		panic(fmt.Sprintf("Failed to connect to DB: %v", err))
 	}
-	r := repo.NewSpannerRepo(db)
-	if err := r.CleanupDB(); err != nil {
-		panic(fmt.Sprintf("Failed to cleanup DB: %v", err))
-	}
-	return &SpannerDBTeardown{db: db, repo: r, terminate: terminate}
+	return &SpannerDBTeardown{db: db, repo: repo.NewSpannerRepo(db), release: release}
 }
 
+// Close drops the database, which also removes everything the file created
 func (d *SpannerDBTeardown) Close() {
-	if err := d.repo.CleanupDB(); err != nil {
-		panic(fmt.Sprintf("Failed to cleanup DB: %v", err))
-	}
-	d.db.Close()
-	d.terminate()
+	d.release()
 }
 
 // TestGeneratedSQLFiles tests all SQL files in the generated_sql folder
@@ -73,11 +69,14 @@ func TestGeneratedSQLFiles() int {
 		return 1
 	}
 
+	// The generated files are translations of the PostgreSQL source in prompt.txt
+	source := readPromptSource([]string{"prompt.txt", "../../prompt.txt"})
+
 	// Collect results for markdown report
 	var results []models.TestFileResult
 
 	for _, sqlFile := range sqlFiles {
-		result := testSQLFileWithParsing(sqlFile)
+		result := testSQLFileWithParsing(sqlFile, source)
 		results = append(results, result)
 	}
 
@@ -114,7 +113,18 @@ func TestGeneratedSQLFiles() int {
 	return 0
 }
 
-func testSQLFileWithParsing(sqlFile string) models.TestFileResult {
+// readPromptSource returns the source SQL of the first prompt file found, empty when there is none
+func readPromptSource(paths []string) string {
+	for _, path := range paths {
+		if prompt, err := os.ReadFile(path); err == nil {
+			_, source := tools.SplitPrompt(string(prompt))
+			return source
+		}
+	}
+	return ""
+}
+
+func testSQLFileWithParsing(sqlFile string, source string) models.TestFileResult {
 	start := time.Now()
 	filename := filepath.Base(sqlFile)
 
@@ -234,6 +244,15 @@ func testSQLFileWithParsing(sqlFile string) models.TestFileResult {
 		fmt.Printf("No valid statements to execute for %s", filename)
 	}
 
+	// Step 4: Compare the created schema with the schema of the source
+	if source != "" {
+		if content, err := os.ReadFile(sqlFile); err == nil {
+			result.SchemaFidelity = tools.CompareSchemaFidelity(source, string(content))
+			fmt.Printf("  Schema fidelity: %.1f%% (%d dropped, %d altered of %d objects)",
+				result.SchemaFidelity.Score*100, result.SchemaFidelity.Dropped, result.SchemaFidelity.Altered, result.SchemaFidelity.Total)
+		}
+	}
+
 	result.ExecutionTime = time.Since(start)
 
 	// Calculate error rate based on total statements
@@ -488,6 +507,8 @@ func generateMarkdownReport(results []models.TestFileResult) error {
 		)
 	}
 
+	writeSchemaFidelity(file, results)
+
 	// Write error details with error codes
 	fmt.Fprintf(file, "\n## Error Details\n\n")
 	for _, result := range results {
@@ -681,3 +702,40 @@ func testDataIntegrity(dbT *SpannerDBTeardown) {
 		}
 	}
 }
+
+// writeSchemaFidelity writes the schema fidelity of every file and the source objects it dropped or altered
+func writeSchemaFidelity(file *os.File, results []models.TestFileResult) {
+	var compared []models.TestFileResult
+	for _, result := range results {
+		if result.SchemaFidelity != nil {
+			compared = append(compared, result)
+		}
+	}
+	if len(compared) == 0 {
+		return
+	}
+
+	fmt.Fprintf(file, "\n## Schema Fidelity\n\n")
+	fmt.Fprintf(file, "Source schema objects (tables, columns, NOT NULL, UNIQUE, CHECK, foreign keys, key generation) kept by each translation. Altered objects count half.\n\n")
+	fmt.Fprintf(file, "| File | Score | Preserved | Altered | Dropped | Total |\n")
+	fmt.Fprintf(file, "|------|-------|-----------|---------|---------|-------|\n")
+	for _, result := range compared {
+		fidelity := result.SchemaFidelity
+		fmt.Fprintf(file, "| %s | %.1f%% | %d | %d | %d | %d |\n",
+			result.Filename, fidelity.Score*100, fidelity.Preserved, fidelity.Altered, fidelity.Dropped, fidelity.Total)
+	}
+
+	for _, result := range compared {
+		if len(result.SchemaFidelity.Changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(file, "\n### %s\n\n", result.Filename)
+		for _, change := range result.SchemaFidelity.Changes {
+			fmt.Fprintf(file, "- %s %s `%s`", change.Status, change.Kind, change.Object)
+			if change.Detail != "" {
+				fmt.Fprintf(file, ": %s", change.Detail)
+			}
+			fmt.Fprintf(file, "\n")
+		}
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	integration "sql-parser/openai_integration"
+	"sql-parser/tools"
 )
 
 func main() {
@@ -16,15 +18,51 @@ func main() {
 
 func runMultiple() int {
 	var (
-		mode               = flag.String("mode", "iterative", "Mode: 'single' or 'iterative'")
+		mode               = flag.String("mode", "iterative", "Mode: 'single', 'iterative' or 'agent'")
 		maxIterations      = flag.Int("iterations", 1, "Maximum iterations for iterative mode")
-		numConcurrent      = flag.Int("concurrent", 3, "Number of concurrent pipeline instances to run")
+		numConcurrent      = flag.Int("concurrent", 3, "Number of workers running pipeline instances at the same time")
+		numInstances       = flag.Int("instances", 0, "Total number of pipeline instances to run (default: the value of --concurrent)")
+		rpm                = flag.Int("rpm", 0, "Maximum API requests per minute shared by all workers (0 disables)")
+		tpm                = flag.Int("tpm", 0, "Maximum API tokens per minute shared by all workers (0 disables)")
+		spendCap           = flag.Float64("spend-cap", 0, "Stop starting API requests once the estimated spend reaches this many USD (0 disables)")
 		saveAccumulated    = flag.Bool("save-results", true, "Save results to accumulated JSON file for graphing")
 		shortPrompts       = flag.Bool("short-prompts", false, "Generate shorter iterative prompts by removing summaries and truncating error details")
 		MoreContextEnabled = flag.Bool("more-context", false, "Add more context: combine prompt.txt with spanner_sql_generation_guidelines.txt")
 		saveOutput         = flag.Bool("save-output", true, "Save output to file")
 		verbose            = flag.Bool("verbose", false, "Verbose output for each pipeline")
 		model              = flag.String("model", "chatgpt-4o-latest", "OpenAI model to use")
+		maxContinuations   = flag.Int("max-continuations", integration.DefaultMaxContinuations, "Maximum continuation requests when a response is truncated by the token limit")
+		structuredOutput   = flag.Bool("structured-output", false, "Request JSON structured output (list of statements with notes) instead of a SQL code block")
+		conversationMode   = flag.String("conversation-mode", integration.ConversationModeLocal, "Conversation state: 'local' (resend history), 'conversations' (server-side conversation) or 'responses' (previous_response_id)")
+		persistSession     = flag.Bool("persist-session", true, "Persist iterative sessions to sessions/<id>.json as they progress")
+		modelRegistry      = flag.String("model-registry", "", "JSON file overriding or extending the embedded model capability registry")
+		reasoningEffort    = flag.String("reasoning-effort", "", "Reasoning effort for models that support it: 'low', 'medium' or 'high'")
+		historyStrategy    = flag.String("history-strategy", integration.HistoryFull, "History sent on each iterative request: 'full', 'last-turns', 'anchored' (initial prompt + latest SQL + latest feedback) or 'summarised'")
+		historyTurns       = flag.Int("history-turns", integration.DefaultHistoryTurns, "Recent turns kept by the 'last-turns' and 'summarised' history strategies")
+		promptTemplates    = flag.String("prompt-templates", integration.DefaultPromptTemplateSet, "Prompt template set: a folder under prompts/ or an embedded set ('default', 'explicit')")
+		shots              = flag.Int("shots", 0, "Number of few-shot examples added to the initial prompt")
+		shotStrategy       = flag.String("shot-strategy", integration.ShotStrategyFixed, "Few-shot selection: 'fixed', 'random' or 'similar' (table/feature overlap with the source)")
+		shotSeed           = flag.Int64("shot-seed", 0, "Seed for the 'random' shot strategy (0 picks one and records it)")
+		examplesFile       = flag.String("examples", "", "JSON file with few-shot examples (defaults to the embedded examples)")
+		candidates         = flag.Int("candidates", 1, "Candidate translations sampled per turn; the best scoring one is kept (best-of-N)")
+		scoreMetric        = flag.String("score-metric", integration.MetricOverall, "Metric ranking iterations and candidates: 'overall', 'parse', 'execution' or 'errors'")
+		rollback           = flag.Bool("rollback", false, "Roll the conversation back to the best iteration when a new iteration regresses")
+		stopNoImprovement  = flag.Int("stop-no-improvement", 0, "Stop after this many iterations without improving the best score (0 disables)")
+		stopIdenticalSQL   = flag.Bool("stop-identical-sql", false, "Stop when the model returns SQL identical to an earlier iteration")
+		stopSameErrors     = flag.Bool("stop-unchanged-errors", false, "Stop when an iteration reports the same errors as the previous one")
+		tokenBudget        = flag.Int("token-budget", 0, "Stop once the run has used this many tokens (0 disables)")
+		feedback           = flag.String("feedback", integration.FeedbackFull, "Feedback strategy for the repair loop: full, errors-only, annotated-sql, category-hints, guidelines or fix-list")
+		guidelineMode      = flag.String("guidelines", "", "Guidelines in the prompts: none, all (same as --more-context) or retrieved (only the sections for the source features and the observed errors)")
+		emulators          = flag.Int("emulators", tools.DefaultEmulatorPoolSize, "Number of Spanner emulator containers shared by all instances")
+		emulatorHost       = flag.String("emulator-host", "", "host:port of a running Spanner emulator to use instead of starting containers (default: $SPANNER_EMULATOR_HOST)")
+		pgAdapterHost      = flag.String("pgadapter-host", "", "host:port of a running PGAdapter in front of --emulator-host, for the PostgreSQL dialect (default: $PGADAPTER_HOST)")
+		dialect            = flag.String("dialect", integration.TargetDialectGoogleSQL, "Spanner dialect to translate into and evaluate against: GoogleSQL or PostgreSQL")
+		semanticCheck      = flag.String("semantic-check", integration.SemanticCheckOff, "Check statements against the schema they build before execution: off, on (skip rejected statements) or offline (no emulator)")
+		toolBudget         = flag.Int("tool-budget", integration.DefaultToolBudget, "Maximum tool calls the model may make in agent mode")
+		benchmark          = flag.String("benchmark", "", "Run the tasks of a benchmark manifest (e.g. "+integration.DefaultBenchmarkManifest+") instead of prompt.txt")
+		tasks              = flag.String("tasks", "", "Comma separated task ids to run from the benchmark manifest (default: all)")
+		runs               = flag.Int("runs", 1, "Runs per benchmark task")
+		experiment         = flag.String("experiment", "", "Run the missing cells of an experiment definition (e.g. experiments/example.json), resuming from pipeline_results.json")
 	)
 
 	flag.Usage = func() {
@@ -37,11 +75,18 @@ func runMultiple() int {
 		fmt.Fprintf(os.Stderr, "  --debug-prompt saves all prompts to debug_prompts_<timestamp>.txt\n")
 		fmt.Fprintf(os.Stderr, "  --short-prompts generates shorter iterative prompts by removing summaries\n")
 		fmt.Fprintf(os.Stderr, "  --concurrent specifies number of concurrent pipeline instances (default: 3)\n")
+		fmt.Fprintf(os.Stderr, "  --instances runs more instances than workers, --rpm, --tpm and --spend-cap are shared by all of them\n")
 		fmt.Fprintf(os.Stderr, "  --save-output saves output to file\n")
 	}
 
 	flag.Parse()
 
+	tools.SetDefaultEmulatorPoolSize(*emulators)
+	tools.SetEmulatorHost(*emulatorHost)
+	tools.SetPGAdapterHost(*pgAdapterHost)
+	defer tools.DefaultEmulatorPool().Close()
+	defer tools.DefaultPGEmulatorPool().Close()
+
 	// Get base path (parent directory)
 	basePath, err := integration.GetBasePath()
 	if err != nil {
@@ -49,51 +94,83 @@ func runMultiple() int {
 		return 2
 	}
 
-	fmt.Printf("Starting %d concurrent OpenAI pipeline instances...\n", *numConcurrent)
+	outputFile := ""
+	if *saveOutput {
+		outputFile = fmt.Sprintf("%s-%d-%s.sql", *model, *maxIterations, time.Now().Format("20060102150405"))
+	}
+
+	config := integration.PipelineConfig{
+		Mode:                 *mode,
+		MaxIterations:        *maxIterations,
+		OutputFile:           outputFile,
+		Verbose:              *verbose,
+		SaveAccumulated:      *saveAccumulated,
+		DebugPrompt:          false,
+		ShortPrompts:         *shortPrompts,
+		MoreContextEnabled:   *MoreContextEnabled,
+		Model:                *model,
+		MaxContinuations:     *maxContinuations,
+		ToolBudget:           *toolBudget,
+		StructuredOutput:     *structuredOutput,
+		PersistSession:       *persistSession,
+		ConversationMode:     *conversationMode,
+		ModelRegistryPath:    *modelRegistry,
+		ReasoningEffort:      *reasoningEffort,
+		HistoryStrategy:      *historyStrategy,
+		HistoryTurns:         *historyTurns,
+		PromptTemplates:      *promptTemplates,
+		Shots:                *shots,
+		ShotStrategy:         *shotStrategy,
+		ShotSeed:             *shotSeed,
+		ExamplesFile:         *examplesFile,
+		Candidates:           *candidates,
+		ScoreMetric:          *scoreMetric,
+		RollbackOnRegression: *rollback,
+		StopPolicy: integration.StopPolicy{
+			NoImprovement:   *stopNoImprovement,
+			IdenticalSQL:    *stopIdenticalSQL,
+			UnchangedErrors: *stopSameErrors,
+			TokenBudget:     *tokenBudget,
+		},
+		FeedbackStrategy: *feedback,
+		GuidelineMode:    *guidelineMode,
+		TargetDialect:    *dialect,
+		SemanticCheck:    *semanticCheck,
+		Limiter:          integration.NewUsageLimiter(*rpm, *tpm, *spendCap),
+	}
+
+	if *experiment != "" {
+		return runExperiment(*experiment, *numConcurrent, config, basePath)
+	}
+	if *benchmark != "" {
+		return runBenchmark(*benchmark, *tasks, *runs, *numConcurrent, config, basePath)
+	}
+
+	instances := *numInstances
+	if instances <= 0 {
+		instances = *numConcurrent
+	}
+
+	fmt.Printf("Starting %d OpenAI pipeline instances on %d workers...\n", instances, *numConcurrent)
 	fmt.Printf("Mode: %s | Model: %s | Iterations: %d | Short Prompts: %v | HasMoreContext: %v\n", *mode, *model, *maxIterations, *shortPrompts, *MoreContextEnabled)
 	fmt.Printf("=== CONCURRENT EXECUTION PROGRESS ===\n")
 
 	start := time.Now()
 
-	// Channel to collect results
-	results := make(chan *PipelineExecutionResult, *numConcurrent)
-	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var allResults []*PipelineExecutionResult
 
-	outputFile := ""
-	if *saveOutput {
-		outputFile = fmt.Sprintf("%s-%d-%s.sql", *model, *maxIterations, time.Now().Format("20060102150405"))
-	}
+	pool := integration.NewWorkerPool(*numConcurrent)
+	pool.SetLimiter(config.Limiter)
+	stats := pool.Run(instances, func(index int) error {
+		instanceConfig := config
+		instanceConfig.UniqueID = fmt.Sprintf("instance-%d", index+1)
+		result := runPipelineInstance(index+1, instanceConfig, basePath)
 
-	// Launch concurrent pipeline instances
-	for i := 0; i < *numConcurrent; i++ {
-		wg.Add(1)
-		go func(instanceID int) {
-			defer wg.Done()
-			runPipelineInstance(instanceID, integration.PipelineConfig{
-				Mode:               *mode,
-				MaxIterations:      *maxIterations,
-				OutputFile:         outputFile,
-				Verbose:            *verbose,
-				SaveAccumulated:    *saveAccumulated,
-				DebugPrompt:        false,
-				ShortPrompts:       *shortPrompts,
-				MoreContextEnabled: *MoreContextEnabled,
-				UniqueID:           fmt.Sprintf("instance-%d", instanceID),
-				Model:              *model,
-			}, basePath, results)
-		}(i + 1)
-	}
-
-	// Wait for all goroutines to complete
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	// Collect and process results
-	var allResults []*PipelineExecutionResult
-	for result := range results {
+		mu.Lock()
 		allResults = append(allResults, result)
+		mu.Unlock()
+
 		if result.Error != nil {
 			fmt.Printf("Instance %d: FAILED - %v\n", result.InstanceID, result.Error)
 		} else {
@@ -103,7 +180,8 @@ func runMultiple() int {
 				result.OverallSuccessRate,
 				result.ExecutionTime.Round(time.Second))
 		}
-	}
+		return result.Error
+	})
 
 	totalTime := time.Since(start)
 
@@ -118,7 +196,7 @@ func runMultiple() int {
 		}
 	}
 
-	if successCount == len(allResults) {
+	if successCount == len(allResults) && stats.Skipped == 0 {
 		return 0 // All succeeded
 	} else if successCount > 0 {
 		return 1 // Partial success
@@ -126,6 +204,70 @@ func runMultiple() int {
 	return 2 // All failed
 }
 
+// runBenchmark runs every selected task of a benchmark manifest and prints the aggregated results
+func runBenchmark(manifestPath, taskList string, runs, concurrency int, config integration.PipelineConfig, basePath string) int {
+	manifest, err := integration.LoadBenchmarkManifest(manifestPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading benchmark: %v\n", err)
+		return 2
+	}
+	if taskList != "" {
+		if err := manifest.Select(strings.Split(taskList, ",")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error selecting tasks: %v\n", err)
+			return 2
+		}
+	}
+
+	runner := integration.NewBenchmarkRunner(manifest, config, basePath)
+	runner.SetRuns(runs)
+	runner.SetConcurrency(concurrency)
+	result, err := runner.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Benchmark error: %v\n", err)
+		return 2
+	}
+
+	integration.PrintBenchmarkSummary(result)
+	if path, err := integration.SaveBenchmarkResult(result, basePath); err != nil {
+		fmt.Printf("Warning: Failed to save benchmark result: %v\n", err)
+	} else {
+		fmt.Printf("Benchmark result saved to: %s\n", path)
+	}
+
+	if result.Overall.Successes == result.Overall.Runs {
+		return 0
+	} else if result.Overall.Successes > 0 {
+		return 1
+	}
+	return 2
+}
+
+// runExperiment runs the cells of an experiment not yet found in pipeline_results.json and prints
+// the summary of every cell
+func runExperiment(experimentPath string, concurrency int, config integration.PipelineConfig, basePath string) int {
+	experiment, err := integration.LoadExperiment(experimentPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading experiment: %v\n", err)
+		return 2
+	}
+
+	runner := integration.NewExperimentRunner(experiment, config, basePath)
+	runner.SetConcurrency(concurrency)
+	summaries, err := runner.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Experiment error: %v\n", err)
+		return 2
+	}
+
+	integration.PrintExperimentSummary(experiment.Name, summaries)
+	if path, err := integration.SaveExperimentSummary(experiment.Name, summaries, basePath); err != nil {
+		fmt.Printf("Warning: Failed to save experiment summary: %v\n", err)
+	} else {
+		fmt.Printf("Experiment summary saved to: %s\n", path)
+	}
+	return 0
+}
+
 // PipelineExecutionResult holds the result of a single pipeline execution
 type PipelineExecutionResult struct {
 	InstanceID         int
@@ -137,8 +279,8 @@ type PipelineExecutionResult struct {
 	Error              error
 }
 
-// runPipelineInstance runs a single pipeline instance and sends the result to the channel
-func runPipelineInstance(instanceID int, config integration.PipelineConfig, basePath string, results chan<- *PipelineExecutionResult) {
+// runPipelineInstance runs a single pipeline instance
+func runPipelineInstance(instanceID int, config integration.PipelineConfig, basePath string) *PipelineExecutionResult {
 	start := time.Now()
 
 	// Create pipeline runner for this instance
@@ -159,7 +301,7 @@ func runPipelineInstance(instanceID int, config integration.PipelineConfig, base
 		executionResult.OverallSuccessRate = float64(result.TestResults.ExecutedCount) / float64(result.TestResults.TotalStatements) * 100
 	}
 
-	results <- executionResult
+	return executionResult
 }
 
 // printConcurrentSummary prints a summary of all concurrent executions
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	integration "sql-parser/openai_integration"
+	"sql-parser/tools"
 )
 
 func main() {
@@ -13,7 +14,7 @@ func main() {
 
 func run() int {
 	var (
-		mode               = flag.String("mode", "iterative", "Mode: 'single' or 'iterative'")
+		mode               = flag.String("mode", "iterative", "Mode: 'single', 'iterative' or 'agent'")
 		maxIterations      = flag.Int("iterations", 2, "Maximum iterations for iterative mode")
 		outputFile         = flag.String("output", "", "Output file for generated SQL (optional)")
 		verbose            = flag.Bool("verbose", false, "Verbose output")
@@ -21,6 +22,34 @@ func run() int {
 		saveAccumulated    = flag.Bool("save-results", true, "Save results to accumulated JSON file for graphing")
 		shortPrompts       = flag.Bool("short-prompts", false, "Generate shorter iterative prompts by removing summaries and truncating error details")
 		moreContextEnabled = flag.Bool("more-context", false, "Add more context: combine prompt.txt with spanner_sql_generation_guidelines.txt")
+		maxContinuations   = flag.Int("max-continuations", integration.DefaultMaxContinuations, "Maximum continuation requests when a response is truncated by the token limit")
+		structuredOutput   = flag.Bool("structured-output", false, "Request JSON structured output (list of statements with notes) instead of a SQL code block")
+		resumeSession      = flag.String("resume", "", "Resume a persisted iterative session by ID (uses the persisted configuration)")
+		conversationMode   = flag.String("conversation-mode", integration.ConversationModeLocal, "Conversation state: 'local' (resend history), 'conversations' (server-side conversation) or 'responses' (previous_response_id)")
+		persistSession     = flag.Bool("persist-session", true, "Persist iterative sessions to sessions/<id>.json as they progress")
+		modelRegistry      = flag.String("model-registry", "", "JSON file overriding or extending the embedded model capability registry")
+		reasoningEffort    = flag.String("reasoning-effort", "", "Reasoning effort for models that support it: 'low', 'medium' or 'high'")
+		historyStrategy    = flag.String("history-strategy", integration.HistoryFull, "History sent on each iterative request: 'full', 'last-turns', 'anchored' (initial prompt + latest SQL + latest feedback) or 'summarised'")
+		historyTurns       = flag.Int("history-turns", integration.DefaultHistoryTurns, "Recent turns kept by the 'last-turns' and 'summarised' history strategies")
+		promptTemplates    = flag.String("prompt-templates", integration.DefaultPromptTemplateSet, "Prompt template set: a folder under prompts/ or an embedded set ('default', 'explicit')")
+		shots              = flag.Int("shots", 0, "Number of few-shot examples added to the initial prompt")
+		shotStrategy       = flag.String("shot-strategy", integration.ShotStrategyFixed, "Few-shot selection: 'fixed', 'random' or 'similar' (table/feature overlap with the source)")
+		shotSeed           = flag.Int64("shot-seed", 0, "Seed for the 'random' shot strategy (0 picks one and records it)")
+		examplesFile       = flag.String("examples", "", "JSON file with few-shot examples (defaults to the embedded examples)")
+		candidates         = flag.Int("candidates", 1, "Candidate translations sampled per turn; the best scoring one is kept (best-of-N)")
+		scoreMetric        = flag.String("score-metric", integration.MetricOverall, "Metric ranking iterations and candidates: 'overall', 'parse', 'execution' or 'errors'")
+		rollback           = flag.Bool("rollback", false, "Roll the conversation back to the best iteration when a new iteration regresses")
+		stopNoImprovement  = flag.Int("stop-no-improvement", 0, "Stop after this many iterations without improving the best score (0 disables)")
+		stopIdenticalSQL   = flag.Bool("stop-identical-sql", false, "Stop when the model returns SQL identical to an earlier iteration")
+		stopSameErrors     = flag.Bool("stop-unchanged-errors", false, "Stop when an iteration reports the same errors as the previous one")
+		tokenBudget        = flag.Int("token-budget", 0, "Stop once the run has used this many tokens (0 disables)")
+		feedback           = flag.String("feedback", integration.FeedbackFull, "Feedback strategy for the repair loop: full, errors-only, annotated-sql, category-hints, guidelines or fix-list")
+		guidelineMode      = flag.String("guidelines", "", "Guidelines in the prompts: none, all (same as --more-context) or retrieved (only the sections for the source features and the observed errors)")
+		emulatorHost       = flag.String("emulator-host", "", "host:port of a running Spanner emulator to use instead of starting containers (default: $SPANNER_EMULATOR_HOST)")
+		pgAdapterHost      = flag.String("pgadapter-host", "", "host:port of a running PGAdapter in front of --emulator-host, for the PostgreSQL dialect (default: $PGADAPTER_HOST)")
+		dialect            = flag.String("dialect", integration.TargetDialectGoogleSQL, "Spanner dialect to translate into and evaluate against: GoogleSQL or PostgreSQL")
+		semanticCheck      = flag.String("semantic-check", integration.SemanticCheckOff, "Check statements against the schema they build before execution: off, on (skip rejected statements) or offline (no emulator)")
+		toolBudget         = flag.Int("tool-budget", integration.DefaultToolBudget, "Maximum tool calls the model may make in agent mode")
 	)
 
 	flag.Usage = func() {
@@ -33,11 +62,17 @@ func run() int {
 		fmt.Fprintf(os.Stderr, "\nDebugging:\n")
 		fmt.Fprintf(os.Stderr, "  --debug-prompt saves all prompts to debug_prompts_<timestamp>.txt\n")
 		fmt.Fprintf(os.Stderr, "  --short-prompts generates shorter iterative prompts by removing summaries\n")
+		fmt.Fprintf(os.Stderr, "\nResuming:\n")
+		fmt.Fprintf(os.Stderr, "  --resume <session> continues an interrupted iterative run from sessions/<session>.json\n")
 		fmt.Fprintf(os.Stderr, "\nData Collection:\n")
 		fmt.Fprintf(os.Stderr, "  --save-results=false disables saving to pipeline_results.json for graphing\n")
 	}
 
 	flag.Parse()
+	tools.SetEmulatorHost(*emulatorHost)
+	tools.SetPGAdapterHost(*pgAdapterHost)
+	defer tools.DefaultEmulatorPool().Close()
+	defer tools.DefaultPGEmulatorPool().Close()
 
 	// Get base path (parent directory)
 	basePath, err := integration.GetBasePath()
@@ -48,15 +83,43 @@ func run() int {
 
 	// Create pipeline configuration
 	config := integration.PipelineConfig{
-		Mode:               *mode,
-		MaxIterations:      *maxIterations,
-		OutputFile:         *outputFile,
-		Verbose:            *verbose,
-		DebugPrompt:        *debugPrompt,
-		SaveAccumulated:    *saveAccumulated,
-		ShortPrompts:       *shortPrompts,
-		MoreContextEnabled: *moreContextEnabled,
-		UniqueID:           "", // Single instance doesn't need unique ID
+		Mode:                 *mode,
+		MaxIterations:        *maxIterations,
+		OutputFile:           *outputFile,
+		Verbose:              *verbose,
+		DebugPrompt:          *debugPrompt,
+		SaveAccumulated:      *saveAccumulated,
+		ShortPrompts:         *shortPrompts,
+		MoreContextEnabled:   *moreContextEnabled,
+		UniqueID:             "", // Single instance doesn't need unique ID
+		MaxContinuations:     *maxContinuations,
+		ToolBudget:           *toolBudget,
+		StructuredOutput:     *structuredOutput,
+		PersistSession:       *persistSession,
+		ConversationMode:     *conversationMode,
+		ModelRegistryPath:    *modelRegistry,
+		ReasoningEffort:      *reasoningEffort,
+		HistoryStrategy:      *historyStrategy,
+		HistoryTurns:         *historyTurns,
+		PromptTemplates:      *promptTemplates,
+		Shots:                *shots,
+		ShotStrategy:         *shotStrategy,
+		ShotSeed:             *shotSeed,
+		ExamplesFile:         *examplesFile,
+		Candidates:           *candidates,
+		ScoreMetric:          *scoreMetric,
+		RollbackOnRegression: *rollback,
+		StopPolicy: integration.StopPolicy{
+			NoImprovement:   *stopNoImprovement,
+			IdenticalSQL:    *stopIdenticalSQL,
+			UnchangedErrors: *stopSameErrors,
+			TokenBudget:     *tokenBudget,
+		},
+		FeedbackStrategy: *feedback,
+		GuidelineMode:    *guidelineMode,
+		TargetDialect:    *dialect,
+		SemanticCheck:    *semanticCheck,
+		ResumeSessionID:  *resumeSession,
 	}
 
 	// Create and run pipeline
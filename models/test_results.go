@@ -31,13 +31,50 @@ type TestFileResult struct {
 	SelectStatements int
 	DropStatements   int
 	// Execution results
-	ExecutedCount   int
-	FailedCount     int
-	ErrorRate       float64
-	ExecutionTime   time.Duration
-	ExecutionErrors []string
-	ErrorCodes      map[string]int // error_code -> count
-	ErrorCategories map[string]int // detailed_category -> count
+	ExecutedCount         int
+	FailedCount           int
+	ErrorRate             float64
+	ExecutionTime         time.Duration
+	ExecutionErrors       []string
+	ExecutionErrorDetails []ExecutionError // Execution errors with the failing statement
+	ErrorCodes            map[string]int   // error_code -> count
+	ErrorCategories       map[string]int   // detailed_category -> count
+	// Expected query results of a benchmark task
+	QueryChecks []QueryCheck
+	// Schema objects of the PostgreSQL source kept by the translation, nil when the source is unknown
+	SchemaFidelity *SchemaFidelity
+	// Offline results were only checked by the semantic analysis: nothing was executed and
+	// AnalyzedCount statements passed the analysis
+	Offline       bool
+	AnalyzedCount int
+}
+
+// SchemaFidelity compares the schema of a translation with the schema of its PostgreSQL source
+type SchemaFidelity struct {
+	// Score is the share of source objects kept, altered objects count half; 1 without source objects
+	Score     float64        `json:"score"`
+	Total     int            `json:"total"`
+	Preserved int            `json:"preserved"`
+	Altered   int            `json:"altered"`
+	Dropped   int            `json:"dropped"`
+	Changes   []SchemaChange `json:"changes,omitempty"`
+}
+
+// SchemaChange is a source schema object the translation dropped or altered
+type SchemaChange struct {
+	Kind   string `json:"kind"`   // table, column, not null, unique, check, foreign key, key generation
+	Object string `json:"object"` // e.g. books.isbn or loans(member_id)
+	Status string `json:"status"` // dropped or altered
+	Detail string `json:"detail,omitempty"`
+}
+
+// QueryCheck is the outcome of running an expected query against the translated schema
+type QueryCheck struct {
+	Query    string
+	Passed   bool
+	Expected [][]string
+	Actual   [][]string
+	Error    string
 }
 
 // ParseResult holds the result of parsing a single statement
@@ -0,0 +1,422 @@
+package integration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"sql-parser/repo"
+	"sql-parser/tools"
+)
+
+const (
+	AgentToolParseSQL         = "parse_sql"
+	AgentToolExecuteStatement = "execute_statement"
+	AgentToolDescribeSchema   = "describe_schema"
+	AgentToolLookupGuideline  = "lookup_guideline"
+	AgentToolSubmitSQL        = "submit_sql"
+
+	// DefaultToolBudget is the maximum number of tool calls (excluding submit_sql) per agent run
+	DefaultToolBudget = 20
+
+	maxGuidelineMatches = 3
+)
+
+// AgentInstructions is appended to the initial prompt in agent mode
+const AgentInstructions = `You can use tools while translating:
+- parse_sql: check Spanner GoogleSQL syntax of one or more statements with the memefish parser
+- execute_statement: run a single statement against a scratch Spanner emulator database (state persists between calls)
+- describe_schema: list the tables and columns currently present in the scratch database
+- lookup_guideline: search the Spanner SQL generation guidelines by keyword
+
+You have a limited budget of tool calls. When you are done, call submit_sql with the complete translated script.`
+
+// agentToolbox backs the function tools exposed to the model in agent mode
+type agentToolbox struct {
+	promptReader *PromptReader
+
+	// Scratch database on the shared emulators, created lazily on the first call that needs it
+	db       *sql.DB
+	release  func()
+	executor *repo.SQLExecutor
+}
+
+func newAgentToolbox(promptReader *PromptReader) *agentToolbox {
+	return &agentToolbox{
+		promptReader: promptReader,
+	}
+}
+
+// definitions returns the tool schemas sent to the API
+func (tb *agentToolbox) definitions(includeWorkTools bool) []Tool {
+	stringParam := func(name, description string) map[string]any {
+		return map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				name: map[string]any{"type": "string", "description": description},
+			},
+			"required": []string{name},
+		}
+	}
+
+	submit := Tool{Type: "function", Function: ToolFunction{
+		Name:        AgentToolSubmitSQL,
+		Description: "Submit the final, complete translated SQL script. Ends the session.",
+		Parameters:  stringParam("sql", "The complete translated SQL script"),
+	}}
+	if !includeWorkTools {
+		return []Tool{submit}
+	}
+
+	return []Tool{
+		{Type: "function", Function: ToolFunction{
+			Name:        AgentToolParseSQL,
+			Description: "Parse SQL with the Spanner GoogleSQL parser and report syntax errors per statement.",
+			Parameters:  stringParam("sql", "One or more SQL statements separated by semicolons"),
+		}},
+		{Type: "function", Function: ToolFunction{
+			Name:        AgentToolExecuteStatement,
+			Description: "Execute a single SQL statement on a scratch Spanner emulator database.",
+			Parameters:  stringParam("statement", "A single SQL statement"),
+		}},
+		{Type: "function", Function: ToolFunction{
+			Name:        AgentToolDescribeSchema,
+			Description: "Describe the tables and columns of the scratch database. Optionally filter by table name.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"table": map[string]any{"type": "string", "description": "Optional table name"},
+				},
+			},
+		}},
+		{Type: "function", Function: ToolFunction{
+			Name:        AgentToolLookupGuideline,
+			Description: "Search the Spanner SQL generation guidelines for sections matching a keyword.",
+			Parameters:  stringParam("query", "Keyword or phrase, e.g. 'DEFAULT' or 'view'"),
+		}},
+		submit,
+	}
+}
+
+// call dispatches a tool call and returns the text sent back to the model
+func (tb *agentToolbox) call(name, arguments string) (string, error) {
+	var args map[string]string
+	if strings.TrimSpace(arguments) != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments for %s: %w", name, err)
+		}
+	}
+
+	switch name {
+	case AgentToolParseSQL:
+		return tb.parseSQL(args["sql"])
+	case AgentToolExecuteStatement:
+		return tb.executeStatement(args["statement"])
+	case AgentToolDescribeSchema:
+		return tb.describeSchema(args["table"])
+	case AgentToolLookupGuideline:
+		return tb.lookupGuideline(args["query"])
+	default:
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+}
+
+func (tb *agentToolbox) parseSQL(content string) (string, error) {
+	statements, err := tools.ExtractStatementsFromString(content)
+	if err != nil {
+		return "", fmt.Errorf("split statements: %w", err)
+	}
+	if len(statements) == 0 {
+		return "", fmt.Errorf("no statements found")
+	}
+
+	var out strings.Builder
+	failed := 0
+	for i, pr := range tools.ParseStatementsWithMemefish(statements, "agent") {
+		if pr.Parsed {
+			out.WriteString(fmt.Sprintf("%d. OK (%s)\n", i+1, pr.Type))
+			continue
+		}
+		failed++
+		errMsg := pr.Error.Error()
+		out.WriteString(fmt.Sprintf("%d. ERROR [%s]: %s\n", i+1, tools.CategorizeMemefishError(errMsg), errMsg))
+	}
+	out.WriteString(fmt.Sprintf("Parsed %d/%d statements", len(statements)-failed, len(statements)))
+	return out.String(), nil
+}
+
+func (tb *agentToolbox) ensureDB() error {
+	if tb.db != nil {
+		return nil
+	}
+	db, release, err := tools.DefaultEmulatorPool().AcquireDB()
+	if err != nil {
+		return fmt.Errorf("connect scratch DB: %w", err)
+	}
+	tb.db = db
+	tb.release = release
+	tb.executor = repo.NewSQLExecutor(db, nil)
+	return nil
+}
+
+func (tb *agentToolbox) executeStatement(statement string) (string, error) {
+	if strings.TrimSpace(statement) == "" {
+		return "", fmt.Errorf("statement must not be empty")
+	}
+	if err := tb.ensureDB(); err != nil {
+		return "", err
+	}
+
+	result, err := tb.executor.ExecuteStatements([]string{statement})
+	if err != nil {
+		return "", err
+	}
+	if len(result.Errors) > 0 {
+		errMsg := result.Errors[0].Error()
+		code := tools.ExtractSpannerErrorCode(errMsg)
+		if code == "InvalidArgument" {
+			code = tools.CategorizeInvalidArgumentError(errMsg)
+		}
+		return "", fmt.Errorf("[%s] %s", code, errMsg)
+	}
+	if len(result.QueryResults) > 0 {
+		return fmt.Sprintf("OK, %d rows returned", result.QueryResults[0].RowCount), nil
+	}
+	return "OK", nil
+}
+
+func (tb *agentToolbox) describeSchema(table string) (string, error) {
+	if err := tb.ensureDB(); err != nil {
+		return "", err
+	}
+
+	query := `SELECT TABLE_NAME, COLUMN_NAME, SPANNER_TYPE, IS_NULLABLE
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = ''
+		ORDER BY TABLE_NAME, ORDINAL_POSITION`
+	rows, err := tb.db.Query(query)
+	if err != nil {
+		return "", fmt.Errorf("query schema: %w", err)
+	}
+	defer rows.Close()
+
+	var out strings.Builder
+	currentTable := ""
+	for rows.Next() {
+		var tableName, columnName, spannerType, nullable string
+		if err := rows.Scan(&tableName, &columnName, &spannerType, &nullable); err != nil {
+			return "", fmt.Errorf("read schema: %w", err)
+		}
+		if table != "" && !strings.EqualFold(tableName, table) {
+			continue
+		}
+		if tableName != currentTable {
+			out.WriteString(fmt.Sprintf("TABLE %s\n", tableName))
+			currentTable = tableName
+		}
+		notNull := ""
+		if nullable == "NO" {
+			notNull = " NOT NULL"
+		}
+		out.WriteString(fmt.Sprintf("  %s %s%s\n", columnName, spannerType, notNull))
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("read schema: %w", err)
+	}
+
+	if out.Len() == 0 {
+		return "No tables found", nil
+	}
+	return out.String(), nil
+}
+
+func (tb *agentToolbox) lookupGuideline(query string) (string, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return "", fmt.Errorf("query must not be empty")
+	}
+
+	sections, err := tb.promptReader.ReadGuidelineSections()
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, section := range sections {
+		text := strings.ToLower(section.Title + "\n" + section.Content)
+		if strings.Contains(text, query) {
+			matches = append(matches, section.Title+"\n"+section.Content)
+			if len(matches) == maxGuidelineMatches {
+				break
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return "No guideline sections match the query", nil
+	}
+	return strings.Join(matches, "\n\n"), nil
+}
+
+func (tb *agentToolbox) close() {
+	if tb.executor != nil {
+		_ = tb.executor.Cleanup()
+	}
+	if tb.release != nil {
+		tb.release()
+	}
+}
+
+// RunAgent lets the model use parsing and execution tools within a bounded budget before
+// submitting a final script, which is then evaluated like any other iteration
+func (p *Pipeline) RunAgent() (*PipelineResult, error) {
+	start := time.Now()
+
+	if p.conversationMode != ConversationModeLocal {
+		return nil, fmt.Errorf("agent mode requires the 'local' conversation mode, tool calls use the local history")
+	}
+	session, err := p.sessionMgr.CreateSession(DefaultModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	initialPrompt, err := p.buildInitialPrompt(AgentInstructions)
+	if err != nil {
+		return nil, err
+	}
+
+	p.savePromptToDebugFile("INITIAL PROMPT (Agent)", initialPrompt)
+
+	// Tool calls and submit_sql replace structured output in agent mode
+	p.client.SetResponseFormat(nil)
+
+	toolbox := newAgentToolbox(p.promptReader)
+	defer toolbox.close()
+
+	var toolCalls []AgentToolCall
+	var finalResponse string
+	submitted := false
+	pending := []ConversationMessage{{Role: "user", Content: initialPrompt}}
+
+	// Each turn either spends budget on tool calls or ends the run; the extra turns
+	// leave room for the forced submit after the budget is exhausted
+	for turn := 0; turn <= p.toolBudget+1 && !submitted; turn++ {
+		budgetLeft := len(toolCalls) < p.toolBudget
+		toolChoice := "auto"
+		if !budgetLeft {
+			toolChoice = "required"
+		}
+
+		aiStart := time.Now()
+		response, err := p.sessionMgr.SendMessagesWithTools(session.ID, pending, toolbox.definitions(budgetLeft), toolChoice)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send message on agent turn %d: %w", turn+1, err)
+		}
+		pending = nil
+
+		message := response.Choices[0].Message
+		fmt.Printf("  └─ [%.3fs] Agent turn %d: %d tool call(s)\n", time.Since(aiStart).Seconds(), turn+1, len(message.ToolCalls))
+
+		if len(message.ToolCalls) == 0 {
+			// The model answered without tools, treat the answer as the final script
+			finalResponse = message.Content
+			p.savePromptToDebugFile("AI RESPONSE (Agent)", finalResponse)
+			break
+		}
+
+		for _, call := range message.ToolCalls {
+			var output string
+			switch {
+			case call.Function.Name == AgentToolSubmitSQL:
+				var args map[string]string
+				if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+					output = fmt.Sprintf("ERROR: invalid arguments: %v", err)
+					break
+				}
+				finalResponse = args["sql"]
+				submitted = true
+				output = "Submitted"
+				p.savePromptToDebugFile("AI SUBMISSION (Agent)", finalResponse)
+			case len(toolCalls) >= p.toolBudget:
+				output = "ERROR: tool budget exhausted, call submit_sql with the final script"
+			default:
+				callStart := time.Now()
+				result, err := toolbox.call(call.Function.Name, call.Function.Arguments)
+				record := AgentToolCall{
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+					Result:    result,
+					Duration:  time.Since(callStart),
+				}
+				if err != nil {
+					record.Failed = true
+					record.Result = err.Error()
+					result = "ERROR: " + err.Error()
+				}
+				toolCalls = append(toolCalls, record)
+				output = result
+				p.savePromptToDebugFile(fmt.Sprintf("TOOL %s", call.Function.Name), call.Function.Arguments+"\n---\n"+output)
+			}
+
+			// Every tool call must be answered before the next request
+			pending = append(pending, ConversationMessage{
+				Role:       "tool",
+				Content:    output,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+
+	if finalResponse == "" {
+		return nil, fmt.Errorf("agent did not submit a final script after %d tool calls", len(toolCalls))
+	}
+
+	generatedSQL, warnings := p.promptReader.ExtractSQLWithWarnings(finalResponse)
+	p.printExtractionWarnings(warnings)
+	extraction := &ExtractionInfo{Method: ExtractionFencedBlock, Warnings: warnings}
+
+	testStart := time.Now()
+	testResult, err := p.testSQLString(generatedSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to test SQL: %w", err)
+	}
+	fmt.Printf("  └─ [%.3fs] SQL testing completed\n", time.Since(testStart).Seconds())
+
+	success := testSucceeded(testResult)
+	p.printIterationResult(1, testResult)
+
+	allMessages, _ := p.sessionMgr.GetConversationHistory(session.ID)
+
+	result := &PipelineResult{
+		SessionID:      session.ID,
+		ConversationID: session.ConversationID,
+		InitialPrompt:  initialPrompt,
+		GeneratedSQL:   generatedSQL,
+		TestResults:    testResult,
+		Iterations:     1,
+		IterationResults: []IterationResult{{
+			Iteration:    1,
+			TestResults:  testResult,
+			Success:      success,
+			GeneratedSQL: generatedSQL,
+			Extraction:   extraction,
+			Score:        p.score(testResult),
+			Guidelines:   p.initialGuidelines,
+		}},
+		Success:          success,
+		Messages:         allMessages,
+		TotalTime:        time.Since(start),
+		TokensUsed:       session.TotalTokens,
+		PromptTokens:     session.PromptTokens,
+		CompletionTokens: session.CompletionTokens,
+		ExecutionMode:    "agent",
+		StopReason:       finalStopReason(testResult),
+		Timestamp:        time.Now(),
+		ToolCalls:        toolCalls,
+	}
+	p.applyBestIteration(result)
+
+	return result, nil
+}
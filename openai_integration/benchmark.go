@@ -0,0 +1,573 @@
+package integration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sql-parser/models"
+	"sql-parser/tools"
+)
+
+// DefaultBenchmarkManifest is the manifest shipped with the repository
+const DefaultBenchmarkManifest = "benchmarks/manifest.json"
+
+// ExpectedQuery is a query run against the translated schema after a task's SQL was executed,
+// together with the rows it must return. Rows are compared as strings and in any order.
+type ExpectedQuery struct {
+	Query string     `json:"query"`
+	Rows  [][]string `json:"rows"`
+}
+
+// BenchmarkTask is one translation task of a benchmark manifest
+type BenchmarkTask struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Source and Gold are paths relative to the manifest
+	Source string `json:"source"`
+	Gold   string `json:"gold,omitempty"`
+	// Instructions replaces the manifest instructions for this task
+	Instructions    string          `json:"instructions,omitempty"`
+	ExpectedResults []ExpectedQuery `json:"expected_results,omitempty"`
+
+	SourceSQL string `json:"-"`
+	GoldSQL   string `json:"-"`
+}
+
+// BenchmarkManifest describes a set of translation tasks
+type BenchmarkManifest struct {
+	Name string `json:"name"`
+	// Instructions precede the source SQL of every task; defaults to the instructions of prompt.txt
+	Instructions string          `json:"instructions,omitempty"`
+	Tasks        []BenchmarkTask `json:"tasks"`
+}
+
+// LoadBenchmarkManifest reads a manifest and the source and gold SQL files of its tasks
+func LoadBenchmarkManifest(path string) (*BenchmarkManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read benchmark manifest %s: %w", path, err)
+	}
+
+	var manifest BenchmarkManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse benchmark manifest %s: %w", path, err)
+	}
+	if len(manifest.Tasks) == 0 {
+		return nil, fmt.Errorf("benchmark manifest %s has no tasks", path)
+	}
+
+	dir := filepath.Dir(path)
+	seen := make(map[string]bool, len(manifest.Tasks))
+	for i := range manifest.Tasks {
+		task := &manifest.Tasks[i]
+		if task.ID == "" || task.Source == "" {
+			return nil, fmt.Errorf("task %d must have an id and a source", i+1)
+		}
+		if seen[task.ID] {
+			return nil, fmt.Errorf("duplicate task id '%s'", task.ID)
+		}
+		seen[task.ID] = true
+
+		source, err := os.ReadFile(filepath.Join(dir, task.Source))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source of task %s: %w", task.ID, err)
+		}
+		task.SourceSQL = strings.TrimSpace(string(source))
+
+		if task.Gold != "" {
+			gold, err := os.ReadFile(filepath.Join(dir, task.Gold))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read gold SQL of task %s: %w", task.ID, err)
+			}
+			task.GoldSQL = strings.TrimSpace(string(gold))
+		}
+	}
+
+	return &manifest, nil
+}
+
+// Select keeps only the tasks with the given ids, in manifest order
+func (m *BenchmarkManifest) Select(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var tasks []BenchmarkTask
+	for _, task := range m.Tasks {
+		if wanted[task.ID] {
+			tasks = append(tasks, task)
+			delete(wanted, task.ID)
+		}
+	}
+	for id := range wanted {
+		return fmt.Errorf("unknown task '%s'", id)
+	}
+	m.Tasks = tasks
+	return nil
+}
+
+// Prompt builds the initial prompt of a task: the instructions followed by the source SQL
+func (t BenchmarkTask) Prompt(instructions string) string {
+	if t.Instructions != "" {
+		instructions = t.Instructions
+	}
+	return strings.TrimSpace(instructions) + "\n\n" + t.SourceSQL
+}
+
+// runQueryChecks runs the expected queries of a task against the database the translated SQL was
+// executed in
+func runQueryChecks(db *sql.DB, queries []ExpectedQuery) []models.QueryCheck {
+	checks := make([]models.QueryCheck, 0, len(queries))
+	for _, expected := range queries {
+		check := models.QueryCheck{Query: expected.Query, Expected: expected.Rows}
+		rows, err := queryRowsAsStrings(db, expected.Query)
+		if err != nil {
+			check.Error = err.Error()
+		} else {
+			check.Actual = rows
+			check.Passed = sameRows(expected.Rows, rows)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func queryRowsAsStrings(db *sql.DB, query string) ([][]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var result [][]string
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		row := make([]string, len(columns))
+		for i, value := range values {
+			if value == nil {
+				row[i] = "NULL"
+			} else {
+				row[i] = fmt.Sprint(value)
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// sameRows compares two result sets ignoring row order
+func sameRows(expected, actual [][]string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	join := func(rows [][]string) []string {
+		joined := make([]string, len(rows))
+		for i, row := range rows {
+			joined[i] = strings.Join(row, "\x1f")
+		}
+		sort.Strings(joined)
+		return joined
+	}
+	a, b := join(expected), join(actual)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// BenchmarkRun is the outcome of one pipeline run on one task
+type BenchmarkRun struct {
+	TaskID         string        `json:"task_id"`
+	Run            int           `json:"run"`
+	ConversationID string        `json:"conversation_id,omitempty"`
+	Success        bool          `json:"success"`
+	Score          float64       `json:"score"`
+	Iterations     int           `json:"iterations"`
+	TokensUsed     int           `json:"tokens_used"`
+	QueriesPassed  int           `json:"queries_passed"`
+	QueriesTotal   int           `json:"queries_total"`
+	GeneratedSQL   string        `json:"generated_sql,omitempty"`
+	Duration       time.Duration `json:"duration"`
+	Error          string        `json:"error,omitempty"`
+
+	SchemaFidelity *models.SchemaFidelity `json:"schema_fidelity,omitempty"`
+	// GoldFidelity scores the schema of the generated SQL against the task's gold script
+	GoldFidelity *models.SchemaFidelity `json:"gold_fidelity,omitempty"`
+}
+
+// BenchmarkSummary aggregates runs, either of one task or of the whole benchmark
+type BenchmarkSummary struct {
+	TaskID         string  `json:"task_id,omitempty"`
+	Title          string  `json:"title,omitempty"`
+	Runs           int     `json:"runs"`
+	Errors         int     `json:"errors"`
+	Successes      int     `json:"successes"`
+	SuccessRate    float64 `json:"success_rate"`
+	MeanScore      float64 `json:"mean_score"`
+	MeanIterations float64 `json:"mean_iterations"`
+	MeanTokens     float64 `json:"mean_tokens"`
+	QueryPassRate  float64 `json:"query_pass_rate"`
+	// MeanSchemaFidelity averages the schema fidelity scores of the runs that have one
+	MeanSchemaFidelity float64 `json:"mean_schema_fidelity,omitempty"`
+	// MeanGoldFidelity averages the gold fidelity scores of the runs that have one
+	MeanGoldFidelity float64 `json:"mean_gold_fidelity,omitempty"`
+	// Gold is the evaluation of the task's gold script, only set on task summaries
+	Gold *GoldCheck `json:"gold,omitempty"`
+}
+
+// GoldCheck is the evaluation of a task's gold script. It validates the fixture: the gold script
+// must execute without errors and pass the task's expected queries.
+type GoldCheck struct {
+	ParseErrors     []string `json:"parse_errors,omitempty"`
+	ExecutionErrors []string `json:"execution_errors,omitempty"`
+	QueriesPassed   int      `json:"queries_passed"`
+	QueriesTotal    int      `json:"queries_total"`
+	// Offline is set when the gold script was only checked by the semantic analysis
+	Offline bool   `json:"offline,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Valid reports whether the gold script passed every check that was run
+func (g *GoldCheck) Valid() bool {
+	return g.Error == "" && len(g.ParseErrors) == 0 && len(g.ExecutionErrors) == 0 &&
+		(g.Offline || g.QueriesPassed == g.QueriesTotal)
+}
+
+// BenchmarkResult is written to benchmark_results/ after a benchmark run
+type BenchmarkResult struct {
+	Manifest  string             `json:"manifest"`
+	Model     string             `json:"model"`
+	Mode      string             `json:"mode"`
+	StartedAt time.Time          `json:"started_at"`
+	Duration  time.Duration      `json:"duration"`
+	Tasks     []BenchmarkSummary `json:"tasks"`
+	// Overall weighs every run equally; MacroSuccessRate averages the per-task success rates
+	Overall          BenchmarkSummary `json:"overall"`
+	MacroSuccessRate float64          `json:"macro_success_rate"`
+	Runs             []BenchmarkRun   `json:"runs"`
+}
+
+// BenchmarkRunner runs the pipeline on every task of a manifest and aggregates the results
+type BenchmarkRunner struct {
+	manifest    *BenchmarkManifest
+	config      PipelineConfig
+	basePath    string
+	runs        int
+	concurrency int
+}
+
+// NewBenchmarkRunner creates a runner executing each task once with config, one task at a time
+func NewBenchmarkRunner(manifest *BenchmarkManifest, config PipelineConfig, basePath string) *BenchmarkRunner {
+	return &BenchmarkRunner{
+		manifest:    manifest,
+		config:      config,
+		basePath:    basePath,
+		runs:        1,
+		concurrency: 1,
+	}
+}
+
+// SetRuns sets how many times every task is run
+func (br *BenchmarkRunner) SetRuns(runs int) {
+	if runs > 0 {
+		br.runs = runs
+	}
+}
+
+// SetConcurrency sets how many pipeline runs execute at the same time
+func (br *BenchmarkRunner) SetConcurrency(concurrency int) {
+	if concurrency > 0 {
+		br.concurrency = concurrency
+	}
+}
+
+// Run executes runs × tasks pipeline runs and aggregates them per task and overall
+func (br *BenchmarkRunner) Run() (*BenchmarkResult, error) {
+	instructions := br.manifest.Instructions
+	if instructions == "" {
+		prompt, err := NewPromptReader(br.basePath).ReadPromptFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read default instructions: %w", err)
+		}
+		instructions, _ = tools.SplitPrompt(prompt)
+	}
+
+	start := time.Now()
+	golds := make(map[string]*GoldCheck)
+	for _, task := range br.manifest.Tasks {
+		if task.GoldSQL == "" {
+			continue
+		}
+		gold := br.checkGold(task, instructions)
+		golds[task.ID] = gold
+		if !gold.Valid() {
+			fmt.Printf("Warning: the gold script of task %s fails the task's checks (%d parse errors, %d execution errors, %d/%d queries passed%s)\n",
+				task.ID, len(gold.ParseErrors), len(gold.ExecutionErrors), gold.QueriesPassed, gold.QueriesTotal, errorSuffix(gold.Error))
+		}
+	}
+
+	total := len(br.manifest.Tasks) * br.runs
+	fmt.Printf("Running benchmark %s: %d task(s) x %d run(s)\n", br.manifest.Name, len(br.manifest.Tasks), br.runs)
+
+	runs := make([]BenchmarkRun, 0, total)
+	var mu sync.Mutex
+
+	pool := NewWorkerPool(br.concurrency)
+	pool.SetLimiter(br.config.Limiter)
+	pool.Run(total, func(index int) error {
+		task := br.manifest.Tasks[index/br.runs]
+		run := index%br.runs + 1
+		result := br.runTask(task, run, instructions)
+
+		mu.Lock()
+		runs = append(runs, result)
+		done := len(runs)
+		mu.Unlock()
+
+		status := "FAILED"
+		if result.Error != "" {
+			status = "ERROR: " + result.Error
+		} else if result.Success {
+			status = "SUCCESS"
+		}
+		fmt.Printf("[%d/%d] %s run %d: %s | Score: %.3f | Queries: %d/%d\n",
+			done, total, task.ID, run, status, result.Score, result.QueriesPassed, result.QueriesTotal)
+		if result.Error != "" {
+			return errors.New(result.Error)
+		}
+		return nil
+	})
+
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].TaskID != runs[j].TaskID {
+			return runs[i].TaskID < runs[j].TaskID
+		}
+		return runs[i].Run < runs[j].Run
+	})
+
+	result := &BenchmarkResult{
+		Manifest:  br.manifest.Name,
+		Model:     br.config.Model,
+		Mode:      br.config.Mode,
+		StartedAt: start,
+		Duration:  time.Since(start),
+		Runs:      runs,
+	}
+	for _, task := range br.manifest.Tasks {
+		var taskRuns []BenchmarkRun
+		for _, run := range runs {
+			if run.TaskID == task.ID {
+				taskRuns = append(taskRuns, run)
+			}
+		}
+		summary := summarizeBenchmarkRuns(taskRuns)
+		summary.TaskID = task.ID
+		summary.Title = task.Title
+		summary.Gold = golds[task.ID]
+		result.Tasks = append(result.Tasks, summary)
+		result.MacroSuccessRate += summary.SuccessRate / float64(len(br.manifest.Tasks))
+	}
+	result.Overall = summarizeBenchmarkRuns(runs)
+
+	return result, nil
+}
+
+// runTask runs the pipeline once on a task
+func (br *BenchmarkRunner) runTask(task BenchmarkTask, run int, instructions string) BenchmarkRun {
+	config := br.config
+	config.TaskID = task.ID
+	config.Prompt = task.Prompt(instructions)
+	config.ExpectedResults = task.ExpectedResults
+	config.UniqueID = fmt.Sprintf("%s-%d", task.ID, run)
+
+	start := time.Now()
+	result, _, err := NewPipelineRunner(config, br.basePath).RunWithResults()
+	outcome := BenchmarkRun{TaskID: task.ID, Run: run, Duration: time.Since(start)}
+	if err != nil {
+		outcome.Error = err.Error()
+		return outcome
+	}
+
+	outcome.ConversationID = result.ConversationID
+	outcome.Success = result.Success
+	outcome.Score = ScoreTestResult(result.TestResults)
+	outcome.Iterations = result.Iterations
+	outcome.TokensUsed = result.TokensUsed
+	outcome.GeneratedSQL = result.GeneratedSQL
+	outcome.SchemaFidelity = result.TestResults.SchemaFidelity
+	if task.GoldSQL != "" && config.TargetDialect != TargetDialectPostgreSQL {
+		outcome.GoldFidelity = tools.CompareSchemaToGold(task.GoldSQL, result.GeneratedSQL)
+	}
+	outcome.QueriesTotal = len(result.TestResults.QueryChecks)
+	for _, check := range result.TestResults.QueryChecks {
+		if check.Passed {
+			outcome.QueriesPassed++
+		}
+	}
+	return outcome
+}
+
+// checkGold evaluates the gold script of a task like a generated script, against the task's
+// expected queries. Gold scripts are GoogleSQL whatever the target dialect of the runs.
+func (br *BenchmarkRunner) checkGold(task BenchmarkTask, instructions string) *GoldCheck {
+	evaluator := &Pipeline{
+		prompt:          task.Prompt(instructions),
+		targetDialect:   TargetDialectGoogleSQL,
+		semanticCheck:   SemanticCheckOff,
+		expectedResults: task.ExpectedResults,
+	}
+	if br.config.SemanticCheck == SemanticCheckOffline {
+		evaluator.semanticCheck = SemanticCheckOffline
+	}
+
+	result, err := evaluator.evaluateSQLString(task.GoldSQL, task.Gold)
+	if err != nil {
+		return &GoldCheck{Error: err.Error()}
+	}
+	fr := result.FileResult
+	gold := &GoldCheck{
+		ParseErrors:     fr.ParseErrors,
+		ExecutionErrors: fr.ExecutionErrors,
+		QueriesTotal:    len(fr.QueryChecks),
+		Offline:         fr.Offline,
+	}
+	for _, check := range fr.QueryChecks {
+		if check.Passed {
+			gold.QueriesPassed++
+		}
+	}
+	return gold
+}
+
+// errorSuffix formats an optional error for the end of a message
+func errorSuffix(err string) string {
+	if err == "" {
+		return ""
+	}
+	return ": " + err
+}
+
+func summarizeBenchmarkRuns(runs []BenchmarkRun) BenchmarkSummary {
+	summary := BenchmarkSummary{Runs: len(runs)}
+	completed := 0
+	queriesPassed, queriesTotal := 0, 0
+	fidelityRuns, goldRuns := 0, 0
+	for _, run := range runs {
+		if run.Error != "" {
+			summary.Errors++
+			continue
+		}
+		completed++
+		if run.Success {
+			summary.Successes++
+		}
+		summary.MeanScore += run.Score
+		summary.MeanIterations += float64(run.Iterations)
+		summary.MeanTokens += float64(run.TokensUsed)
+		queriesPassed += run.QueriesPassed
+		queriesTotal += run.QueriesTotal
+		if run.SchemaFidelity != nil {
+			summary.MeanSchemaFidelity += run.SchemaFidelity.Score
+			fidelityRuns++
+		}
+		if run.GoldFidelity != nil {
+			summary.MeanGoldFidelity += run.GoldFidelity.Score
+			goldRuns++
+		}
+	}
+
+	if summary.Runs > 0 {
+		// Runs that errored count as failures
+		summary.SuccessRate = float64(summary.Successes) / float64(summary.Runs)
+	}
+	if completed > 0 {
+		summary.MeanScore /= float64(completed)
+		summary.MeanIterations /= float64(completed)
+		summary.MeanTokens /= float64(completed)
+	}
+	if queriesTotal > 0 {
+		summary.QueryPassRate = float64(queriesPassed) / float64(queriesTotal)
+	}
+	if fidelityRuns > 0 {
+		summary.MeanSchemaFidelity /= float64(fidelityRuns)
+	}
+	if goldRuns > 0 {
+		summary.MeanGoldFidelity /= float64(goldRuns)
+	}
+	return summary
+}
+
+// SaveBenchmarkResult writes a benchmark result to benchmark_results/<manifest>-<timestamp>.json
+// and returns the path
+func SaveBenchmarkResult(result *BenchmarkResult, basePath string) (string, error) {
+	dir := filepath.Join(basePath, "benchmark_results")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal benchmark result: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.json", result.Manifest, result.StartedAt.Format("20060102150405")))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write benchmark result: %w", err)
+	}
+	return path, nil
+}
+
+// PrintBenchmarkSummary prints the per-task and overall results as a table
+func PrintBenchmarkSummary(result *BenchmarkResult) {
+	fmt.Printf("\n=== BENCHMARK SUMMARY (%s) ===\n", result.Manifest)
+	fmt.Printf("Model: %s | Mode: %s | Time: %v\n\n", result.Model, result.Mode, result.Duration.Round(time.Second))
+	fmt.Printf("%-20s %5s %7s %9s %7s %7s %9s %8s\n", "Task", "Runs", "Errors", "Success", "Score", "Iters", "Tokens", "Queries")
+
+	printRow := func(name string, s BenchmarkSummary) {
+		fmt.Printf("%-20s %5d %7d %8.1f%% %7.3f %7.1f %9.0f %7.1f%%\n",
+			name, s.Runs, s.Errors, s.SuccessRate*100, s.MeanScore, s.MeanIterations, s.MeanTokens, s.QueryPassRate*100)
+	}
+	for _, task := range result.Tasks {
+		printRow(task.TaskID, task)
+	}
+	printRow("OVERALL", result.Overall)
+	fmt.Printf("\nMacro success rate (mean over tasks): %.1f%%\n", result.MacroSuccessRate*100)
+
+	for _, task := range result.Tasks {
+		if task.Gold == nil {
+			continue
+		}
+		fixture := "valid"
+		if !task.Gold.Valid() {
+			fixture = "INVALID"
+		}
+		fmt.Printf("Gold %s: fixture %s | Mean gold fidelity: %.3f\n", task.TaskID, fixture, task.MeanGoldFidelity)
+	}
+}
@@ -0,0 +1,148 @@
+package integration
+
+import (
+	"fmt"
+
+	"sql-parser/models"
+)
+
+const (
+	// Metrics used to rank iterations and candidates
+	MetricOverall   = "overall"
+	MetricParse     = "parse"
+	MetricExecution = "execution"
+	MetricErrors    = "errors"
+)
+
+// ValidScoreMetric reports whether metric is a known scoring metric
+func ValidScoreMetric(metric string) bool {
+	switch metric {
+	case MetricOverall, MetricParse, MetricExecution, MetricErrors:
+		return true
+	}
+	return false
+}
+
+// ScoreTestResult is the overall success rate of a test result: executed statements over total
+func ScoreTestResult(fr models.TestFileResult) float64 {
+	if fr.TotalStatements == 0 {
+		return 0
+	}
+	return float64(fr.ExecutedCount) / float64(fr.TotalStatements)
+}
+
+// ScoreTestResultBy scores a test result with the given metric, higher is better.
+// overall is executed/total, parse is parsed/total, execution is executed/parsed and
+// errors is the negated number of parse and execution errors. Offline results count the
+// statements that passed the semantic analysis as executed.
+func ScoreTestResultBy(metric string, fr models.TestFileResult) float64 {
+	if fr.Offline {
+		fr.ExecutedCount = fr.AnalyzedCount
+	}
+	switch metric {
+	case MetricParse:
+		if fr.TotalStatements == 0 {
+			return 0
+		}
+		return float64(fr.ParsedCount) / float64(fr.TotalStatements)
+	case MetricExecution:
+		if fr.ParsedCount == 0 {
+			return 0
+		}
+		return float64(fr.ExecutedCount) / float64(fr.ParsedCount)
+	case MetricErrors:
+		return -float64(len(fr.ParseErrors) + len(fr.ExecutionErrors))
+	}
+	return ScoreTestResult(fr)
+}
+
+// testSucceeded reports whether a test result has no parse or execution errors. Offline results
+// never succeed since none of their statements was executed.
+func testSucceeded(fr models.TestFileResult) bool {
+	return !fr.Offline && len(fr.ParseErrors) == 0 && len(fr.ExecutionErrors) == 0
+}
+
+// SetBestIteration selects the metric used to rank iterations and candidates, and whether the
+// conversation is rolled back to the best iteration when a new one regresses
+func (p *Pipeline) SetBestIteration(metric string, rollback bool) error {
+	if !ValidScoreMetric(metric) {
+		return fmt.Errorf("invalid score metric '%s'. Use 'overall', 'parse', 'execution' or 'errors'", metric)
+	}
+	p.scoreMetric = metric
+	p.rollbackOnRegression = rollback
+	return nil
+}
+
+// score applies the configured metric to a test result
+func (p *Pipeline) score(fr models.TestFileResult) float64 {
+	return ScoreTestResultBy(p.scoreMetric, fr)
+}
+
+// bestIteration returns the index of the best scoring iteration; ties keep the earliest one
+func (p *Pipeline) bestIteration(results []IterationResult) int {
+	best := -1
+	for i, result := range results {
+		if best == -1 || result.Score > results[best].Score {
+			best = i
+		}
+	}
+	return best
+}
+
+// latestBestIteration returns the index of the best scoring iteration; ties keep the latest one.
+// The conversation is rolled back to it, so the history ends with the iteration feedbackSource picks.
+func (p *Pipeline) latestBestIteration(results []IterationResult) int {
+	best := -1
+	for i, result := range results {
+		if best == -1 || result.Score >= results[best].Score {
+			best = i
+		}
+	}
+	return best
+}
+
+// feedbackSource returns the iteration the next feedback prompt is built from: the latest one
+// that was not rolled back
+func feedbackSource(results []IterationResult) IterationResult {
+	for i := len(results) - 1; i >= 0; i-- {
+		if !results[i].RolledBack {
+			return results[i]
+		}
+	}
+	return results[len(results)-1]
+}
+
+// rollbackIfRegressed marks the latest iteration as rolled back and restores the conversation to
+// the latest best iteration when the latest one scored lower. It returns whether a rollback happened.
+func (p *Pipeline) rollbackIfRegressed(state *iterativeState) (bool, error) {
+	if !p.rollbackOnRegression || len(state.iterationResults) < 2 {
+		return false, nil
+	}
+
+	latest := &state.iterationResults[len(state.iterationResults)-1]
+	best := state.iterationResults[p.latestBestIteration(state.iterationResults[:len(state.iterationResults)-1])]
+	if latest.Score >= best.Score {
+		return false, nil
+	}
+
+	if err := p.sessionMgr.RollbackTo(state.session.ID, best.HistoryLength, best.ResponseID); err != nil {
+		return false, fmt.Errorf("failed to roll back to iteration %d: %w", best.Iteration, err)
+	}
+	latest.RolledBack = true
+	fmt.Printf("  └─ Iteration %d regressed (%.3f < %.3f), rolled back to iteration %d\n",
+		latest.Iteration, latest.Score, best.Score, best.Iteration)
+	return true, nil
+}
+
+// applyBestIteration fills the best iteration fields of a result
+func (p *Pipeline) applyBestIteration(result *PipelineResult) {
+	best := p.bestIteration(result.IterationResults)
+	if best == -1 {
+		return
+	}
+	bestResult := result.IterationResults[best]
+	result.BestIteration = bestResult.Iteration
+	result.BestGeneratedSQL = bestResult.GeneratedSQL
+	result.BestTestResults = bestResult.TestResults
+	result.BestSuccess = bestResult.Success
+}
@@ -0,0 +1,83 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// iterationsScoring builds iteration results with the given scores, each answer adding a
+// prompt and a response to the history
+func iterationsScoring(scores ...float64) []IterationResult {
+	results := make([]IterationResult, len(scores))
+	for i, score := range scores {
+		results[i] = IterationResult{
+			Iteration:     i + 1,
+			Score:         score,
+			HistoryLength: 2 * (i + 1),
+			ResponseID:    "resp_" + string(rune('a'+i)),
+		}
+	}
+	return results
+}
+
+func TestBestIterationTies(t *testing.T) {
+	p := &Pipeline{}
+
+	assert.Equal(t, -1, p.bestIteration(nil))
+	assert.Equal(t, -1, p.latestBestIteration(nil))
+
+	results := iterationsScoring(0.2, 0.5, 0.5, 0.3)
+	assert.Equal(t, 1, p.bestIteration(results))
+	assert.Equal(t, 2, p.latestBestIteration(results))
+}
+
+func TestFeedbackSource(t *testing.T) {
+	results := iterationsScoring(0.5, 0.5, 0.1)
+	assert.Equal(t, 3, feedbackSource(results).Iteration)
+
+	results[2].RolledBack = true
+	assert.Equal(t, 2, feedbackSource(results).Iteration)
+}
+
+// TestRollbackIfRegressedTies checks that after a rollback the history ends with the iteration the
+// next feedback is built from, also when several iterations share the best score
+func TestRollbackIfRegressedTies(t *testing.T) {
+	tests := []struct {
+		name       string
+		scores     []float64
+		rolledBack bool
+		restoredTo int
+	}{
+		{name: "tie on the best score", scores: []float64{0.5, 0.5, 0.2}, rolledBack: true, restoredTo: 2},
+		{name: "best after a tie", scores: []float64{0.8, 0.8, 0.9, 0.4}, rolledBack: true, restoredTo: 3},
+		{name: "latest matches the best", scores: []float64{0.5, 0.5}, rolledBack: false, restoredTo: 2},
+		{name: "improvement", scores: []float64{0.2, 0.6}, rolledBack: false, restoredTo: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := NewSessionManager(nil)
+			history := make([]ConversationMessage, 2*len(tt.scores))
+			for i := range history {
+				history[i] = ConversationMessage{Role: []string{"user", "assistant"}[i%2], Content: "turn"}
+			}
+			session := sm.RestoreSession(ConversationSession{ID: "s", Mode: ConversationModeLocal}, history)
+
+			p := &Pipeline{sessionMgr: sm, rollbackOnRegression: true}
+			state := &iterativeState{session: session, iterationResults: iterationsScoring(tt.scores...)}
+
+			rolledBack, err := p.rollbackIfRegressed(state)
+			require.NoError(t, err)
+			assert.Equal(t, tt.rolledBack, rolledBack)
+
+			source := feedbackSource(state.iterationResults)
+			assert.Equal(t, tt.restoredTo, source.Iteration)
+			assert.Len(t, sm.messages["s"], source.HistoryLength)
+			if tt.rolledBack {
+				assert.Equal(t, source.ResponseID, session.LastResponseID)
+			}
+		})
+	}
+}
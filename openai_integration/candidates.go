@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"fmt"
+
+	"sql-parser/models"
+)
+
+// CandidateScore records the evaluation of one of the candidate translations sampled for a turn
+type CandidateScore struct {
+	Index           int     `json:"index"`
+	Score           float64 `json:"score"`
+	Success         bool    `json:"success"`
+	TotalStatements int     `json:"total_statements"`
+	ParsedCount     int     `json:"parsed_count"`
+	ExecutedCount   int     `json:"executed_count"`
+	ParseErrors     int     `json:"parse_errors"`
+	ExecutionErrors int     `json:"execution_errors"`
+	FinishReason    string  `json:"finish_reason,omitempty"`
+	Chosen          bool    `json:"chosen"`
+}
+
+// candidateOutcome is the best candidate of a turn, already evaluated
+type candidateOutcome struct {
+	sql        string
+	testResult models.TestFileResult
+	truncation *TruncationInfo
+	extraction *ExtractionInfo
+	scores     []CandidateScore
+}
+
+// SetCandidates makes every turn sample n candidate translations and continue with the best one
+func (p *Pipeline) SetCandidates(n int) {
+	p.candidates = n
+}
+
+// requestCandidates sends a prompt, samples p.candidates answers, evaluates each of them and
+// keeps the best scoring one in the conversation. Truncated candidates are not continued and
+// structured responses are not re-asked; they are scored as they are.
+func (p *Pipeline) requestCandidates(sessionID, prompt, label string) (*candidateOutcome, error) {
+	responses, err := p.sessionMgr.SendMessageCandidates(sessionID, prompt, p.candidates)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("  └─ Evaluating %d candidates...\n", len(responses))
+
+	var best *candidateOutcome
+	bestIndex := -1
+	scores := make([]CandidateScore, 0, len(responses))
+	for i, response := range responses {
+		p.savePromptToDebugFile(fmt.Sprintf("AI CANDIDATE %d (%s)", i+1, label), response.Content)
+
+		sql, extraction := p.extractCandidateSQL(response.Content)
+		testResult, err := p.testSQLString(sql)
+		if err != nil {
+			return nil, fmt.Errorf("failed to test candidate %d: %w", i+1, err)
+		}
+
+		score := CandidateScore{
+			Index:           i,
+			Score:           p.score(testResult),
+			Success:         testSucceeded(testResult),
+			TotalStatements: testResult.TotalStatements,
+			ParsedCount:     testResult.ParsedCount,
+			ExecutedCount:   testResult.ExecutedCount,
+			ParseErrors:     len(testResult.ParseErrors),
+			ExecutionErrors: len(testResult.ExecutionErrors),
+			FinishReason:    response.FinishReason,
+		}
+		scores = append(scores, score)
+		fmt.Printf("  └─ Candidate %d: score %.3f (%d parse errors, %d execution errors)\n",
+			i+1, score.Score, score.ParseErrors, score.ExecutionErrors)
+
+		if best == nil || score.Score > scores[bestIndex].Score {
+			var truncation *TruncationInfo
+			if response.FinishReason == FinishReasonLength {
+				truncation = &TruncationInfo{Truncated: true, FinishReasons: []string{response.FinishReason}}
+			}
+			best = &candidateOutcome{sql: sql, testResult: testResult, truncation: truncation, extraction: extraction}
+			bestIndex = i
+		}
+	}
+
+	scores[bestIndex].Chosen = true
+	best.scores = scores
+	fmt.Printf("  └─ Continuing with candidate %d\n", bestIndex+1)
+
+	if err := p.sessionMgr.AcceptCandidate(sessionID, responses[bestIndex]); err != nil {
+		return nil, err
+	}
+	return best, nil
+}
+
+// extractCandidateSQL extracts the SQL of a candidate without asking the model again
+func (p *Pipeline) extractCandidateSQL(response string) (string, *ExtractionInfo) {
+	if p.structuredOutput {
+		structured, err := ParseStructuredSQLResponse(response)
+		if err == nil {
+			return structured.Script(), &ExtractionInfo{Method: ExtractionStructured, Statements: structured.Statements}
+		}
+		sql, warnings := p.promptReader.ExtractSQLWithWarnings(response)
+		return sql, &ExtractionInfo{Method: ExtractionFencedBlock, ValidationErrors: []string{err.Error()}, Warnings: warnings}
+	}
+
+	sql, warnings := p.promptReader.ExtractSQLWithWarnings(response)
+	return sql, &ExtractionInfo{Method: ExtractionFencedBlock, Warnings: warnings}
+}
@@ -0,0 +1,483 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sql-parser/tools"
+)
+
+// Experiment is a grid of pipeline parameters run on a set of tasks, each combination repeated
+// a number of times. Parameter names are the keys of experimentParameters.
+type Experiment struct {
+	Name string `json:"name"`
+	// Benchmark is a manifest path relative to the experiment file; without it prompt.txt is the only task
+	Benchmark   string                       `json:"benchmark,omitempty"`
+	Tasks       []string                     `json:"tasks,omitempty"`
+	Repetitions int                          `json:"repetitions"`
+	Base        map[string]json.RawMessage   `json:"base,omitempty"`
+	Grid        map[string][]json.RawMessage `json:"grid"`
+
+	manifest *BenchmarkManifest
+}
+
+// ExperimentTag identifies the experiment cell and repetition a run belongs to
+type ExperimentTag struct {
+	Experiment string `json:"experiment"`
+	Cell       string `json:"cell"`
+	Repetition int    `json:"repetition"`
+}
+
+// ExperimentCell is one combination of grid values
+type ExperimentCell struct {
+	Label  string
+	Params map[string]json.RawMessage
+}
+
+type experimentParameter func(config *PipelineConfig, value json.RawMessage) error
+
+func stringParameter(set func(*PipelineConfig, string)) experimentParameter {
+	return func(config *PipelineConfig, value json.RawMessage) error {
+		var v string
+		if err := json.Unmarshal(value, &v); err != nil {
+			return err
+		}
+		set(config, v)
+		return nil
+	}
+}
+
+func intParameter(set func(*PipelineConfig, int)) experimentParameter {
+	return func(config *PipelineConfig, value json.RawMessage) error {
+		var v int
+		if err := json.Unmarshal(value, &v); err != nil {
+			return err
+		}
+		set(config, v)
+		return nil
+	}
+}
+
+func boolParameter(set func(*PipelineConfig, bool)) experimentParameter {
+	return func(config *PipelineConfig, value json.RawMessage) error {
+		var v bool
+		if err := json.Unmarshal(value, &v); err != nil {
+			return err
+		}
+		set(config, v)
+		return nil
+	}
+}
+
+// experimentParameters maps the parameter names of experiment files to PipelineConfig fields,
+// using the names of the command line flags
+var experimentParameters = map[string]experimentParameter{
+	"mode":              stringParameter(func(c *PipelineConfig, v string) { c.Mode = v }),
+	"model":             stringParameter(func(c *PipelineConfig, v string) { c.Model = v }),
+	"iterations":        intParameter(func(c *PipelineConfig, v int) { c.MaxIterations = v }),
+	"short-prompts":     boolParameter(func(c *PipelineConfig, v bool) { c.ShortPrompts = v }),
+	"more-context":      boolParameter(func(c *PipelineConfig, v bool) { c.MoreContextEnabled = v }),
+	"structured-output": boolParameter(func(c *PipelineConfig, v bool) { c.StructuredOutput = v }),
+	"conversation-mode": stringParameter(func(c *PipelineConfig, v string) { c.ConversationMode = v }),
+	"reasoning-effort":  stringParameter(func(c *PipelineConfig, v string) { c.ReasoningEffort = v }),
+	"history-strategy":  stringParameter(func(c *PipelineConfig, v string) { c.HistoryStrategy = v }),
+	"history-turns":     intParameter(func(c *PipelineConfig, v int) { c.HistoryTurns = v }),
+	"prompt-templates":  stringParameter(func(c *PipelineConfig, v string) { c.PromptTemplates = v }),
+	"shots":             intParameter(func(c *PipelineConfig, v int) { c.Shots = v }),
+	"shot-strategy":     stringParameter(func(c *PipelineConfig, v string) { c.ShotStrategy = v }),
+	"candidates":        intParameter(func(c *PipelineConfig, v int) { c.Candidates = v }),
+	"score-metric":      stringParameter(func(c *PipelineConfig, v string) { c.ScoreMetric = v }),
+	"rollback":          boolParameter(func(c *PipelineConfig, v bool) { c.RollbackOnRegression = v }),
+	"feedback":          stringParameter(func(c *PipelineConfig, v string) { c.FeedbackStrategy = v }),
+	"guidelines":        stringParameter(func(c *PipelineConfig, v string) { c.GuidelineMode = v }),
+	"dialect":           stringParameter(func(c *PipelineConfig, v string) { c.TargetDialect = v }),
+	"semantic-check":    stringParameter(func(c *PipelineConfig, v string) { c.SemanticCheck = v }),
+	"max-continuations": intParameter(func(c *PipelineConfig, v int) { c.MaxContinuations = v }),
+	"tool-budget":       intParameter(func(c *PipelineConfig, v int) { c.ToolBudget = v }),
+	"token-budget":      intParameter(func(c *PipelineConfig, v int) { c.StopPolicy.TokenBudget = v }),
+}
+
+// LoadExperiment reads an experiment file and the benchmark manifest it refers to
+func LoadExperiment(path string) (*Experiment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read experiment %s: %w", path, err)
+	}
+
+	var experiment Experiment
+	if err := json.Unmarshal(data, &experiment); err != nil {
+		return nil, fmt.Errorf("failed to parse experiment %s: %w", path, err)
+	}
+	if experiment.Name == "" {
+		return nil, fmt.Errorf("experiment %s must have a name", path)
+	}
+	if experiment.Repetitions <= 0 {
+		experiment.Repetitions = 1
+	}
+
+	for name, value := range experiment.Base {
+		if err := applyExperimentParameter(&PipelineConfig{}, name, value); err != nil {
+			return nil, err
+		}
+	}
+	for name, values := range experiment.Grid {
+		if len(values) == 0 {
+			return nil, fmt.Errorf("grid parameter '%s' has no values", name)
+		}
+		for _, value := range values {
+			if err := applyExperimentParameter(&PipelineConfig{}, name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if experiment.Benchmark != "" {
+		manifest, err := LoadBenchmarkManifest(filepath.Join(filepath.Dir(path), experiment.Benchmark))
+		if err != nil {
+			return nil, err
+		}
+		if err := manifest.Select(experiment.Tasks); err != nil {
+			return nil, err
+		}
+		experiment.manifest = manifest
+	} else if len(experiment.Tasks) > 0 {
+		return nil, fmt.Errorf("experiment %s selects tasks but has no benchmark", path)
+	}
+
+	return &experiment, nil
+}
+
+func applyExperimentParameter(config *PipelineConfig, name string, value json.RawMessage) error {
+	set, ok := experimentParameters[name]
+	if !ok {
+		return fmt.Errorf("unknown experiment parameter '%s'", name)
+	}
+	if err := set(config, value); err != nil {
+		return fmt.Errorf("invalid value %s for experiment parameter '%s': %w", value, name, err)
+	}
+	return nil
+}
+
+// Cells expands the grid into every combination of values, in a stable order
+func (e *Experiment) Cells() []ExperimentCell {
+	names := make([]string, 0, len(e.Grid))
+	for name := range e.Grid {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cells := []ExperimentCell{{Params: map[string]json.RawMessage{}}}
+	for _, name := range names {
+		var expanded []ExperimentCell
+		for _, cell := range cells {
+			for _, value := range e.Grid[name] {
+				params := make(map[string]json.RawMessage, len(cell.Params)+1)
+				for k, v := range cell.Params {
+					params[k] = v
+				}
+				params[name] = value
+				expanded = append(expanded, ExperimentCell{Params: params})
+			}
+		}
+		cells = expanded
+	}
+
+	for i := range cells {
+		parts := make([]string, 0, len(names))
+		for _, name := range names {
+			parts = append(parts, name+"="+strings.Trim(string(cells[i].Params[name]), `"`))
+		}
+		cells[i].Label = strings.Join(parts, " ")
+	}
+	return cells
+}
+
+// experimentJob is one pipeline run still to be done
+type experimentJob struct {
+	cell   ExperimentCell
+	task   *BenchmarkTask
+	tag    ExperimentTag
+	config PipelineConfig
+}
+
+// ExperimentRunner schedules the runs of an experiment that are not in pipeline_results.json yet
+type ExperimentRunner struct {
+	experiment  *Experiment
+	config      PipelineConfig
+	basePath    string
+	concurrency int
+}
+
+// NewExperimentRunner creates a runner applying the experiment parameters on top of config
+func NewExperimentRunner(experiment *Experiment, config PipelineConfig, basePath string) *ExperimentRunner {
+	return &ExperimentRunner{
+		experiment:  experiment,
+		config:      config,
+		basePath:    basePath,
+		concurrency: 1,
+	}
+}
+
+// SetConcurrency sets how many pipeline runs execute at the same time
+func (er *ExperimentRunner) SetConcurrency(concurrency int) {
+	if concurrency > 0 {
+		er.concurrency = concurrency
+	}
+}
+
+// completedRuns returns the repetitions of this experiment already in pipeline_results.json per
+// cell and task
+func (er *ExperimentRunner) completedRuns() (map[string]map[int]bool, *AccumulatedResults, error) {
+	accumulated, err := LoadAccumulatedResults(filepath.Join(er.basePath, "pipeline_results.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	completed := make(map[string]map[int]bool)
+	for _, metrics := range accumulated.Executions {
+		if metrics.Experiment == nil || metrics.Experiment.Experiment != er.experiment.Name {
+			continue
+		}
+		key := experimentKey(metrics.Experiment.Cell, metrics.TaskID)
+		if completed[key] == nil {
+			completed[key] = make(map[int]bool)
+		}
+		completed[key][metrics.Experiment.Repetition] = true
+	}
+	return completed, accumulated, nil
+}
+
+func experimentKey(cell, taskID string) string {
+	return cell + "|" + taskID
+}
+
+// jobs lists the runs missing from pipeline_results.json
+func (er *ExperimentRunner) jobs() ([]experimentJob, int, error) {
+	completed, _, err := er.completedRuns()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	base := er.config
+	for name, value := range er.experiment.Base {
+		if err := applyExperimentParameter(&base, name, value); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var tasks []*BenchmarkTask
+	if er.experiment.manifest != nil {
+		for i := range er.experiment.manifest.Tasks {
+			tasks = append(tasks, &er.experiment.manifest.Tasks[i])
+		}
+	} else {
+		tasks = []*BenchmarkTask{nil}
+	}
+
+	var jobs []experimentJob
+	skipped := 0
+	for _, cell := range er.experiment.Cells() {
+		config := base
+		for name, value := range cell.Params {
+			if err := applyExperimentParameter(&config, name, value); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		for _, task := range tasks {
+			taskID := ""
+			if task != nil {
+				taskID = task.ID
+			}
+			done := completed[experimentKey(cell.Label, taskID)]
+			for repetition := 1; repetition <= er.experiment.Repetitions; repetition++ {
+				if done[repetition] {
+					skipped++
+					continue
+				}
+				jobs = append(jobs, experimentJob{
+					cell:   cell,
+					task:   task,
+					tag:    ExperimentTag{Experiment: er.experiment.Name, Cell: cell.Label, Repetition: repetition},
+					config: config,
+				})
+			}
+		}
+	}
+	return jobs, skipped, nil
+}
+
+// Run executes the missing runs and returns the summary of every cell. Each run is saved to
+// pipeline_results.json as soon as it completes, so an interrupted experiment resumes where it
+// stopped when run again.
+func (er *ExperimentRunner) Run() ([]ExperimentCellSummary, error) {
+	jobs, skipped, err := er.jobs()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Experiment %s: %d cell(s), %d run(s) to do, %d already completed\n",
+		er.experiment.Name, len(er.experiment.Cells()), len(jobs), skipped)
+
+	instructions := ""
+	if er.experiment.manifest != nil {
+		instructions = er.experiment.manifest.Instructions
+		if instructions == "" {
+			prompt, err := NewPromptReader(er.basePath).ReadPromptFile()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read default instructions: %w", err)
+			}
+			instructions, _ = tools.SplitPrompt(prompt)
+		}
+	}
+
+	var mu sync.Mutex
+	done := 0
+
+	pool := NewWorkerPool(er.concurrency)
+	pool.SetLimiter(er.config.Limiter)
+	stats := pool.Run(len(jobs), func(index int) error {
+		job := jobs[index]
+		config := job.config
+		tag := job.tag
+		config.Experiment = &tag
+		config.SaveAccumulated = true
+		config.UniqueID = fmt.Sprintf("%s-%d", er.experiment.Name, index+1)
+		taskID := "prompt.txt"
+		if job.task != nil {
+			taskID = job.task.ID
+			config.TaskID = job.task.ID
+			config.Prompt = job.task.Prompt(instructions)
+			config.ExpectedResults = job.task.ExpectedResults
+		}
+
+		result, _, err := NewPipelineRunner(config, er.basePath).RunWithResults()
+
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		status := "FAILED"
+		switch {
+		case err != nil:
+			status = "ERROR: " + err.Error()
+		case result.Success:
+			status = "SUCCESS"
+		}
+		fmt.Printf("[%d/%d] %s | %s | rep %d: %s\n", done, len(jobs), job.cell.Label, taskID, job.tag.Repetition, status)
+		return err
+	})
+
+	if missing := stats.Failed + stats.Skipped; missing > 0 {
+		fmt.Printf("%d run(s) failed or were skipped and will be retried the next time the experiment runs\n", missing)
+	}
+	return er.Summary()
+}
+
+// ExperimentCellSummary aggregates the completed runs of one cell over all tasks and repetitions
+type ExperimentCellSummary struct {
+	Cell           string  `json:"cell"`
+	Runs           int     `json:"runs"`
+	Successes      int     `json:"successes"`
+	SuccessRate    float64 `json:"success_rate"`
+	MeanScore      float64 `json:"mean_score"`
+	MeanIterations float64 `json:"mean_iterations"`
+	MeanTokens     float64 `json:"mean_tokens"`
+	TotalCostUSD   float64 `json:"total_cost_usd"`
+	QueryPassRate  float64 `json:"query_pass_rate"`
+	// MeanSchemaFidelity averages the schema fidelity scores of the runs that have one
+	MeanSchemaFidelity float64 `json:"mean_schema_fidelity,omitempty"`
+}
+
+// Summary aggregates the runs of the experiment found in pipeline_results.json per cell
+func (er *ExperimentRunner) Summary() ([]ExperimentCellSummary, error) {
+	_, accumulated, err := er.completedRuns()
+	if err != nil {
+		return nil, err
+	}
+
+	byCell := make(map[string][]*ExecutionMetrics)
+	for _, metrics := range accumulated.Executions {
+		if metrics.Experiment != nil && metrics.Experiment.Experiment == er.experiment.Name {
+			byCell[metrics.Experiment.Cell] = append(byCell[metrics.Experiment.Cell], metrics)
+		}
+	}
+
+	var summaries []ExperimentCellSummary
+	for _, cell := range er.experiment.Cells() {
+		runs := byCell[cell.Label]
+		summary := ExperimentCellSummary{Cell: cell.Label, Runs: len(runs)}
+		queriesPassed, queriesTotal := 0, 0
+		fidelityRuns := 0
+		for _, metrics := range runs {
+			if metrics.Success {
+				summary.Successes++
+			}
+			summary.MeanScore += metrics.FinalScore
+			summary.MeanIterations += float64(metrics.TotalIterations)
+			summary.MeanTokens += float64(metrics.TokensUsed)
+			summary.TotalCostUSD += metrics.EstimatedCostUSD
+			queriesPassed += metrics.QueriesPassed
+			queriesTotal += metrics.QueriesTotal
+			if metrics.SchemaFidelity != nil {
+				summary.MeanSchemaFidelity += metrics.SchemaFidelity.Score
+				fidelityRuns++
+			}
+		}
+		if len(runs) > 0 {
+			summary.SuccessRate = float64(summary.Successes) / float64(len(runs))
+			summary.MeanScore /= float64(len(runs))
+			summary.MeanIterations /= float64(len(runs))
+			summary.MeanTokens /= float64(len(runs))
+		}
+		if queriesTotal > 0 {
+			summary.QueryPassRate = float64(queriesPassed) / float64(queriesTotal)
+		}
+		if fidelityRuns > 0 {
+			summary.MeanSchemaFidelity /= float64(fidelityRuns)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// SaveExperimentSummary writes the cell summaries to experiment_results/<name>.json and returns the path
+func SaveExperimentSummary(name string, summaries []ExperimentCellSummary, basePath string) (string, error) {
+	dir := filepath.Join(basePath, "experiment_results")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Experiment string                  `json:"experiment"`
+		UpdatedAt  time.Time               `json:"updated_at"`
+		Cells      []ExperimentCellSummary `json:"cells"`
+	}{name, time.Now(), summaries}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal experiment summary: %w", err)
+	}
+
+	path := filepath.Join(dir, name+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write experiment summary: %w", err)
+	}
+	return path, nil
+}
+
+// PrintExperimentSummary prints one row per cell
+func PrintExperimentSummary(name string, summaries []ExperimentCellSummary) {
+	width := len("Cell")
+	for _, summary := range summaries {
+		width = max(width, len(summary.Cell))
+	}
+
+	fmt.Printf("\n=== EXPERIMENT SUMMARY (%s) ===\n", name)
+	fmt.Printf("%-*s %5s %9s %7s %7s %9s %9s %8s\n", width, "Cell", "Runs", "Success", "Score", "Iters", "Tokens", "Cost", "Queries")
+	for _, s := range summaries {
+		fmt.Printf("%-*s %5d %8.1f%% %7.3f %7.1f %9.0f %8.4f$ %7.1f%%\n",
+			width, s.Cell, s.Runs, s.SuccessRate*100, s.MeanScore, s.MeanIterations, s.MeanTokens, s.TotalCostUSD, s.QueryPassRate*100)
+	}
+}
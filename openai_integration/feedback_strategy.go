@@ -0,0 +1,256 @@
+package integration
+
+import (
+	"fmt"
+	"strings"
+
+	"sql-parser/models"
+	"sql-parser/tools"
+)
+
+// Feedback strategies selectable with --feedback
+const (
+	FeedbackFull          = "full"
+	FeedbackErrorsOnly    = "errors-only"
+	FeedbackAnnotatedSQL  = "annotated-sql"
+	FeedbackCategoryHints = "category-hints"
+	FeedbackGuidelines    = "guidelines"
+	FeedbackFixList       = "fix-list"
+)
+
+// feedbackClosing asks for the whole script again, so extraction always sees a complete translation
+const feedbackClosing = "Reply with the entire corrected SQL script."
+
+// FeedbackContext is everything a feedback strategy can use to describe an iteration's results
+type FeedbackContext struct {
+	SQL           string
+	TestResults   models.TestFileResult
+	TargetDialect string
+	ShortPrompts  bool
+	Templates     *PromptTemplates
+	// Guidelines holds the guideline sections retrieved for the observed error categories
+	Guidelines []GuidelineSection
+}
+
+// FeedbackStrategy builds the repair prompt sent after a failed iteration
+type FeedbackStrategy interface {
+	Name() string
+	Feedback(ctx FeedbackContext) (string, error)
+}
+
+// NewFeedbackStrategy returns the strategy with the given name
+func NewFeedbackStrategy(name string) (FeedbackStrategy, error) {
+	switch name {
+	case "", FeedbackFull:
+		return templateFeedback{}, nil
+	case FeedbackErrorsOnly:
+		return errorsOnlyFeedback{}, nil
+	case FeedbackAnnotatedSQL:
+		return annotatedSQLFeedback{}, nil
+	case FeedbackCategoryHints:
+		return categoryHintsFeedback{}, nil
+	case FeedbackGuidelines:
+		return guidelineFeedback{}, nil
+	case FeedbackFixList:
+		return fixListFeedback{}, nil
+	}
+	return nil, fmt.Errorf("invalid feedback strategy '%s'. Use 'full', 'errors-only', 'annotated-sql', 'category-hints', 'guidelines' or 'fix-list'", name)
+}
+
+// SetFeedbackStrategy selects how test results are reported back to the model
+func (p *Pipeline) SetFeedbackStrategy(strategy FeedbackStrategy) {
+	p.feedback = strategy
+}
+
+// templateFeedback renders feedback.tmpl of the selected template set, the original full report
+type templateFeedback struct{}
+
+func (templateFeedback) Name() string { return FeedbackFull }
+
+func (templateFeedback) Feedback(ctx FeedbackContext) (string, error) {
+	return ctx.Templates.RenderFeedback(NewFeedbackData(ctx.TestResults, ctx.TargetDialect, ctx.ShortPrompts))
+}
+
+// errorsOnlyFeedback lists the raw errors without summaries or recommendations
+type errorsOnlyFeedback struct{}
+
+func (errorsOnlyFeedback) Name() string { return FeedbackErrorsOnly }
+
+func (errorsOnlyFeedback) Feedback(ctx FeedbackContext) (string, error) {
+	fr := ctx.TestResults
+	var out strings.Builder
+	out.WriteString("The generated SQL produced the following errors:\n")
+
+	for _, e := range fr.ParseErrorDetails {
+		fmt.Fprintf(&out, "\n- Parse error: %s\n  Statement: %s\n", e.Error, statementExcerpt(e.Statement, ctx.ShortPrompts))
+	}
+	for _, e := range fr.ExecutionErrors {
+		fmt.Fprintf(&out, "\n- Execution error: %s\n", e)
+	}
+
+	out.WriteString("\n" + feedbackClosing + "\n")
+	return out.String(), nil
+}
+
+// annotatedSQLFeedback returns the script itself with the errors of each statement inline
+type annotatedSQLFeedback struct{}
+
+func (annotatedSQLFeedback) Name() string { return FeedbackAnnotatedSQL }
+
+func (annotatedSQLFeedback) Feedback(ctx FeedbackContext) (string, error) {
+	var statements []string
+	if ctx.TargetDialect == TargetDialectPostgreSQL {
+		statements = tools.ExtractPostgresStatements(ctx.SQL)
+	} else {
+		var err error
+		statements, err = tools.ExtractStatementsFromString(ctx.SQL)
+		if err != nil {
+			return "", fmt.Errorf("failed to split SQL for annotation: %w", err)
+		}
+	}
+
+	errorsByStatement := make(map[string][]string)
+	for _, e := range ctx.TestResults.ParseErrorDetails {
+		key := strings.TrimSpace(e.Statement)
+		errorsByStatement[key] = append(errorsByStatement[key], "PARSE ERROR: "+firstLine(e.Error))
+	}
+	for _, e := range ctx.TestResults.ExecutionErrorDetails {
+		key := strings.TrimSpace(e.Statement)
+		errorsByStatement[key] = append(errorsByStatement[key], "EXECUTION ERROR: "+firstLine(e.Description))
+	}
+
+	var out strings.Builder
+	out.WriteString("This is your previous SQL. Statements that failed are followed by comments starting with -- ERROR:\n\n```sql\n")
+	for _, stmt := range statements {
+		stmt = strings.TrimSpace(stmt)
+		out.WriteString(strings.TrimSuffix(stmt, ";") + ";\n")
+		for _, e := range errorsByStatement[stmt] {
+			fmt.Fprintf(&out, "-- ERROR: %s\n", e)
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("```\n")
+
+	if unmatched := unmatchedErrors(ctx.TestResults, statements); len(unmatched) > 0 {
+		out.WriteString("\nOther errors:\n")
+		for _, e := range unmatched {
+			fmt.Fprintf(&out, "- %s\n", e)
+		}
+	}
+
+	out.WriteString("\nFix the annotated statements. " + feedbackClosing + "\n")
+	return out.String(), nil
+}
+
+// unmatchedErrors returns the errors that cannot be placed next to one of statements, e.g.
+// because the executor reported them without the failing statement
+func unmatchedErrors(fr models.TestFileResult, statements []string) []string {
+	known := make(map[string]bool, len(statements))
+	for _, stmt := range statements {
+		known[strings.TrimSpace(stmt)] = true
+	}
+
+	var unmatched []string
+	for _, e := range fr.ParseErrorDetails {
+		if !known[strings.TrimSpace(e.Statement)] {
+			unmatched = append(unmatched, e.Error)
+		}
+	}
+	for _, e := range fr.ExecutionErrorDetails {
+		if !known[strings.TrimSpace(e.Statement)] {
+			unmatched = append(unmatched, e.Description)
+		}
+	}
+	if len(fr.ExecutionErrorDetails) < len(fr.ExecutionErrors) {
+		unmatched = append(unmatched, fr.ExecutionErrors[len(fr.ExecutionErrorDetails):]...)
+	}
+	return unmatched
+}
+
+// categoryHintsFeedback names the error categories and their descriptions, without raw errors
+type categoryHintsFeedback struct{}
+
+func (categoryHintsFeedback) Name() string { return FeedbackCategoryHints }
+
+func (categoryHintsFeedback) Feedback(ctx FeedbackContext) (string, error) {
+	data := NewFeedbackData(ctx.TestResults, ctx.TargetDialect, ctx.ShortPrompts)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "The generated SQL still has %d parse errors and %d execution errors, in these categories:\n\n",
+		data.ParseErrorCount, data.ExecutionErrorCount)
+	for _, group := range [][]ErrorSummary{data.ParseErrorSummary, data.ErrorCategorySummary} {
+		for _, summary := range group {
+			fmt.Fprintf(&out, "- %s (x%d): %s\n", summary.Name, summary.Count, summary.Description)
+		}
+	}
+
+	out.WriteString("\n" + feedbackClosing + "\n")
+	return out.String(), nil
+}
+
+// guidelineFeedback lists the errors together with the guideline sections retrieved for their
+// categories, see RetrieveGuidelines
+type guidelineFeedback struct{}
+
+func (guidelineFeedback) Name() string { return FeedbackGuidelines }
+
+func (guidelineFeedback) Feedback(ctx FeedbackContext) (string, error) {
+	errorsOnly, err := errorsOnlyFeedback{}.Feedback(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(ctx.Guidelines) == 0 {
+		return errorsOnly, nil
+	}
+
+	var out strings.Builder
+	out.WriteString(strings.TrimSuffix(errorsOnly, feedbackClosing+"\n"))
+	out.WriteString("Relevant guidelines:\n\n")
+	out.WriteString(formatGuidelineSections(ctx.Guidelines))
+	out.WriteString("\n\n" + feedbackClosing + "\n")
+	return out.String(), nil
+}
+
+// fixListFeedback turns the FIX hints of the error taxonomy into a numbered list of changes
+type fixListFeedback struct{}
+
+func (fixListFeedback) Name() string { return FeedbackFixList }
+
+func (fixListFeedback) Feedback(ctx FeedbackContext) (string, error) {
+	data := NewFeedbackData(ctx.TestResults, ctx.TargetDialect, ctx.ShortPrompts)
+
+	var fixes []string
+	seen := make(map[string]bool)
+	for _, group := range [][]ErrorSummary{data.ParseErrorSummary, data.ErrorCategorySummary, data.ErrorCodeSummary} {
+		for _, summary := range group {
+			fix := fixHint(summary.Description)
+			if fix == "" || seen[fix] {
+				continue
+			}
+			seen[fix] = true
+			fixes = append(fixes, fmt.Sprintf("%s (%s, x%d)", fix, summary.Name, summary.Count))
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "The generated SQL has %d parse errors and %d execution errors. Apply these fixes:\n\n",
+		data.ParseErrorCount, data.ExecutionErrorCount)
+	for i, fix := range fixes {
+		fmt.Fprintf(&out, "%d. %s\n", i+1, fix)
+	}
+	if len(fixes) == 0 {
+		out.WriteString("No specific fix is known for these errors, review the failing statements.\n")
+	}
+
+	out.WriteString("\n" + feedbackClosing + "\n")
+	return out.String(), nil
+}
+
+// fixHint returns the part of a taxonomy description after "FIX:"
+func fixHint(description string) string {
+	_, fix, found := strings.Cut(description, "FIX:")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(fix)
+}
@@ -0,0 +1,188 @@
+package integration
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Few-shot selection strategies
+	ShotStrategyFixed   = "fixed"
+	ShotStrategyRandom  = "random"
+	ShotStrategySimilar = "similar"
+)
+
+//go:embed examples/few_shot_examples.json
+var embeddedFewShotExamples []byte
+
+// FewShotExample is a curated PostgreSQL input with its correct Spanner translation
+type FewShotExample struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Postgres    string `json:"postgres"`
+	Spanner     string `json:"spanner"`
+	Explanation string `json:"explanation,omitempty"`
+}
+
+// FewShotSelection records which examples were added to the initial prompt and how they were chosen
+type FewShotSelection struct {
+	Strategy string   `json:"strategy"`
+	Seed     int64    `json:"seed,omitempty"`
+	Examples []string `json:"examples"`
+}
+
+// ExampleStore holds the few-shot examples available to the pipeline
+type ExampleStore struct {
+	examples []FewShotExample
+}
+
+// LoadExampleStore loads the examples from path, or the embedded examples when path is empty
+func LoadExampleStore(path string) (*ExampleStore, error) {
+	data := embeddedFewShotExamples
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read examples file %s: %w", path, err)
+		}
+	}
+
+	var examples []FewShotExample
+	if err := json.Unmarshal(data, &examples); err != nil {
+		return nil, fmt.Errorf("failed to parse examples: %w", err)
+	}
+	for i, example := range examples {
+		if example.ID == "" || example.Postgres == "" || example.Spanner == "" {
+			return nil, fmt.Errorf("example %d must have an id, postgres and spanner code", i+1)
+		}
+	}
+
+	return &ExampleStore{examples: examples}, nil
+}
+
+// Examples returns all examples in file order
+func (s *ExampleStore) Examples() []FewShotExample {
+	return s.examples
+}
+
+// ValidShotStrategy reports whether strategy is a known few-shot selection strategy
+func ValidShotStrategy(strategy string) bool {
+	switch strategy {
+	case ShotStrategyFixed, ShotStrategyRandom, ShotStrategySimilar:
+		return true
+	}
+	return false
+}
+
+// Select picks n examples. fixed takes the first n, random shuffles with seed (0 picks a
+// seed, which is returned so the run can be reproduced) and similar ranks examples by the
+// tables and features they share with the source SQL.
+func (s *ExampleStore) Select(n int, strategy string, seed int64, sourceSQL string) ([]FewShotExample, FewShotSelection, error) {
+	selection := FewShotSelection{Strategy: strategy}
+	if n > len(s.examples) {
+		n = len(s.examples)
+	}
+
+	candidates := append([]FewShotExample(nil), s.examples...)
+	switch strategy {
+	case ShotStrategyFixed:
+	case ShotStrategyRandom:
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		selection.Seed = seed
+		rng := rand.New(rand.NewSource(seed))
+		rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	case ShotStrategySimilar:
+		source := sqlFingerprint(sourceSQL)
+		scores := make(map[string]float64, len(candidates))
+		for _, example := range candidates {
+			scores[example.ID] = source.similarity(sqlFingerprint(example.Postgres))
+		}
+		// Stable, so ties keep the curated order
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return scores[candidates[i].ID] > scores[candidates[j].ID]
+		})
+	default:
+		return nil, selection, fmt.Errorf("invalid shot strategy '%s'. Use 'fixed', 'random' or 'similar'", strategy)
+	}
+
+	selected := candidates[:n]
+	for _, example := range selected {
+		selection.Examples = append(selection.Examples, example.ID)
+	}
+	return selected, selection, nil
+}
+
+// sqlFeatures maps a feature name to the pattern detecting it in PostgreSQL code
+var sqlFeatures = map[string]*regexp.Regexp{
+	"create_table":  regexp.MustCompile(`(?i)\bCREATE\s+TABLE\b`),
+	"serial":        regexp.MustCompile(`(?i)\b(BIG)?SERIAL\b`),
+	"uuid":          regexp.MustCompile(`(?i)\bUUID\b|gen_random_uuid`),
+	"varchar":       regexp.MustCompile(`(?i)\bVARCHAR\b|\bTEXT\b`),
+	"timestamp":     regexp.MustCompile(`(?i)\bTIMESTAMPTZ?\b|CURRENT_TIMESTAMP|\bNOW\(\)`),
+	"default":       regexp.MustCompile(`(?i)\bDEFAULT\b`),
+	"foreign_key":   regexp.MustCompile(`(?i)\bREFERENCES\b`),
+	"check":         regexp.MustCompile(`(?i)\bCHECK\s*\(`),
+	"index":         regexp.MustCompile(`(?i)\bCREATE\s+(UNIQUE\s+)?INDEX\b`),
+	"view":          regexp.MustCompile(`(?i)\bCREATE\s+(OR\s+REPLACE\s+)?VIEW\b`),
+	"insert":        regexp.MustCompile(`(?i)\bINSERT\s+INTO\b`),
+	"returning":     regexp.MustCompile(`(?i)\bRETURNING\b`),
+	"update":        regexp.MustCompile(`(?i)\bUPDATE\s+\w+\s+SET\b`),
+	"delete":        regexp.MustCompile(`(?i)\bDELETE\s+FROM\b`),
+	"select":        regexp.MustCompile(`(?i)\bSELECT\b`),
+	"join":          regexp.MustCompile(`(?i)\bJOIN\b`),
+	"interval":      regexp.MustCompile(`(?i)\bINTERVAL\b`),
+	"string_ops":    regexp.MustCompile(`(?i)\|\||\bILIKE\b`),
+	"array":         regexp.MustCompile(`(?i)\[\]|\bARRAY\b`),
+	"json":          regexp.MustCompile(`(?i)\bJSONB?\b`),
+	"boolean":       regexp.MustCompile(`(?i)\bBOOLEAN\b`),
+	"drop":          regexp.MustCompile(`(?i)\bDROP\s+(TABLE|INDEX|VIEW)\b`),
+	"numeric_types": regexp.MustCompile(`(?i)\bNUMERIC\b|\bDECIMAL\b|\bINTEGER\b`),
+}
+
+var tableNamePattern = regexp.MustCompile(`(?i)\b(?:TABLE|INTO|FROM|JOIN|UPDATE|REFERENCES|ON)\s+(?:IF\s+(?:NOT\s+)?EXISTS\s+)?(\w+)`)
+
+// fingerprint is the set of tables and features used by a piece of SQL
+type fingerprint struct {
+	tables   map[string]bool
+	features map[string]bool
+}
+
+func sqlFingerprint(sql string) fingerprint {
+	fp := fingerprint{tables: make(map[string]bool), features: make(map[string]bool)}
+	for name, pattern := range sqlFeatures {
+		if pattern.MatchString(sql) {
+			fp.features[name] = true
+		}
+	}
+	for _, match := range tableNamePattern.FindAllStringSubmatch(sql, -1) {
+		fp.tables[strings.ToLower(match[1])] = true
+	}
+	return fp
+}
+
+// similarity weights feature overlap over table overlap, both as Jaccard indexes
+func (fp fingerprint) similarity(other fingerprint) float64 {
+	return 0.7*jaccard(fp.features, other.features) + 0.3*jaccard(fp.tables, other.tables)
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	intersection := 0
+	for key := range a {
+		if b[key] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
@@ -0,0 +1,229 @@
+package integration
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sql-parser/models"
+	"sql-parser/tools"
+)
+
+// Guideline modes selectable with --guidelines
+const (
+	GuidelinesNone      = "none"
+	GuidelinesAll       = "all"
+	GuidelinesRetrieved = "retrieved"
+)
+
+var (
+	guidelineTagLine  = regexp.MustCompile(`^\s*\[tags:\s*([^\]]*)\]\s*$`)
+	guidelineItemLine = regexp.MustCompile(`^\d+\.\s`)
+)
+
+// ValidGuidelineMode reports whether mode is a known guideline mode
+func ValidGuidelineMode(mode string) bool {
+	switch mode {
+	case GuidelinesNone, GuidelinesAll, GuidelinesRetrieved:
+		return true
+	}
+	return false
+}
+
+// SetGuidelineMode selects whether the guidelines are left out, appended in full to the initial
+// prompt, or retrieved per prompt for the source features and the errors of the previous iteration
+func (p *Pipeline) SetGuidelineMode(mode string) error {
+	if !ValidGuidelineMode(mode) {
+		return fmt.Errorf("invalid guideline mode '%s'. Use 'none', 'all' or 'retrieved'", mode)
+	}
+	p.guidelineMode = mode
+	p.moreContextEnabled = mode == GuidelinesAll
+	return nil
+}
+
+// ReadTaggedGuidelines splits the guidelines file into the units used for retrieval: every
+// numbered item, plus the unnumbered body of a section, each with the tags declared inside it.
+// Units without tags are only part of the full guidelines.
+func (pr *PromptReader) ReadTaggedGuidelines() ([]GuidelineSection, error) {
+	content, err := pr.readRawGuidelinesFile()
+	if err != nil {
+		return nil, err
+	}
+	return splitTaggedGuidelines(content), nil
+}
+
+func splitTaggedGuidelines(content string) []GuidelineSection {
+	lines := strings.Split(content, "\n")
+	var units []GuidelineSection
+	var current *GuidelineSection
+	var heading string
+	var body []string
+
+	flush := func() {
+		if current != nil && len(current.Tags) > 0 {
+			current.Content = strings.TrimSpace(strings.Join(body, "\n"))
+			units = append(units, *current)
+		}
+		current = nil
+		body = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed != "" && i+1 < len(lines) && isHeadingUnderline(lines[i+1]):
+			flush()
+			heading = trimmed
+			current = &GuidelineSection{Title: heading}
+			i++ // Skip the underline
+		case guidelineItemLine.MatchString(line):
+			flush()
+			current = &GuidelineSection{Title: heading + ": " + trimmed}
+		case guidelineTagLine.MatchString(line):
+			if current != nil {
+				current.Tags = append(current.Tags, parseGuidelineTags(guidelineTagLine.FindStringSubmatch(line)[1])...)
+			}
+		default:
+			// Item bodies are flat lists, so their indentation carries no meaning outside the file
+			body = append(body, trimmed)
+		}
+	}
+	flush()
+
+	return units
+}
+
+func parseGuidelineTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// stripGuidelineTags removes the [tags: ...] lines, which are only meant for retrieval
+func stripGuidelineTags(content string) string {
+	lines := strings.Split(content, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if !guidelineTagLine.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// RetrieveGuidelines returns the units carrying any of tags, in file order
+func RetrieveGuidelines(units []GuidelineSection, tags []string) []GuidelineSection {
+	wanted := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+
+	var selected []GuidelineSection
+	for _, unit := range units {
+		for _, tag := range unit.Tags {
+			if wanted[tag] {
+				selected = append(selected, unit)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// observedCategories returns every parse error type and execution category of a result
+func observedCategories(fr models.TestFileResult) []string {
+	var categories []string
+	for category := range fr.ParseErrorCodes {
+		categories = append(categories, category)
+	}
+	for category := range fr.ErrorCategories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// tagsForResult collects the guideline tags of the error categories observed in a result
+func tagsForResult(fr models.TestFileResult) []string {
+	var tags []string
+	for _, category := range observedCategories(fr) {
+		tags = append(tags, tools.GetGuidelineTags(category)...)
+	}
+	return uniqueSorted(tags)
+}
+
+// sourceFeatureTags predicts the guideline tags needed for a source SQL feature, see sqlFeatures
+var sourceFeatureTags = map[string][]string{
+	"create_table": {"primary-key"},
+	"serial":       {"sequence", "uuid"},
+	"uuid":         {"uuid", "type-mismatch"},
+	"timestamp":    {"default-value"},
+	"default":      {"default-value"},
+	"foreign_key":  {"foreign-key", "creation-order"},
+	"check":        {"check-constraint", "string-literal"},
+	"index":        {"index"},
+	"view":         {"view"},
+	"insert":       {"not-null", "string-literal"},
+	"returning":    {"returning"},
+	"interval":     {"function"},
+	"string_ops":   {"function"},
+	"array":        {"array"},
+}
+
+// tagsForSource predicts the guideline tags for the features used by the source SQL
+func tagsForSource(sourceSQL string) []string {
+	var tags []string
+	for feature := range sqlFingerprint(sourceSQL).features {
+		tags = append(tags, sourceFeatureTags[feature]...)
+	}
+	return uniqueSorted(tags)
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// retrieveGuidelines reads the tagged guidelines and returns the units matching tags
+func (p *Pipeline) retrieveGuidelines(tags []string) ([]GuidelineSection, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	units, err := p.promptReader.ReadTaggedGuidelines()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tagged guidelines: %w", err)
+	}
+	return RetrieveGuidelines(units, tags), nil
+}
+
+// formatGuidelineSections renders retrieved guideline units as plain text
+func formatGuidelineSections(sections []GuidelineSection) string {
+	blocks := make([]string, 0, len(sections))
+	for _, section := range sections {
+		blocks = append(blocks, section.Title+"\n"+section.Content)
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// guidelineTitles lists the titles of guideline units, for the results
+func guidelineTitles(sections []GuidelineSection) []string {
+	titles := make([]string, 0, len(sections))
+	for _, section := range sections {
+		titles = append(titles, section.Title)
+	}
+	return titles
+}
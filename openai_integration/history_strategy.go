@@ -0,0 +1,254 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// History strategies deciding which part of a local conversation is sent on each request
+	HistoryFull       = "full"
+	HistoryLastTurns  = "last-turns"
+	HistoryAnchored   = "anchored"
+	HistorySummarised = "summarised"
+
+	// DefaultHistoryTurns is how many recent turns the last-turns and summarised strategies keep
+	DefaultHistoryTurns = 2
+
+	// charsPerToken is the rough ratio used to estimate tokens without a tokenizer
+	charsPerToken = 4
+	// messageOverheadTokens approximates the per-message formatting tokens of the chat format
+	messageOverheadTokens = 4
+)
+
+// HistorySummaryPrompt asks the model to condense earlier attempts when using the summarised strategy
+const HistorySummaryPrompt = `Summarise the following attempts at translating the SQL script.
+For each attempt keep only: which errors were reported (category and statement), which fixes were tried and whether they worked.
+Do not repeat the SQL itself. Answer with a concise bullet list.`
+
+// HistoryStrategy selects the messages sent to the model from the full local history.
+// The last message is always the new user message and must be kept.
+type HistoryStrategy interface {
+	Name() string
+	Select(session *ConversationSession, messages []ConversationMessage) ([]ConversationMessage, error)
+}
+
+// ValidHistoryStrategy reports whether name is a known history strategy
+func ValidHistoryStrategy(name string) bool {
+	switch name {
+	case HistoryFull, HistoryLastTurns, HistoryAnchored, HistorySummarised:
+		return true
+	}
+	return false
+}
+
+// NewHistoryStrategy creates the strategy with the given name. turns is used by the
+// last-turns and summarised strategies; the client is needed to produce summaries.
+func NewHistoryStrategy(name string, turns int, client *OpenAIClient) (HistoryStrategy, error) {
+	if turns <= 0 {
+		turns = DefaultHistoryTurns
+	}
+	switch name {
+	case "", HistoryFull:
+		return fullHistory{}, nil
+	case HistoryLastTurns:
+		return lastTurnsHistory{turns: turns}, nil
+	case HistoryAnchored:
+		return anchoredHistory{}, nil
+	case HistorySummarised:
+		return &summarisedHistory{client: client, turns: turns, summaries: make(map[string]historySummary)}, nil
+	}
+	return nil, fmt.Errorf("invalid history strategy '%s'. Use 'full', 'last-turns', 'anchored' or 'summarised'", name)
+}
+
+// EstimateTokens approximates the number of tokens in text
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// EstimateMessagesTokens approximates the prompt tokens of a list of messages
+func EstimateMessagesTokens(messages []ConversationMessage) int {
+	total := 0
+	for _, message := range messages {
+		total += EstimateTokens(message.Content) + messageOverheadTokens
+	}
+	return total
+}
+
+// fullHistory sends every message, which is the original behaviour
+type fullHistory struct{}
+
+func (fullHistory) Name() string { return HistoryFull }
+
+func (fullHistory) Select(_ *ConversationSession, messages []ConversationMessage) ([]ConversationMessage, error) {
+	return messages, nil
+}
+
+// lastTurnsHistory keeps the new message and the given number of preceding assistant/user turns
+type lastTurnsHistory struct {
+	turns int
+}
+
+func (h lastTurnsHistory) Name() string { return HistoryLastTurns }
+
+func (h lastTurnsHistory) Select(_ *ConversationSession, messages []ConversationMessage) ([]ConversationMessage, error) {
+	return lastTurns(messages, h.turns), nil
+}
+
+// anchoredHistory keeps the initial prompt, the latest SQL answer and the latest feedback.
+// An answer that needed continuations is sent as one stitched message.
+type anchoredHistory struct{}
+
+func (anchoredHistory) Name() string { return HistoryAnchored }
+
+func (anchoredHistory) Select(_ *ConversationSession, messages []ConversationMessage) ([]ConversationMessage, error) {
+	// The current exchange starts at the latest prompt that is not a continuation request;
+	// when the new message is a continuation request the chunks received so far are kept
+	current := latestPrompt(messages, len(messages))
+	if current <= 0 {
+		return messages, nil
+	}
+
+	selected := []ConversationMessage{messages[0]}
+	if previous := latestPrompt(messages, current); previous+1 < current {
+		selected = append(selected, stitchAnswer(messages[previous+1:current]))
+	}
+	return append(selected, messages[current:]...), nil
+}
+
+// latestPrompt returns the index of the latest user message before end that is not a
+// continuation request, or -1
+func latestPrompt(messages []ConversationMessage, end int) int {
+	for i := end - 1; i >= 0; i-- {
+		if messages[i].Role == "user" && messages[i].Content != ContinuationPrompt {
+			return i
+		}
+	}
+	return -1
+}
+
+// stitchAnswer joins the assistant chunks of an answer that was continued after the token limit
+func stitchAnswer(messages []ConversationMessage) ConversationMessage {
+	content := ""
+	for _, message := range messages {
+		if message.Role == "assistant" {
+			content = stitchContinuation(content, message.Content)
+		}
+	}
+	return ConversationMessage{Role: "assistant", Content: content}
+}
+
+// historySummary is a cached summary of the messages between the initial prompt and covered.
+// prefix hashes the first covered messages, so a summary of rolled back messages is not reused.
+type historySummary struct {
+	covered int
+	prefix  string
+	text    string
+}
+
+// summarisedHistory keeps the initial prompt and the latest turns, and replaces everything
+// in between with a summary produced by the model. Summaries are extended incrementally.
+type summarisedHistory struct {
+	client    *OpenAIClient
+	turns     int
+	summaries map[string]historySummary
+}
+
+func (h *summarisedHistory) Name() string { return HistorySummarised }
+
+func (h *summarisedHistory) Select(session *ConversationSession, messages []ConversationMessage) ([]ConversationMessage, error) {
+	recent := recentTurns(messages, h.turns)
+	// Messages 1..middleEnd-1 are neither the initial prompt nor part of the recent turns
+	middleEnd := len(messages) - len(recent)
+	if middleEnd <= 1 {
+		return messages, nil
+	}
+
+	summary := h.summaries[session.ID]
+	if summary.covered > middleEnd || summary.prefix != hashMessages(messages[:summary.covered]) {
+		// The conversation was rolled back since the summary was made, start over
+		summary = historySummary{}
+	}
+	if summary.covered < middleEnd {
+		text, err := h.summarise(session, summary.text, messages[max(summary.covered, 1):middleEnd])
+		if err != nil {
+			return nil, err
+		}
+		summary = historySummary{covered: middleEnd, prefix: hashMessages(messages[:middleEnd]), text: text}
+		h.summaries[session.ID] = summary
+	}
+
+	selected := []ConversationMessage{
+		messages[0],
+		{Role: "user", Content: "Summary of the previous attempts:\n" + summary.text},
+		{Role: "assistant", Content: "Understood, I will take these previous attempts into account."},
+	}
+	return append(selected, recent...), nil
+}
+
+// summarise asks the model to fold the new messages into the existing summary
+func (h *summarisedHistory) summarise(session *ConversationSession, previous string, messages []ConversationMessage) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("Summary so far:\n")
+		transcript.WriteString(previous)
+		transcript.WriteString("\n\n")
+	}
+	for _, message := range messages {
+		fmt.Fprintf(&transcript, "[%s]\n%s\n\n", message.Role, message.Content)
+	}
+
+	response, err := h.client.SendPlainMessage([]ConversationMessage{
+		{Role: "system", Content: HistorySummaryPrompt},
+		{Role: "user", Content: transcript.String()},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to summarise history: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return "", fmt.Errorf("failed to summarise history: no choices in response")
+	}
+
+	session.PromptTokens += response.Usage.PromptTokens
+	session.CompletionTokens += response.Usage.CompletionTokens
+	session.TotalTokens += response.Usage.TotalTokens
+	session.HistorySummaries++
+
+	return strings.TrimSpace(response.Choices[0].Message.Content), nil
+}
+
+// lastTurns returns the initial prompt followed by recentTurns
+func lastTurns(messages []ConversationMessage, turns int) []ConversationMessage {
+	recent := recentTurns(messages, turns)
+	if len(messages) <= len(recent)+1 {
+		return messages
+	}
+	return append([]ConversationMessage{messages[0]}, recent...)
+}
+
+// recentTurns returns the current exchange preceded by up to turns earlier ones, never including
+// the initial prompt. An exchange is an answer, its continuations and the prompt that follows it.
+func recentTurns(messages []ConversationMessage, turns int) []ConversationMessage {
+	end := len(messages)
+	for i := 0; i <= turns; i++ {
+		if end = latestPrompt(messages, end); end <= 0 {
+			return messages[min(len(messages), 1):]
+		}
+	}
+	return messages[end+1:]
+}
+
+// hashMessages identifies a list of messages by their roles and contents
+func hashMessages(messages []ConversationMessage) string {
+	if len(messages) == 0 {
+		return ""
+	}
+	hash := sha256.New()
+	for _, message := range messages {
+		fmt.Fprintf(hash, "%s\x00%s\x00", message.Role, message.Content)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,178 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conversation builds a history from alternating user and assistant contents, starting with a user message
+func conversation(contents ...string) []ConversationMessage {
+	messages := make([]ConversationMessage, len(contents))
+	for i, content := range contents {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages[i] = ConversationMessage{Role: role, Content: content}
+	}
+	return messages
+}
+
+func contents(messages []ConversationMessage) []string {
+	result := make([]string, len(messages))
+	for i, message := range messages {
+		result[i] = message.Content
+	}
+	return result
+}
+
+func TestLastTurns(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []ConversationMessage
+		turns    int
+		expected []string
+	}{
+		{name: "empty", messages: nil, turns: 1, expected: []string{}},
+		{name: "initial prompt only", messages: conversation("prompt"), turns: 1, expected: []string{"prompt"}},
+		{name: "shorter than the window", messages: conversation("prompt", "a1", "f1"), turns: 1, expected: []string{"prompt", "a1", "f1"}},
+		{name: "window reaches the initial prompt", messages: conversation("prompt", "a1", "f1", "a2", "f2"), turns: 2, expected: []string{"prompt", "a1", "f1", "a2", "f2"}},
+		{name: "keeps the initial prompt", messages: conversation("prompt", "a1", "f1", "a2", "f2"), turns: 1, expected: []string{"prompt", "a2", "f2"}},
+		{name: "longer history", messages: conversation("prompt", "a1", "f1", "a2", "f2", "a3", "f3"), turns: 2, expected: []string{"prompt", "a2", "f2", "a3", "f3"}},
+		{
+			name:     "continuations stay with their answer",
+			messages: conversation("prompt", "a1", "f1", "CREATE", ContinuationPrompt, " TABLE", "f2"),
+			turns:    1,
+			expected: []string{"prompt", "CREATE", ContinuationPrompt, " TABLE", "f2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, contents(lastTurns(tt.messages, tt.turns)))
+		})
+	}
+}
+
+func TestAnchoredHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []ConversationMessage
+		expected []string
+	}{
+		{name: "first request", messages: conversation("prompt"), expected: []string{"prompt"}},
+		{name: "latest answer and feedback", messages: conversation("prompt", "a1", "f1", "a2", "f2"), expected: []string{"prompt", "a2", "f2"}},
+		{
+			name:     "continued answer is stitched",
+			messages: conversation("prompt", "a1", "f1", "CREATE TABLE", ContinuationPrompt, " T (Id INT64)", "f2"),
+			expected: []string{"prompt", "CREATE TABLE T (Id INT64)", "f2"},
+		},
+		{
+			name:     "continuation request keeps the current chunks",
+			messages: conversation("prompt", "a1", "f1", "CREATE TABLE", ContinuationPrompt),
+			expected: []string{"prompt", "a1", "f1", "CREATE TABLE", ContinuationPrompt},
+		},
+		{
+			name:     "continuation of the initial answer",
+			messages: conversation("prompt", "CREATE TABLE", ContinuationPrompt),
+			expected: []string{"prompt", "CREATE TABLE", ContinuationPrompt},
+		},
+		{
+			// RollbackTo cut the history after a1, then a new feedback prompt was added
+			name:     "after a rollback",
+			messages: conversation("prompt", "a1", "f1 again"),
+			expected: []string{"prompt", "a1", "f1 again"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := anchoredHistory{}.Select(&ConversationSession{ID: "s"}, tt.messages)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, contents(selected))
+			assert.Equal(t, "user", selected[len(selected)-1].Role)
+		})
+	}
+}
+
+// summaryServer stubs the chat completions endpoint: it records the transcript of each summary
+// request and answers with a numbered summary
+func summaryServer(t *testing.T, requests *[]string) *OpenAIClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request OpenAIRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		transcript := request.Messages[len(request.Messages)-1].Content
+		*requests = append(*requests, transcript)
+
+		var response OpenAIResponse
+		response.Choices = make([]struct {
+			Index   int `json:"index"`
+			Message struct {
+				Role      string     `json:"role"`
+				Content   string     `json:"content"`
+				ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		}, 1)
+		response.Choices[0].Message.Content = fmt.Sprintf("summary %d", len(*requests))
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(server.Close)
+	return NewOpenAIClient(OpenAIConfig{APIKey: "test", BaseURL: server.URL})
+}
+
+func TestSummarisedHistory(t *testing.T) {
+	var requests []string
+	strategy, err := NewHistoryStrategy(HistorySummarised, 1, summaryServer(t, &requests))
+	require.NoError(t, err)
+	session := &ConversationSession{ID: "s"}
+
+	// Short histories are sent as they are
+	selected, err := strategy.Select(session, conversation("prompt", "a1", "f1"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prompt", "a1", "f1"}, contents(selected))
+	assert.Empty(t, requests)
+
+	selected, err = strategy.Select(session, conversation("prompt", "a1", "f1", "a2", "f2"))
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Contains(t, requests[0], "a1")
+	assert.Equal(t, "prompt", selected[0].Content)
+	assert.Contains(t, selected[1].Content, "summary 1")
+	assert.Equal(t, []string{"a2", "f2"}, contents(selected[3:]))
+
+	// The cached summary is extended with the new messages only
+	_, err = strategy.Select(session, conversation("prompt", "a1", "f1", "a2", "f2", "a3", "f3"))
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+	assert.Contains(t, requests[1], "summary 1")
+	assert.NotContains(t, requests[1], "a1")
+
+	// After rolling back to a1 and answering again the summary of a2 must not be reused
+	selected, err = strategy.Select(session, conversation("prompt", "a1", "f1", "b2", "g2"))
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+	assert.NotContains(t, requests[2], "summary")
+	assert.Contains(t, requests[2], "a1")
+	assert.Contains(t, selected[1].Content, "summary 3")
+	assert.Equal(t, []string{"b2", "g2"}, contents(selected[3:]))
+
+	// Continuation requests do not count as turns, the summary still covers the same messages
+	selected, err = strategy.Select(session, conversation("prompt", "a1", "f1", "b2", "g2", "CREATE", ContinuationPrompt))
+	require.NoError(t, err)
+	assert.Len(t, requests, 3)
+	assert.Equal(t, []string{"b2", "g2", "CREATE", ContinuationPrompt}, contents(selected[3:]))
+
+	// A history of the same length with different messages is summarised again
+	_, err = strategy.Select(session, conversation("prompt", "c1", "h1", "b2", "g2"))
+	require.NoError(t, err)
+	require.Len(t, requests, 4)
+	assert.Contains(t, requests[3], "c1")
+	assert.NotContains(t, requests[3], "summary 3")
+}
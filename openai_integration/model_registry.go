@@ -0,0 +1,124 @@
+package integration
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	TokenParameterMaxTokens           = "max_tokens"
+	TokenParameterMaxCompletionTokens = "max_completion_tokens"
+
+	// ModelRegistryEnv points to a JSON file overriding or extending the embedded registry
+	ModelRegistryEnv = "MODEL_REGISTRY_PATH"
+
+	// ContextWarningThreshold is the fraction of the context window that triggers a warning
+	ContextWarningThreshold = 0.8
+)
+
+//go:embed model_registry.json
+var embeddedModelRegistry []byte
+
+// ModelCapabilities describes how requests for a model must be built and what it costs
+type ModelCapabilities struct {
+	ID                      string  `json:"id"`
+	TokenParameter          string  `json:"token_parameter"`
+	SupportsTemperature     bool    `json:"supports_temperature"`
+	SupportsTopP            bool    `json:"supports_top_p"`
+	ContextWindow           int     `json:"context_window"`
+	MaxOutputTokens         int     `json:"max_output_tokens"`
+	SupportsReasoningEffort bool    `json:"supports_reasoning_effort"`
+	InputPricePerMillion    float64 `json:"input_price_per_million"`
+	OutputPricePerMillion   float64 `json:"output_price_per_million"`
+}
+
+// EstimateCost returns the cost in USD of the given token usage
+func (m ModelCapabilities) EstimateCost(promptTokens, completionTokens int) float64 {
+	return float64(promptTokens)/1e6*m.InputPricePerMillion + float64(completionTokens)/1e6*m.OutputPricePerMillion
+}
+
+// ModelRegistry maps model IDs to their capabilities
+type ModelRegistry struct {
+	Default ModelCapabilities   `json:"default"`
+	Models  []ModelCapabilities `json:"models"`
+}
+
+var (
+	defaultRegistryOnce sync.Once
+	defaultRegistry     *ModelRegistry
+	defaultRegistryErr  error
+)
+
+// DefaultModelRegistry returns the embedded registry, merged with the file in MODEL_REGISTRY_PATH if set
+func DefaultModelRegistry() (*ModelRegistry, error) {
+	defaultRegistryOnce.Do(func() {
+		defaultRegistry, defaultRegistryErr = LoadModelRegistry(os.Getenv(ModelRegistryEnv))
+	})
+	return defaultRegistry, defaultRegistryErr
+}
+
+// LoadModelRegistry loads the embedded registry and applies the override file, if any.
+// Override entries replace embedded entries with the same ID and new IDs are added.
+func LoadModelRegistry(overridePath string) (*ModelRegistry, error) {
+	var registry ModelRegistry
+	if err := json.Unmarshal(embeddedModelRegistry, &registry); err != nil {
+		return nil, fmt.Errorf("failed to parse embedded model registry: %w", err)
+	}
+
+	if overridePath == "" {
+		return &registry, nil
+	}
+
+	data, err := os.ReadFile(overridePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model registry %s: %w", overridePath, err)
+	}
+	var override ModelRegistry
+	if err := json.Unmarshal(data, &override); err != nil {
+		return nil, fmt.Errorf("failed to parse model registry %s: %w", overridePath, err)
+	}
+
+	if override.Default.ID != "" {
+		registry.Default = override.Default
+	}
+	for _, model := range override.Models {
+		replaced := false
+		for i := range registry.Models {
+			if registry.Models[i].ID == model.ID {
+				registry.Models[i] = model
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			registry.Models = append(registry.Models, model)
+		}
+	}
+
+	return &registry, nil
+}
+
+// Lookup returns the capabilities of a model. Dated snapshots such as "gpt-5-mini-2025-08-07"
+// resolve to the longest registered ID they start with; unknown models get the default entry.
+func (r *ModelRegistry) Lookup(model string) ModelCapabilities {
+	best := -1
+	for i, candidate := range r.Models {
+		if candidate.ID == model {
+			return candidate
+		}
+		if strings.HasPrefix(model, candidate.ID+"-") && (best == -1 || len(candidate.ID) > len(r.Models[best].ID)) {
+			best = i
+		}
+	}
+	if best != -1 {
+		return r.Models[best]
+	}
+
+	capabilities := r.Default
+	capabilities.ID = model
+	return capabilities
+}
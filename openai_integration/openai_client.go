@@ -16,12 +16,30 @@ import (
 const (
 	DefaultOpenAIURL     = "https://api.openai.com/v1/chat/completions"
 	ConversationsBaseURL = "https://api.openai.com/v1/conversations"
+	ResponsesURL         = "https://api.openai.com/v1/responses"
 	DefaultModel         = "chatgpt-4o-latest"
 	DefaultTimeout       = 10 * time.Minute
 	RetryDelaySeconds    = 30
 	MaxRetries           = 10
+
+	// FinishReasonLength is reported by the API when the completion hit the token limit
+	FinishReasonLength = "length"
+
+	// Conversation modes: where the conversation history is held
+	ConversationModeLocal         = "local"         // full history resent to chat completions
+	ConversationModeConversations = "conversations" // server-side conversation object
+	ConversationModeResponses     = "responses"     // chained through previous_response_id
 )
 
+// ValidConversationMode reports whether mode is a known conversation mode
+func ValidConversationMode(mode string) bool {
+	switch mode {
+	case ConversationModeLocal, ConversationModeConversations, ConversationModeResponses:
+		return true
+	}
+	return false
+}
+
 // OpenAIErrorResponse represents an error response from OpenAI API
 type OpenAIErrorResponse struct {
 	Error struct {
@@ -40,28 +58,13 @@ func isRateLimitError(body []byte) bool {
 	return errorResp.Error.Code == "rate_limit_exceeded"
 }
 
-// isGPT5OrNewer checks if the model uses the new parameter format
-func isGPT5OrNewer(model string) bool {
-	// Models that use max_completion_tokens instead of max_tokens
-	gpt5Models := []string{
-		"gpt-5-2025-08-07",
-		"gpt-5-mini-2025-08-07",
-	}
-
-	for _, gpt5Model := range gpt5Models {
-		if model == gpt5Model ||
-			strings.HasPrefix(model, gpt5Model+"-") ||
-			strings.Contains(model, gpt5Model) {
-			return true
-		}
-	}
-	return false
-}
-
 // OpenAIClient handles communication with OpenAI API
 type OpenAIClient struct {
-	config     OpenAIConfig
-	httpClient *http.Client
+	config         OpenAIConfig
+	httpClient     *http.Client
+	responseFormat *ResponseFormat
+	capabilities   ModelCapabilities
+	limiter        *UsageLimiter
 }
 
 // NewOpenAIClient creates a new OpenAI client
@@ -76,37 +79,157 @@ func NewOpenAIClient(config OpenAIConfig) *OpenAIClient {
 		config.MaxTokens = 8096
 	}
 
+	registry, err := DefaultModelRegistry()
+	if err != nil {
+		log.Printf("Warning: %v, using the embedded model registry", err)
+		registry, _ = LoadModelRegistry("")
+	}
+
 	return &OpenAIClient{
 		config: config,
 		httpClient: &http.Client{
 			Timeout: DefaultTimeout,
 		},
+		capabilities: registry.Lookup(config.Model),
 	}
 }
 
-func (c *OpenAIClient) SendMessage(messages []ConversationMessage) (*OpenAIResponse, error) {
-	request := OpenAIRequest{
-		Model:    c.config.Model,
-		Messages: messages,
+// SetModelRegistry resolves the client's model capabilities from the given registry
+func (c *OpenAIClient) SetModelRegistry(registry *ModelRegistry) {
+	c.capabilities = registry.Lookup(c.config.Model)
+}
+
+// SetReasoningEffort sets the reasoning effort ("low", "medium", "high") for reasoning models
+func (c *OpenAIClient) SetReasoningEffort(effort string) {
+	c.config.ReasoningEffort = effort
+}
+
+// SetUsageLimiter shares rate limits and a spend cap with the other clients using limiter
+func (c *OpenAIClient) SetUsageLimiter(limiter *UsageLimiter) {
+	c.limiter = limiter
+}
+
+// Capabilities returns the capabilities of the configured model
+func (c *OpenAIClient) Capabilities() ModelCapabilities {
+	return c.capabilities
+}
+
+// maxOutputTokens returns the configured token limit, capped by what the model supports
+func (c *OpenAIClient) maxOutputTokens() int {
+	if c.capabilities.MaxOutputTokens > 0 && c.config.MaxTokens > c.capabilities.MaxOutputTokens {
+		return c.capabilities.MaxOutputTokens
 	}
+	return c.config.MaxTokens
+}
 
-	// Use the appropriate token parameter based on the model
-	if isGPT5OrNewer(c.config.Model) {
-		request.MaxCompletionTokens = c.config.MaxTokens
-		request.Temperature = 1
+// applyModelParameters sets the token limit and sampling parameters the model accepts
+func (c *OpenAIClient) applyModelParameters(request *OpenAIRequest) {
+	if c.capabilities.TokenParameter == TokenParameterMaxCompletionTokens {
+		request.MaxCompletionTokens = c.maxOutputTokens()
 	} else {
-		request.MaxTokens = c.config.MaxTokens
+		request.MaxTokens = c.maxOutputTokens()
+	}
+	if c.capabilities.SupportsTemperature {
 		request.Temperature = c.config.Temperature
 	}
+	if c.capabilities.SupportsTopP {
+		request.TopP = c.config.TopP
+	}
+	if c.capabilities.SupportsReasoningEffort {
+		request.ReasoningEffort = c.config.ReasoningEffort
+	}
+}
 
-	jsonData, err := json.Marshal(request)
+func (c *OpenAIClient) SendMessage(messages []ConversationMessage) (*OpenAIResponse, error) {
+	return c.SendMessageWithTools(messages, nil, "")
+}
+
+// SetResponseFormat sets the response format sent with every request, nil restores plain text output
+func (c *OpenAIClient) SetResponseFormat(format *ResponseFormat) {
+	c.responseFormat = format
+}
+
+// SendMessageWithTools sends the conversation together with the tools the model may call.
+// toolChoice may be empty to let the API decide.
+func (c *OpenAIClient) SendMessageWithTools(messages []ConversationMessage, tools []Tool, toolChoice string) (*OpenAIResponse, error) {
+	return c.sendChatCompletion(messages, tools, toolChoice, c.responseFormat, 0)
+}
+
+// SendPlainMessage sends the conversation ignoring the configured response format,
+// for auxiliary requests such as history summaries
+func (c *OpenAIClient) SendPlainMessage(messages []ConversationMessage) (*OpenAIResponse, error) {
+	return c.sendChatCompletion(messages, nil, "", nil, 0)
+}
+
+// GetCandidateResponses requests n alternative completions for the same history. Choices
+// missing from the first response (some models ignore n) are requested again.
+func (c *OpenAIClient) GetCandidateResponses(messages []ConversationMessage, n int) (*OpenAIResponse, error) {
+	response, err := c.sendChatCompletion(messages, nil, "", c.responseFormat, n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get candidates from chat completions: %w", err)
+	}
+
+	for len(response.Choices) > 0 && len(response.Choices) < n {
+		more, err := c.sendChatCompletion(messages, nil, "", c.responseFormat, n-len(response.Choices))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get candidates from chat completions: %w", err)
+		}
+		if len(more.Choices) == 0 {
+			break
+		}
+		response.Choices = append(response.Choices, more.Choices...)
+		response.Usage.PromptTokens += more.Usage.PromptTokens
+		response.Usage.CompletionTokens += more.Usage.CompletionTokens
+		response.Usage.TotalTokens += more.Usage.TotalTokens
+	}
+
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+	return response, nil
+}
+
+func (c *OpenAIClient) sendChatCompletion(messages []ConversationMessage, tools []Tool, toolChoice string, format *ResponseFormat, n int) (*OpenAIResponse, error) {
+	request := OpenAIRequest{
+		Model:          c.config.Model,
+		Messages:       messages,
+		Tools:          tools,
+		ResponseFormat: format,
+	}
+	if n > 1 {
+		request.N = n
+	}
+	if len(tools) > 0 {
+		request.ToolChoice = toolChoice
+	}
+
+	// Use the token parameter and sampling parameters supported by the model
+	c.applyModelParameters(&request)
+
+	body, err := c.postJSON(c.config.BaseURL, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var openAIResp OpenAIResponse
+	if err := json.Unmarshal(body, &openAIResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return &openAIResp, nil
+}
+
+// postJSON sends a JSON payload to url and returns the body of a successful response,
+// retrying on rate limit errors
+func (c *OpenAIClient) postJSON(url string, payload any) ([]byte, error) {
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	// Retry logic for rate limit errors
 	for attempt := 0; attempt < MaxRetries; attempt++ {
-		req, err := http.NewRequest("POST", c.config.BaseURL, bytes.NewBuffer(jsonData))
+		req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create request: %w", err)
 		}
@@ -114,6 +237,14 @@ func (c *OpenAIClient) SendMessage(messages []ConversationMessage) (*OpenAIRespo
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", "Bearer "+c.config.APIKey)
 
+		var reservation *limiterReservation
+		if c.limiter != nil {
+			reservation, err = c.limiter.acquire(EstimateTokens(string(jsonData)))
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
 			return nil, fmt.Errorf("failed to send request: %w", err)
@@ -125,22 +256,17 @@ func (c *OpenAIClient) SendMessage(messages []ConversationMessage) (*OpenAIRespo
 			return nil, fmt.Errorf("failed to read response body: %w", err)
 		}
 
+		if reservation != nil {
+			promptTokens, completionTokens := responseUsage(body)
+			c.limiter.record(reservation, promptTokens+completionTokens, c.capabilities.EstimateCost(promptTokens, completionTokens))
+		}
+
 		if c.config.Verbose {
 			log.Printf("OpenAI API Response Body: %s", string(body))
 		}
 
 		if resp.StatusCode == http.StatusOK {
-			// Success - parse and return response
-			if c.config.Verbose {
-				log.Printf("OpenAI API Response Body: %s", string(body))
-			}
-
-			var openAIResp OpenAIResponse
-			if err := json.Unmarshal(body, &openAIResp); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-			}
-
-			return &openAIResp, nil
+			return body, nil
 		}
 
 		// Check if this is a rate limit error
@@ -201,10 +327,22 @@ func generateUniqueID(prefix string) (string, error) {
 	return fmt.Sprintf("%s_%d_%s", prefix, time.Now().UnixNano(), randomHex), nil
 }
 
-// CreateConversation creates a new conversation (fallback implementation using chat completions)
-func (c *OpenAIClient) CreateConversation() (*CreateConversationResponse, error) {
-	// Since the Conversations API might not be available yet, we'll simulate it
-	// by generating a conversation ID and managing state locally
+// CreateConversation creates a new conversation. In local mode the ID is generated locally and the
+// history is kept by the SessionManager; in the server-side modes the conversation lives on OpenAI.
+func (c *OpenAIClient) CreateConversation(mode string) (*CreateConversationResponse, error) {
+	if mode == ConversationModeConversations {
+		body, err := c.postJSON(ConversationsBaseURL, CreateConversationRequest{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create conversation: %w", err)
+		}
+
+		var conversation CreateConversationResponse
+		if err := json.Unmarshal(body, &conversation); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal conversation: %w", err)
+		}
+		return &conversation, nil
+	}
+
 	// Use timestamp + random bytes to ensure unique IDs for concurrent executions
 	conversationID, err := generateUniqueID("conv")
 	if err != nil {
@@ -218,8 +356,35 @@ func (c *OpenAIClient) CreateConversation() (*CreateConversationResponse, error)
 	}, nil
 }
 
-// AddMessage adds a message to an existing conversation (fallback implementation)
-func (c *OpenAIClient) AddMessage(conversationID, role, content string) (*AddMessageResponse, error) {
+// AddMessage adds a message to an existing conversation. Only the conversations mode stores the
+// item on OpenAI; the other modes generate a local message ID.
+func (c *OpenAIClient) AddMessage(mode, conversationID, role, content string) (*AddMessageResponse, error) {
+	if mode == ConversationModeConversations {
+		request := AddItemsRequest{Items: []ResponseInputItem{newResponseInputItem(role, content)}}
+		body, err := c.postJSON(fmt.Sprintf("%s/%s/items", ConversationsBaseURL, conversationID), request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add item to conversation: %w", err)
+		}
+
+		var items AddItemsResponse
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal conversation items: %w", err)
+		}
+		messageID := ""
+		if len(items.Data) > 0 {
+			messageID = items.Data[len(items.Data)-1].ID
+		}
+
+		return &AddMessageResponse{
+			ID:             messageID,
+			Object:         "message",
+			CreatedAt:      time.Now().Unix(),
+			ConversationID: conversationID,
+			Role:           role,
+			Content:        content,
+		}, nil
+	}
+
 	// Simulate adding a message by generating a message ID
 	messageID := fmt.Sprintf("msg_%d", time.Now().UnixNano())
 
@@ -247,21 +412,104 @@ func (c *OpenAIClient) GetResponse(conversationID string, messages []Conversatio
 	// Convert to GetResponseResponse format
 	responseID := fmt.Sprintf("resp_%d", time.Now().UnixNano())
 
-	return &GetResponseResponse{
+	result := &GetResponseResponse{
 		ID:             responseID,
 		Object:         "response",
 		CreatedAt:      time.Now().Unix(),
 		ConversationID: conversationID,
 		Role:           "assistant",
 		Content:        response.Choices[0].Message.Content,
-		Usage: struct {
-			PromptTokens     int `json:"prompt_tokens"`
-			CompletionTokens int `json:"completion_tokens"`
-			TotalTokens      int `json:"total_tokens"`
-		}{
-			PromptTokens:     response.Usage.PromptTokens,
-			CompletionTokens: response.Usage.CompletionTokens,
-			TotalTokens:      response.Usage.TotalTokens,
-		},
-	}, nil
+		FinishReason:   response.Choices[0].FinishReason,
+	}
+	result.Usage.PromptTokens = response.Usage.PromptTokens
+	result.Usage.CompletionTokens = response.Usage.CompletionTokens
+	result.Usage.TotalTokens = response.Usage.TotalTokens
+	return result, nil
+}
+
+// GetServerResponse requests a response through the Responses API, sending only the new message.
+// The earlier turns are taken from the server-side conversation (conversations mode) or from the
+// response chain given by previousResponseID (responses mode).
+func (c *OpenAIClient) GetServerResponse(mode, conversationID, previousResponseID string, message ConversationMessage) (*GetResponseResponse, error) {
+	request := ResponsesRequest{
+		Model: c.config.Model,
+		Input: []ResponseInputItem{newResponseInputItem(message.Role, message.Content)},
+		Store: true,
+	}
+	switch mode {
+	case ConversationModeConversations:
+		request.Conversation = conversationID
+	case ConversationModeResponses:
+		request.PreviousResponseID = previousResponseID
+	default:
+		return nil, fmt.Errorf("conversation mode %q does not use the Responses API", mode)
+	}
+
+	request.MaxOutputTokens = c.maxOutputTokens()
+	if c.capabilities.SupportsTemperature {
+		request.Temperature = c.config.Temperature
+	}
+	if c.capabilities.SupportsTopP {
+		request.TopP = c.config.TopP
+	}
+	if c.capabilities.SupportsReasoningEffort && c.config.ReasoningEffort != "" {
+		request.Reasoning = &ResponsesReasoning{Effort: c.config.ReasoningEffort}
+	}
+	if c.responseFormat != nil && c.responseFormat.JSONSchema != nil {
+		request.Text = &ResponsesTextConfig{Format: ResponsesTextFormat{
+			Type:   c.responseFormat.Type,
+			Name:   c.responseFormat.JSONSchema.Name,
+			Strict: c.responseFormat.JSONSchema.Strict,
+			Schema: c.responseFormat.JSONSchema.Schema,
+		}}
+	}
+
+	body, err := c.postJSON(ResponsesURL, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response from responses API: %w", err)
+	}
+
+	var response ResponsesResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	var content strings.Builder
+	for _, item := range response.Output {
+		if item.Type != "message" {
+			continue
+		}
+		for _, part := range item.Content {
+			if part.Type == "output_text" {
+				content.WriteString(part.Text)
+			}
+		}
+	}
+
+	// Map the Responses API status onto chat completion finish reasons
+	finishReason := "stop"
+	if response.Status == "incomplete" {
+		finishReason = response.IncompleteDetails.Reason
+		if finishReason == "max_output_tokens" {
+			finishReason = FinishReasonLength
+		}
+	}
+
+	result := &GetResponseResponse{
+		ID:             response.ID,
+		Object:         response.Object,
+		CreatedAt:      response.CreatedAt,
+		ConversationID: conversationID,
+		Role:           "assistant",
+		Content:        content.String(),
+		FinishReason:   finishReason,
+	}
+	result.Usage.PromptTokens = response.Usage.InputTokens
+	result.Usage.CompletionTokens = response.Usage.OutputTokens
+	result.Usage.TotalTokens = response.Usage.TotalTokens
+	return result, nil
+}
+
+func newResponseInputItem(role, content string) ResponseInputItem {
+	return ResponseInputItem{Type: "message", Role: role, Content: content}
 }
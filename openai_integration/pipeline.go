@@ -2,6 +2,7 @@ package integration
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,20 +19,51 @@ import (
 var pipelineResultsMutex sync.Mutex
 
 type Pipeline struct {
-	client             *OpenAIClient
-	sessionMgr         *SessionManager
-	promptReader       *PromptReader
-	basePath           string
-	maxIterations      int
-	verbose            bool
-	debugPrompt        bool
-	debugFile          string
-	shortPrompts       bool
-	moreContextEnabled bool
-	uniqueID           string
-	model              string
+	client               *OpenAIClient
+	sessionMgr           *SessionManager
+	promptReader         *PromptReader
+	basePath             string
+	maxIterations        int
+	verbose              bool
+	debugPrompt          bool
+	debugFile            string
+	shortPrompts         bool
+	moreContextEnabled   bool
+	uniqueID             string
+	model                string
+	maxContinuations     int
+	toolBudget           int
+	structuredOutput     bool
+	structuredRetries    int
+	sessionStore         *SessionStore
+	runConfig            PipelineConfig
+	conversationMode     string
+	reasoningEffort      string
+	historyTurns         int
+	templates            *PromptTemplates
+	targetDialect        string
+	semanticCheck        string
+	exampleStore         *ExampleStore
+	shots                int
+	shotStrategy         string
+	shotSeed             int64
+	fewShot              *FewShotSelection
+	candidates           int
+	scoreMetric          string
+	rollbackOnRegression bool
+	stopPolicy           StopPolicy
+	feedback             FeedbackStrategy
+	guidelineMode        string
+	initialGuidelines    []string
+	prompt               string
+	taskID               string
+	expectedResults      []ExpectedQuery
+	experiment           *ExperimentTag
 }
 
+// DefaultMaxContinuations is how many times a truncated response is continued before giving up
+const DefaultMaxContinuations = 3
+
 func NewPipeline(basePath string, maxIterations int, verbose bool) (*Pipeline, error) {
 	return NewPipelineWithModel(basePath, maxIterations, "", verbose)
 }
@@ -53,6 +85,11 @@ func NewPipelineWithModel(basePath string, maxIterations int, model string, verb
 	sessionMgr := NewSessionManager(client)
 	promptReader := NewPromptReader(basePath)
 
+	templates, err := LoadPromptTemplates(basePath, DefaultPromptTemplateSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompt templates: %w", err)
+	}
+
 	return &Pipeline{
 		client:             client,
 		sessionMgr:         sessionMgr,
@@ -66,6 +103,17 @@ func NewPipelineWithModel(basePath string, maxIterations int, model string, verb
 		moreContextEnabled: false,
 		uniqueID:           "",
 		model:              model,
+		maxContinuations:   DefaultMaxContinuations,
+		toolBudget:         DefaultToolBudget,
+		structuredOutput:   false,
+		structuredRetries:  DefaultStructuredRetries,
+		conversationMode:   ConversationModeLocal,
+		templates:          templates,
+		targetDialect:      TargetDialectGoogleSQL,
+		semanticCheck:      SemanticCheckOff,
+		scoreMetric:        MetricOverall,
+		feedback:           templateFeedback{},
+		guidelineMode:      GuidelinesNone,
 	}, nil
 }
 
@@ -92,12 +140,128 @@ func (p *Pipeline) SetShortPrompts(short bool) {
 
 func (p *Pipeline) SetMoreContextEnabled(enabled bool) {
 	p.moreContextEnabled = enabled
+	if enabled {
+		p.guidelineMode = GuidelinesAll
+	}
+}
+
+// SetTask replaces prompt.txt with the prompt of a benchmark task and checks its expected query
+// results after every evaluation
+func (p *Pipeline) SetTask(taskID, prompt string, expected []ExpectedQuery) {
+	p.taskID = taskID
+	p.prompt = prompt
+	p.expectedResults = expected
+}
+
+// SetExperiment records the experiment cell and repetition of this run in the saved metrics
+func (p *Pipeline) SetExperiment(tag ExperimentTag) {
+	p.experiment = &tag
+}
+
+// SetTargetDialect selects the Spanner dialect the models translate into and the evaluation runs against
+func (p *Pipeline) SetTargetDialect(dialect string) error {
+	if dialect != TargetDialectGoogleSQL && dialect != TargetDialectPostgreSQL {
+		return fmt.Errorf("invalid target dialect '%s'. Use '%s' or '%s'", dialect, TargetDialectGoogleSQL, TargetDialectPostgreSQL)
+	}
+	p.targetDialect = dialect
+	p.promptReader.SetTargetDialect(dialect)
+	return nil
 }
 
 func (p *Pipeline) SetUniqueID(uniqueID string) {
 	p.uniqueID = uniqueID
 }
 
+func (p *Pipeline) SetMaxContinuations(maxContinuations int) {
+	p.maxContinuations = maxContinuations
+}
+
+func (p *Pipeline) SetToolBudget(budget int) {
+	p.toolBudget = budget
+}
+
+// SetConversationMode selects whether the history is resent locally or held by OpenAI
+func (p *Pipeline) SetConversationMode(mode string) {
+	p.conversationMode = mode
+	p.sessionMgr.SetConversationMode(mode)
+}
+
+// SetReasoningEffort sets the reasoning effort sent to models that support it
+func (p *Pipeline) SetReasoningEffort(effort string) {
+	p.reasoningEffort = effort
+	p.client.SetReasoningEffort(effort)
+}
+
+// SetUsageLimiter shares rate limits and a spend cap with the other pipelines of a batch
+func (p *Pipeline) SetUsageLimiter(limiter *UsageLimiter) {
+	p.client.SetUsageLimiter(limiter)
+}
+
+// SetHistoryStrategy selects how much of the conversation is resent on each iterative request
+func (p *Pipeline) SetHistoryStrategy(name string, turns int) error {
+	if turns <= 0 {
+		turns = DefaultHistoryTurns
+	}
+	strategy, err := NewHistoryStrategy(name, turns, p.client)
+	if err != nil {
+		return err
+	}
+	p.historyTurns = 0
+	if strategy.Name() == HistoryLastTurns || strategy.Name() == HistorySummarised {
+		p.historyTurns = turns
+	}
+	p.sessionMgr.SetHistoryStrategy(strategy)
+	return nil
+}
+
+// SetPromptTemplates selects the template set used to build the initial and feedback prompts
+func (p *Pipeline) SetPromptTemplates(name string) error {
+	templates, err := LoadPromptTemplates(p.basePath, name)
+	if err != nil {
+		return err
+	}
+	p.templates = templates
+	return nil
+}
+
+// SetFewShot adds n examples from the store to the initial prompt, chosen with the given strategy
+func (p *Pipeline) SetFewShot(store *ExampleStore, n int, strategy string, seed int64) error {
+	if !ValidShotStrategy(strategy) {
+		return fmt.Errorf("invalid shot strategy '%s'. Use 'fixed', 'random' or 'similar'", strategy)
+	}
+	p.exampleStore = store
+	p.shots = n
+	p.shotStrategy = strategy
+	p.shotSeed = seed
+	return nil
+}
+
+// SetModelRegistry loads the model capabilities from the embedded registry merged with the given file
+func (p *Pipeline) SetModelRegistry(path string) error {
+	registry, err := LoadModelRegistry(path)
+	if err != nil {
+		return err
+	}
+	p.client.SetModelRegistry(registry)
+	return nil
+}
+
+// SetSessionStore enables persisting iterative sessions; config is stored so the run can be resumed
+func (p *Pipeline) SetSessionStore(store *SessionStore, config PipelineConfig) {
+	p.sessionStore = store
+	p.runConfig = config
+}
+
+// SetStructuredOutput makes the model answer with a JSON list of statements instead of a code block
+func (p *Pipeline) SetStructuredOutput(enabled bool) {
+	p.structuredOutput = enabled
+	if enabled {
+		p.client.SetResponseFormat(SQLResponseFormat())
+	} else {
+		p.client.SetResponseFormat(nil)
+	}
+}
+
 func (p *Pipeline) savePromptToDebugFile(promptType, content string) {
 	if !p.debugPrompt || p.debugFile == "" {
 		return
@@ -134,6 +298,55 @@ func (p *Pipeline) printIterationResult(iteration int, testResult models.TestFil
 
 	fmt.Printf("Iteration %d: Parse %.1f%% | Execution %.1f%% | Overall %.1f%%\n",
 		iteration, parseRate, execRate, overall)
+	if testResult.Offline {
+		fmt.Printf("  └─ Offline: %d of %d parsed statements passed the semantic analysis, none executed\n",
+			testResult.AnalyzedCount, testResult.ParsedCount)
+	}
+}
+
+// requestResponse sends a prompt and, when the model stops because of the token limit,
+// asks it to continue in the same session and stitches the chunks together.
+// The returned TruncationInfo is nil when the first response was complete.
+func (p *Pipeline) requestResponse(sessionID, prompt, label string) (string, *TruncationInfo, error) {
+	response, err := p.sessionMgr.SendMessageWithResponse(sessionID, prompt)
+	if err != nil {
+		return "", nil, err
+	}
+	content := response.Content
+	if response.FinishReason != FinishReasonLength {
+		return content, nil, nil
+	}
+
+	truncation := &TruncationInfo{
+		Truncated:     true,
+		FinishReasons: []string{response.FinishReason},
+	}
+
+	for truncation.Continuations < p.maxContinuations {
+		fmt.Printf("  └─ Response truncated by token limit, requesting continuation %d/%d...\n",
+			truncation.Continuations+1, p.maxContinuations)
+		p.savePromptToDebugFile(fmt.Sprintf("CONTINUATION PROMPT (%s)", label), ContinuationPrompt)
+
+		response, err = p.sessionMgr.SendMessageWithResponse(sessionID, ContinuationPrompt)
+		if err != nil {
+			return "", truncation, fmt.Errorf("failed to request continuation: %w", err)
+		}
+		truncation.Continuations++
+		truncation.FinishReasons = append(truncation.FinishReasons, response.FinishReason)
+		p.savePromptToDebugFile(fmt.Sprintf("AI CONTINUATION (%s)", label), response.Content)
+
+		content = stitchContinuation(content, response.Content)
+		if response.FinishReason != FinishReasonLength {
+			truncation.Recovered = true
+			break
+		}
+	}
+
+	if !truncation.Recovered {
+		fmt.Printf("  └─ Warning: response still truncated after %d continuations\n", truncation.Continuations)
+	}
+
+	return content, truncation, nil
 }
 
 func (p *Pipeline) RunSingleShot() (*PipelineResult, error) {
@@ -144,47 +357,70 @@ func (p *Pipeline) RunSingleShot() (*PipelineResult, error) {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
-	initialPrompt, err := p.promptReader.ReadPromptFile()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read prompt: %w", err)
+	outputInstructions := ""
+	if p.structuredOutput {
+		outputInstructions = StructuredOutputInstructions
 	}
-
-	if p.moreContextEnabled {
-		guidelines, err := p.promptReader.ReadGuidelinesFile()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read guidelines: %w", err)
-		}
-		initialPrompt = initialPrompt + "\n\n" + guidelines
+	initialPrompt, err := p.buildInitialPrompt(outputInstructions)
+	if err != nil {
+		return nil, err
 	}
 
 	p.savePromptToDebugFile("INITIAL PROMPT (Single Shot)", initialPrompt)
 
+	var (
+		generatedSQL string
+		testResult   models.TestFileResult
+		truncation   *TruncationInfo
+		extraction   *ExtractionInfo
+		candidates   []CandidateScore
+	)
+
 	fmt.Printf("  └─ Sending prompt to AI...\n")
 	aiStart := time.Now()
-	response, err := p.sessionMgr.SendMessage(session.ID, initialPrompt)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send message to OpenAI: %w", err)
-	}
-	fmt.Printf("  └─ [%.3fs] AI response received\n", time.Since(aiStart).Seconds())
+	if p.candidates > 1 {
+		outcome, err := p.requestCandidates(session.ID, initialPrompt, "Single Shot")
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample candidates: %w", err)
+		}
+		fmt.Printf("  └─ [%.3fs] Candidates received and tested\n", time.Since(aiStart).Seconds())
+		generatedSQL, testResult = outcome.sql, outcome.testResult
+		truncation, extraction, candidates = outcome.truncation, outcome.extraction, outcome.scores
+	} else {
+		response, responseTruncation, err := p.requestResponse(session.ID, initialPrompt, "Single Shot")
+		if err != nil {
+			return nil, fmt.Errorf("failed to send message to OpenAI: %w", err)
+		}
+		fmt.Printf("  └─ [%.3fs] AI response received\n", time.Since(aiStart).Seconds())
+		truncation = responseTruncation
 
-	p.savePromptToDebugFile("AI RESPONSE (Single Shot)", response)
+		p.savePromptToDebugFile("AI RESPONSE (Single Shot)", response)
 
-	generatedSQL := p.promptReader.ExtractSQLFromResponse(response)
+		generatedSQL, extraction, err = p.extractSQL(session.ID, response, "Single Shot")
+		if err != nil {
+			return nil, err
+		}
 
-	testStart := time.Now()
-	testResult, err := p.testSQLString(generatedSQL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to test SQL: %w", err)
+		testStart := time.Now()
+		testResult, err = p.testSQLString(generatedSQL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to test SQL: %w", err)
+		}
+		fmt.Printf("  └─ [%.3fs] SQL testing completed\n", time.Since(testStart).Seconds())
 	}
-	fmt.Printf("  └─ [%.3fs] SQL testing completed\n", time.Since(testStart).Seconds())
 
-	success := len(testResult.ParseErrors) == 0 && len(testResult.ExecutionErrors) == 0
+	success := testSucceeded(testResult)
 
 	iterationResult := IterationResult{
 		Iteration:    1,
 		TestResults:  testResult,
 		Success:      success,
 		GeneratedSQL: generatedSQL,
+		Truncation:   truncation,
+		Extraction:   extraction,
+		Candidates:   candidates,
+		Score:        p.score(testResult),
+		Guidelines:   p.initialGuidelines,
 	}
 
 	p.printIterationResult(1, testResult)
@@ -202,14 +438,36 @@ func (p *Pipeline) RunSingleShot() (*PipelineResult, error) {
 		Success:          success,
 		Messages:         allMessages,
 		TotalTime:        time.Since(start),
-		TokensUsed:       0,
+		TokensUsed:       session.TotalTokens,
+		PromptTokens:     session.PromptTokens,
+		CompletionTokens: session.CompletionTokens,
 		ExecutionMode:    "single",
+		StopReason:       finalStopReason(testResult),
 		Timestamp:        time.Now(),
 	}
+	p.applyBestIteration(result)
 
 	return result, nil
 }
 
+// iterativeState holds the progress of an iterative run, persisted after every step
+type iterativeState struct {
+	session          *ConversationSession
+	initialPrompt    string
+	iterationResults []IterationResult
+
+	// SQL extracted from the latest response, waiting to be evaluated
+	pending      bool
+	generatedSQL string
+	truncation   *TruncationInfo
+	extraction   *ExtractionInfo
+	candidates   []CandidateScore
+	// guidelines lists the guideline sections retrieved for the prompt that produced the pending SQL
+	guidelines []string
+	// evaluated is set when the pending SQL was already tested while choosing between candidates
+	evaluated *models.TestFileResult
+}
+
 func (p *Pipeline) RunIterative() (*PipelineResult, error) {
 	start := time.Now()
 
@@ -218,132 +476,261 @@ func (p *Pipeline) RunIterative() (*PipelineResult, error) {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
-	initialPrompt, err := p.promptReader.ReadPromptFile()
+	outputInstructions := ""
+	if p.structuredOutput {
+		outputInstructions = StructuredOutputInstructions
+	}
+	initialPrompt, err := p.buildInitialPrompt(outputInstructions)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read prompt: %w", err)
+		return nil, err
 	}
 
-	if p.moreContextEnabled {
-		guidelines, err := p.promptReader.ReadGuidelinesFile()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read guidelines: %w", err)
-		}
-		initialPrompt = initialPrompt + "\n\n" + guidelines
+	p.savePromptToDebugFile("INITIAL PROMPT (Iterative)", initialPrompt)
+
+	state := &iterativeState{
+		session:       session,
+		initialPrompt: initialPrompt,
+		guidelines:    p.initialGuidelines,
 	}
+	if p.sessionStore != nil {
+		fmt.Printf("  └─ Session %s persisted to %s\n", session.ID, p.sessionStore.Path(session.ID))
+	}
+	p.persistState(state, false)
 
-	p.savePromptToDebugFile("INITIAL PROMPT (Iterative)", initialPrompt)
+	return p.runIterations(state, start)
+}
+
+// ResumeIterative continues a persisted iterative session from its last completed step
+// without re-sending the prompts that were already answered
+func (p *Pipeline) ResumeIterative(snapshot *PersistedSession) (*PipelineResult, error) {
+	start := time.Now()
 
-	var generatedSQL string
-	var testResult models.TestFileResult
-	var allMessages []ConversationMessage
-	var iterationResults []IterationResult
-	totalTokens := 0
+	if snapshot.Completed {
+		return nil, fmt.Errorf("session %s already completed", snapshot.Session.ID)
+	}
 
-	// First iteration - send initial prompt
-	fmt.Printf("  └─ Sending initial prompt to AI...\n")
-	aiInitialStart := time.Now()
-	response, err := p.sessionMgr.SendMessage(session.ID, initialPrompt)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send initial message: %w", err)
+	session := p.sessionMgr.RestoreSession(snapshot.Session, snapshot.Messages)
+	p.fewShot = snapshot.FewShot
+	state := &iterativeState{
+		session:          session,
+		initialPrompt:    snapshot.InitialPrompt,
+		iterationResults: snapshot.IterationResults,
+		pending:          snapshot.Pending,
+		generatedSQL:     snapshot.PendingSQL,
+		truncation:       snapshot.PendingTruncation,
+		extraction:       snapshot.PendingExtraction,
+		candidates:       snapshot.PendingCandidates,
+		guidelines:       snapshot.PendingGuidelines,
 	}
 
-	// Save initial AI response to debug file if enabled
-	p.savePromptToDebugFile("AI RESPONSE (Initial - Iterative)", response)
+	fmt.Printf("  └─ Resuming session %s after %d completed iteration(s)\n", session.ID, len(state.iterationResults))
+
+	return p.runIterations(state, start)
+}
 
-	generatedSQL = p.promptReader.ExtractSQLFromResponse(response)
+// runIterations drives the evaluate/feedback loop from the current state until success or maxIterations
+func (p *Pipeline) runIterations(state *iterativeState, start time.Time) (*PipelineResult, error) {
+	session := state.session
+	stopReason := ""
 
-	fmt.Printf("  └─ [%.3fs] Initial AI response received\n", time.Since(aiInitialStart).Seconds())
+	for iteration := len(state.iterationResults) + 1; iteration <= p.maxIterations; iteration++ {
+		if !state.pending {
+			if err := p.requestIterationSQL(state, iteration); err != nil {
+				return nil, err
+			}
+			p.persistState(state, false)
+		}
 
-	for iteration := 1; iteration <= p.maxIterations; iteration++ {
 		iterationStart := time.Now()
 
-		// Test the current SQL
-		testResult, err = p.testSQLString(generatedSQL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to test SQL on iteration %d: %w", iteration, err)
+		// Test the current SQL, unless it was tested while sampling candidates
+		var testResult models.TestFileResult
+		if state.evaluated != nil {
+			testResult = *state.evaluated
+		} else {
+			var err error
+			testResult, err = p.testSQLString(state.generatedSQL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to test SQL on iteration %d: %w", iteration, err)
+			}
 		}
 
 		// Check if we have success
-		success := len(testResult.ParseErrors) == 0 && len(testResult.ExecutionErrors) == 0
+		success := testSucceeded(testResult)
 
 		// Store iteration result
 		iterationResult := IterationResult{
 			Iteration:    iteration,
 			TestResults:  testResult,
 			Success:      success,
-			GeneratedSQL: generatedSQL,
+			GeneratedSQL: state.generatedSQL,
+			Truncation:   state.truncation,
+			Extraction:   state.extraction,
+			Candidates:   state.candidates,
+			Score:        p.score(testResult),
+			ResponseID:   session.LastResponseID,
+			Guidelines:   state.guidelines,
 		}
-		iterationResults = append(iterationResults, iterationResult)
+		history, _ := p.sessionMgr.GetConversationHistory(session.ID)
+		iterationResult.HistoryLength = len(history)
+		state.iterationResults = append(state.iterationResults, iterationResult)
+		state.pending = false
+		state.generatedSQL = ""
+		state.truncation = nil
+		state.extraction = nil
+		state.candidates = nil
+		state.guidelines = nil
+		state.evaluated = nil
 
 		// Print iteration result in real-time
 		p.printIterationResult(iteration, testResult)
 		fmt.Printf("  └─ [%.3fs] Iteration %d completed\n", time.Since(iterationStart).Seconds(), iteration)
 
-		if success {
-			// Get final conversation history
-			allMessages, _ = p.sessionMgr.GetConversationHistory(session.ID)
-
-			result := &PipelineResult{
-				SessionID:        session.ID,
-				ConversationID:   session.ConversationID,
-				InitialPrompt:    initialPrompt,
-				GeneratedSQL:     generatedSQL,
-				TestResults:      testResult,
-				Iterations:       iteration,
-				IterationResults: iterationResults,
-				Success:          true,
-				Messages:         allMessages,
-				TotalTime:        time.Since(start),
-				TokensUsed:       totalTokens,
-				ExecutionMode:    "iterative",
-				Timestamp:        time.Now(),
-			}
-
-			return result, nil
+		if success || analysisPassed(testResult) {
+			break
 		}
-
-		// If not successful and we have more iterations, send test results as feedback
-		if iteration < p.maxIterations {
-			aiStart := time.Now()
-			testResultsString := p.formatTestResultsForPrompt(testResult)
-
-			// Save feedback prompt to debug file if enabled
-			p.savePromptToDebugFile(fmt.Sprintf("PROMPT (Iteration %d)", iteration+1), testResultsString)
-
-			response, err = p.sessionMgr.SendMessage(session.ID, testResultsString)
-			if err != nil {
-				return nil, fmt.Errorf("failed to send feedback on iteration %d: %w", iteration, err)
-			}
-
-			generatedSQL = p.promptReader.ExtractSQLFromResponse(response)
-
-			fmt.Printf("  └─ [%.3fs] AI response received for iteration %d\n", time.Since(aiStart).Seconds(), iteration+1)
+		if stopReason = p.stopReason(state); stopReason != "" {
+			break
+		}
+		if _, err := p.rollbackIfRegressed(state); err != nil {
+			return nil, err
 		}
+		p.persistState(state, false)
+	}
+
+	if len(state.iterationResults) == 0 {
+		return nil, fmt.Errorf("no iterations were run")
 	}
+	p.persistState(state, true)
 
 	// Get final conversation history
-	allMessages, _ = p.sessionMgr.GetConversationHistory(session.ID)
+	allMessages, _ := p.sessionMgr.GetConversationHistory(session.ID)
+	last := state.iterationResults[len(state.iterationResults)-1]
 
-	// Max iterations reached without success
 	result := &PipelineResult{
 		SessionID:        session.ID,
 		ConversationID:   session.ConversationID,
-		InitialPrompt:    initialPrompt,
-		GeneratedSQL:     generatedSQL,
-		TestResults:      testResult,
-		Iterations:       p.maxIterations,
-		IterationResults: iterationResults,
-		Success:          false,
+		InitialPrompt:    state.initialPrompt,
+		GeneratedSQL:     last.GeneratedSQL,
+		TestResults:      last.TestResults,
+		Iterations:       len(state.iterationResults),
+		IterationResults: state.iterationResults,
+		Success:          last.Success,
 		Messages:         allMessages,
 		TotalTime:        time.Since(start),
-		TokensUsed:       totalTokens,
+		TokensUsed:       session.TotalTokens,
+		PromptTokens:     session.PromptTokens,
+		CompletionTokens: session.CompletionTokens,
 		ExecutionMode:    "iterative",
+		StopReason:       stopReason,
 		Timestamp:        time.Now(),
 	}
+	if result.StopReason == "" {
+		result.StopReason = finalStopReason(last.TestResults)
+	}
+	p.applyBestIteration(result)
 
 	return result, nil
 }
 
+// requestIterationSQL sends the initial prompt (first iteration) or the feedback on the previous
+// iteration and stores the extracted SQL as pending
+func (p *Pipeline) requestIterationSQL(state *iterativeState, iteration int) error {
+	aiStart := time.Now()
+
+	var prompt, label string
+	if iteration == 1 {
+		fmt.Printf("  └─ Sending initial prompt to AI...\n")
+		prompt = state.initialPrompt
+		label = "Initial - Iterative"
+	} else {
+		previous := feedbackSource(state.iterationResults)
+		feedback, guidelines, err := p.formatTestResultsForPrompt(previous)
+		if err != nil {
+			return err
+		}
+		prompt = feedback
+		state.guidelines = guidelineTitles(guidelines)
+		label = fmt.Sprintf("Iteration %d", iteration)
+
+		// Save feedback prompt to debug file if enabled
+		p.savePromptToDebugFile(fmt.Sprintf("PROMPT (Iteration %d)", iteration), prompt)
+	}
+
+	if p.candidates > 1 {
+		outcome, err := p.requestCandidates(state.session.ID, prompt, label)
+		if err != nil {
+			return fmt.Errorf("failed to sample candidates on iteration %d: %w", iteration, err)
+		}
+		state.pending = true
+		state.generatedSQL = outcome.sql
+		state.truncation = outcome.truncation
+		state.extraction = outcome.extraction
+		state.candidates = outcome.scores
+		state.evaluated = &outcome.testResult
+		fmt.Printf("  └─ [%.3fs] Candidates received and tested for iteration %d\n", time.Since(aiStart).Seconds(), iteration)
+		return nil
+	}
+
+	response, truncation, err := p.requestResponse(state.session.ID, prompt, label)
+	if err != nil {
+		if iteration == 1 {
+			return fmt.Errorf("failed to send initial message: %w", err)
+		}
+		return fmt.Errorf("failed to send feedback on iteration %d: %w", iteration-1, err)
+	}
+
+	if iteration == 1 {
+		// Save initial AI response to debug file if enabled
+		p.savePromptToDebugFile("AI RESPONSE (Initial - Iterative)", response)
+	}
+
+	generatedSQL, extraction, err := p.extractSQL(state.session.ID, response, label)
+	if err != nil {
+		return err
+	}
+
+	state.pending = true
+	state.generatedSQL = generatedSQL
+	state.truncation = truncation
+	state.extraction = extraction
+
+	if iteration == 1 {
+		fmt.Printf("  └─ [%.3fs] Initial AI response received\n", time.Since(aiStart).Seconds())
+	} else {
+		fmt.Printf("  └─ [%.3fs] AI response received for iteration %d\n", time.Since(aiStart).Seconds(), iteration)
+	}
+	return nil
+}
+
+// persistState writes the current progress to the session store, if one is configured
+func (p *Pipeline) persistState(state *iterativeState, completed bool) {
+	if p.sessionStore == nil {
+		return
+	}
+
+	messages, _ := p.sessionMgr.GetConversationHistory(state.session.ID)
+	snapshot := &PersistedSession{
+		Session:           *state.session,
+		Config:            p.runConfig,
+		InitialPrompt:     state.initialPrompt,
+		Messages:          messages,
+		IterationResults:  state.iterationResults,
+		Pending:           state.pending,
+		PendingSQL:        state.generatedSQL,
+		PendingTruncation: state.truncation,
+		PendingExtraction: state.extraction,
+		PendingCandidates: state.candidates,
+		PendingGuidelines: state.guidelines,
+		FewShot:           p.fewShot,
+		Completed:         completed,
+	}
+
+	if err := p.sessionStore.Save(snapshot); err != nil {
+		fmt.Printf("Warning: Failed to persist session %s: %v\n", state.session.ID, err)
+	}
+}
+
 // testSQLString tests a SQL string using the existing testing infrastructure
 func (p *Pipeline) testSQLString(sqlContent string) (models.TestFileResult, error) {
 	// We'll use the string-based evaluation we already created
@@ -365,13 +752,21 @@ func (p *Pipeline) evaluateSQLString(content string, filename string) (*Evaluati
 		ErrorCategories: make(map[string]int),
 	}
 
-	statements, err := tools.ExtractStatementsFromString(content)
-	if err != nil {
-		return nil, fmt.Errorf("extract statements: %w", err)
-	}
-	fr.TotalStatements = len(statements)
+	postgres := p.targetDialect == TargetDialectPostgreSQL
 
-	parseResults := tools.ParseStatementsWithMemefish(statements, filename)
+	var parseResults []models.ParseResult
+	if postgres {
+		statements := tools.ExtractPostgresStatements(content)
+		fr.TotalStatements = len(statements)
+		parseResults = tools.ParseStatementsPostgres(statements)
+	} else {
+		statements, err := tools.ExtractStatementsFromString(content)
+		if err != nil {
+			return nil, fmt.Errorf("extract statements: %w", err)
+		}
+		fr.TotalStatements = len(statements)
+		parseResults = tools.ParseStatementsWithMemefish(statements, filename)
+	}
 
 	var validStatements []string
 	for _, pr := range parseResults {
@@ -393,36 +788,64 @@ func (p *Pipeline) evaluateSQLString(content string, filename string) (*Evaluati
 			fr.ParseErrors = append(fr.ParseErrors, errMsg)
 			fr.ParseErrorDetails = append(fr.ParseErrorDetails, models.ParseError{Statement: pr.Statement, Error: errMsg})
 			errType := tools.CategorizeMemefishError(errMsg)
+			if postgres {
+				errType = tools.CategorizePostgresParseError(errMsg)
+			}
 			fr.ParseErrorCodes[errType]++
 		}
 	}
 
-	if len(validStatements) > 0 {
-		db, terminate, err := tools.GetDBWithIdentifier(true, p.uniqueID)
+	if !postgres && p.semanticCheck != SemanticCheckOff {
+		validStatements = checkSemantics(&fr, validStatements)
+	}
+
+	if p.semanticCheck == SemanticCheckOffline {
+		// There is no database to run the statements on, they are only counted as analyzed
+		fr.Offline = true
+		fr.AnalyzedCount = len(validStatements)
+		for _, expected := range p.expectedResults {
+			fr.QueryChecks = append(fr.QueryChecks, models.QueryCheck{
+				Query:    expected.Query,
+				Expected: expected.Rows,
+				Error:    "not run in offline semantic check mode",
+			})
+		}
+	} else if len(validStatements) > 0 {
+		// Each evaluation gets a fresh database on the shared emulators, dropped afterwards
+		pool := tools.DefaultEmulatorPool()
+		if postgres {
+			pool = tools.DefaultPGEmulatorPool()
+		}
+		db, release, err := pool.AcquireDB()
 		if err != nil {
 			return nil, fmt.Errorf("connect DB: %w", err)
 		}
-		defer func() {
-			_ = db.Close()
-			if terminate != nil {
-				terminate()
-			}
-		}()
+		defer release()
 
 		r := repo.NewSpannerRepo(db)
-		_ = r.CleanupDB()
 
 		executor := repo.NewSQLExecutor(db, r)
+		if postgres {
+			executor = repo.NewPostgreSQLExecutor(db, r)
+		}
 		defer func() { _ = executor.Cleanup() }()
 
 		execResult, _ := executor.ExecuteStatements(validStatements)
 		if execResult != nil {
 			fr.ExecutedCount = execResult.ExecutedCount
-			fr.FailedCount = len(execResult.Errors)
+			fr.FailedCount += len(execResult.Errors)
 			for _, e := range execResult.Errors {
 				errMsg := e.Error()
 				fr.ExecutionErrors = append(fr.ExecutionErrors, errMsg)
 				code := tools.ExtractSpannerErrorCode(errMsg)
+				var stmtErr *repo.StatementError
+				if errors.As(e, &stmtErr) {
+					fr.ExecutionErrorDetails = append(fr.ExecutionErrorDetails, models.ExecutionError{
+						Statement:   stmtErr.Statement,
+						Code:        code,
+						Description: errMsg,
+					})
+				}
 				if code != "" {
 					fr.ErrorCodes[code]++
 					if code == "InvalidArgument" {
@@ -436,6 +859,24 @@ func (p *Pipeline) evaluateSQLString(content string, filename string) (*Evaluati
 				}
 			}
 		}
+
+		if len(p.expectedResults) > 0 {
+			fr.QueryChecks = runQueryChecks(db, p.expectedResults)
+		}
+	} else {
+		for _, expected := range p.expectedResults {
+			fr.QueryChecks = append(fr.QueryChecks, models.QueryCheck{
+				Query:    expected.Query,
+				Expected: expected.Rows,
+				Error:    "no statement could be executed",
+			})
+		}
+	}
+
+	if !postgres {
+		if source := p.sourceSQL(); source != "" {
+			fr.SchemaFidelity = tools.CompareSchemaFidelity(source, content)
+		}
 	}
 
 	fr.ExecutionTime = time.Since(start)
@@ -447,106 +888,129 @@ func (p *Pipeline) evaluateSQLString(content string, filename string) (*Evaluati
 	return &EvaluationResult{FileResult: fr}, nil
 }
 
-// formatTestResultsForPrompt formats test results into a string for the prompt
-func (p *Pipeline) formatTestResultsForPrompt(fr models.TestFileResult) string {
-	var results strings.Builder
-
-	results.WriteString("The generated sql code has gone through some testing, here are the results:\n\n")
+// sourceSQL returns the PostgreSQL source of the prompt, empty when it cannot be read
+func (p *Pipeline) sourceSQL() string {
+	prompt := p.prompt
+	if prompt == "" {
+		var err error
+		if prompt, err = p.promptReader.ReadPromptFile(); err != nil {
+			return ""
+		}
+	}
+	_, source := tools.SplitPrompt(prompt)
+	return source
+}
 
-	if !p.shortPrompts {
-		// Full format - include all summaries and statistics
-		results.WriteString(fmt.Sprintf("Total statements: %d\n", fr.TotalStatements))
-		results.WriteString(fmt.Sprintf("Successfully parsed: %d\n", fr.ParsedCount))
-		results.WriteString(fmt.Sprintf("Parse errors: %d\n", len(fr.ParseErrors)))
-		results.WriteString(fmt.Sprintf("Successfully executed: %d\n", fr.ExecutedCount))
-		results.WriteString(fmt.Sprintf("Execution errors: %d\n", len(fr.ExecutionErrors)))
+// postgresDialectPrompt retargets a prompt written for GoogleSQL at Spanner's PostgreSQL interface
+func postgresDialectPrompt(prompt string) string {
+	const target = "Spanner's PostgreSQL interface (the PostgreSQL dialect of Spanner, reached through PGAdapter)"
+	if strings.Contains(prompt, "GoogleSQL") {
+		return strings.ReplaceAll(prompt, "GoogleSQL", target)
+	}
+	instructions, sourceSQL := tools.SplitPrompt(prompt)
+	return strings.TrimSpace(instructions+" The translation must target "+target+".") + "\n\n" + sourceSQL
+}
 
-		if fr.TotalStatements > 0 {
-			parseRate := float64(fr.ParsedCount) / float64(fr.TotalStatements) * 100
-			execRate := 0.0
-			if fr.ParsedCount > 0 {
-				execRate = float64(fr.ExecutedCount) / float64(fr.ParsedCount) * 100
-			}
-			overall := float64(fr.ExecutedCount) / float64(fr.TotalStatements) * 100
-			results.WriteString(fmt.Sprintf("Parse success rate: %.1f%%\n", parseRate))
-			results.WriteString(fmt.Sprintf("Execution success rate (of parsed): %.1f%%\n", execRate))
-			results.WriteString(fmt.Sprintf("Overall success rate: %.1f%%\n", overall))
-		}
-
-		if len(fr.ParseErrorCodes) > 0 {
-			results.WriteString("\n")
-			results.WriteString("Parse Error Summary:\n")
-			for typ, cnt := range fr.ParseErrorCodes {
-				desc := tools.GetParseErrorDescription(typ)
-				results.WriteString(fmt.Sprintf("- %s: %d (%s)\n", typ, cnt, desc))
-			}
+// buildInitialPrompt renders the initial prompt from prompt.txt, the guidelines when more
+// context is enabled and the instructions describing the expected answer format
+func (p *Pipeline) buildInitialPrompt(outputInstructions string) (string, error) {
+	prompt := p.prompt
+	if prompt == "" {
+		var err error
+		prompt, err = p.promptReader.ReadPromptFile()
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt: %w", err)
 		}
+	}
 
-		if len(fr.ErrorCodes) > 0 {
-			results.WriteString("\n")
-			results.WriteString("Execution Error Code Summary:\n")
-			for code, cnt := range fr.ErrorCodes {
-				desc := tools.GetErrorCodeDescription(code)
-				results.WriteString(fmt.Sprintf("- %s: %d (%s)\n", code, cnt, desc))
-			}
-		}
+	if p.targetDialect == TargetDialectPostgreSQL {
+		prompt = postgresDialectPrompt(prompt)
+	}
 
-		if len(fr.ErrorCategories) > 0 {
-			results.WriteString("\n")
-			results.WriteString("Execution Error Categories:\n")
-			for cat, cnt := range fr.ErrorCategories {
-				desc := tools.GetErrorCategoryDescription(cat)
-				results.WriteString(fmt.Sprintf("- %s: %d (%s)\n", cat, cnt, desc))
-			}
+	instructions, sourceSQL := tools.SplitPrompt(prompt)
+	data := InitialPromptData{
+		Prompt:             prompt,
+		Instructions:       instructions,
+		SourceSQL:          sourceSQL,
+		TargetDialect:      p.targetDialect,
+		OutputInstructions: outputInstructions,
+	}
+
+	if p.exampleStore != nil && p.shots > 0 {
+		examples, selection, err := p.exampleStore.Select(p.shots, p.shotStrategy, p.shotSeed, sourceSQL)
+		if err != nil {
+			return "", err
 		}
+		data.Examples = examples
+		p.fewShot = &selection
+		fmt.Printf("  └─ Using %d few-shot example(s) (%s): %s\n", len(examples), selection.Strategy, strings.Join(selection.Examples, ", "))
 	}
 
-	// Error details - for short prompts, only show the first line of each statement
-	if len(fr.ParseErrors) > 0 {
-		results.WriteString("\n")
-		results.WriteString("Parse Errors:\n")
-		for _, e := range fr.ParseErrorDetails {
-			stmt := e.Statement
-			if p.shortPrompts {
-				// For short prompts, only show the first line
-				lines := strings.Split(stmt, "\n")
-				stmt = lines[0]
-				if len(lines) > 1 {
-					stmt += "..."
-				}
-			} else {
-				// For full prompts, use the original truncation logic
-				if len(stmt) > 200 {
-					stmt = stmt[:100] + "..." + stmt[len(stmt)-100:]
-				}
+	if p.moreContextEnabled {
+		guidelines, err := p.promptReader.ReadGuidelinesFile()
+		if err != nil {
+			return "", fmt.Errorf("failed to read guidelines: %w", err)
+		}
+		data.Guidelines, err = p.templates.RenderGuidelines(GuidelinesData{
+			Guidelines: guidelines,
+			Sections:   splitGuidelineSections(guidelines),
+		})
+		if err != nil {
+			return "", err
+		}
+	} else if p.guidelineMode == GuidelinesRetrieved {
+		sections, err := p.retrieveGuidelines(tagsForSource(sourceSQL))
+		if err != nil {
+			return "", err
+		}
+		if len(sections) > 0 {
+			data.Guidelines, err = p.templates.RenderGuidelines(GuidelinesData{
+				Guidelines: formatGuidelineSections(sections),
+				Sections:   sections,
+			})
+			if err != nil {
+				return "", err
 			}
-			results.WriteString(fmt.Sprintf("- %s\n  Statement: %s\n", e.Error, stmt))
+			fmt.Printf("  └─ Added %d guideline section(s) predicted from the source SQL\n", len(sections))
 		}
+		p.initialGuidelines = guidelineTitles(sections)
 	}
 
-	if len(fr.ExecutionErrors) > 0 {
-		results.WriteString("\n")
-		results.WriteString("Execution Errors:\n")
-		for i, e := range fr.ExecutionErrors {
-			results.WriteString(fmt.Sprintf("%d. %s\n", i+1, e))
+	return p.templates.RenderInitial(data)
+}
+
+// formatTestResultsForPrompt formats the results of an iteration into a feedback prompt using
+// the configured feedback strategy. It also returns the guideline sections retrieved for the
+// observed error categories, if any were added.
+func (p *Pipeline) formatTestResultsForPrompt(previous IterationResult) (string, []GuidelineSection, error) {
+	ctx := FeedbackContext{
+		SQL:           previous.GeneratedSQL,
+		TestResults:   previous.TestResults,
+		TargetDialect: p.targetDialect,
+		ShortPrompts:  p.shortPrompts,
+		Templates:     p.templates,
+	}
+	if p.feedback.Name() == FeedbackGuidelines || p.guidelineMode == GuidelinesRetrieved {
+		sections, err := p.retrieveGuidelines(tagsForResult(previous.TestResults))
+		if err != nil {
+			return "", nil, err
 		}
+		ctx.Guidelines = sections
 	}
 
-	// Add AI-specific recommendations
-	recommendations := tools.GetAIRecommendations(fr)
-	if len(recommendations) > 0 {
-		results.WriteString("\n")
-		results.WriteString("=== AI AGENT RECOMMENDATIONS ===\n")
-		results.WriteString("ALWAYS: The response to this message should be a the entire sql code with fixes applied to it.\n")
-		for _, rec := range recommendations {
-			results.WriteString(rec + "\n")
-		}
-		results.WriteString("\n")
-		results.WriteString("TIP: Focus on fixing parse errors first, as they prevent execution.\n")
-		results.WriteString("TIP: Refer to Spanner SQL documentation for supported syntax and functions.\n")
+	feedback, err := p.feedback.Feedback(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to build %s feedback: %w", p.feedback.Name(), err)
 	}
 
-	return results.String()
+	// Strategies other than guidelines do not render the sections themselves
+	if p.feedback.Name() != FeedbackGuidelines && len(ctx.Guidelines) > 0 {
+		feedback += "\nRelevant guidelines:\n\n" + formatGuidelineSections(ctx.Guidelines) + "\n"
+	}
+	if len(ctx.Guidelines) > 0 {
+		fmt.Printf("  └─ Added %d guideline section(s) for the observed errors\n", len(ctx.Guidelines))
+	}
+	return feedback, ctx.Guidelines, nil
 }
 
 // SaveResultToFile saves a pipeline result to a file
@@ -662,16 +1126,35 @@ func (p *Pipeline) createExecutionMetrics(result *PipelineResult, mode string) *
 	// For single mode, we have only one iteration
 	if mode == "single" {
 		iteration := p.createIterationMetrics(1, result.TestResults)
+		if len(result.IterationResults) > 0 {
+			applyTruncationMetrics(&iteration, result.IterationResults[0].Truncation)
+			applyExtractionMetrics(&iteration, result.IterationResults[0].Extraction)
+			applyCandidateMetrics(&iteration, result.IterationResults[0].Candidates)
+			iteration.Guidelines = result.IterationResults[0].Guidelines
+		}
 		iterationResults = append(iterationResults, iteration)
 	} else {
 		// For iterative mode, process each iteration result
 		for _, iterResult := range result.IterationResults {
 			iteration := p.createIterationMetrics(iterResult.Iteration, iterResult.TestResults)
+			applyTruncationMetrics(&iteration, iterResult.Truncation)
+			applyExtractionMetrics(&iteration, iterResult.Extraction)
+			applyCandidateMetrics(&iteration, iterResult.Candidates)
+			iteration.RolledBack = iterResult.RolledBack
+			iteration.Guidelines = iterResult.Guidelines
 			iterationResults = append(iterationResults, iteration)
 		}
 	}
 
-	return &ExecutionMetrics{
+	hadTruncation := false
+	for _, iteration := range iterationResults {
+		if iteration.Truncated {
+			hadTruncation = true
+			break
+		}
+	}
+
+	metrics := &ExecutionMetrics{
 		ConversationID:     result.ConversationID,
 		Mode:               mode,
 		Model:              p.model,
@@ -679,9 +1162,62 @@ func (p *Pipeline) createExecutionMetrics(result *PipelineResult, mode string) *
 		TotalIterations:    result.Iterations,
 		ShortPrompts:       p.shortPrompts,
 		MoreContextEnabled: p.moreContextEnabled,
+		HadTruncation:      hadTruncation,
+		ToolCallCount:      len(result.ToolCalls),
+		StructuredOutput:   p.structuredOutput,
+		ConversationMode:   p.conversationMode,
+		PromptTokens:       result.PromptTokens,
+		TokensUsed:         result.TokensUsed,
+		EstimatedCostUSD:   p.client.Capabilities().EstimateCost(result.PromptTokens, result.CompletionTokens),
+		ReasoningEffort:    p.reasoningEffort,
+		FewShot:            p.fewShot,
+		Candidates:         p.candidates,
+		ScoreMetric:        p.scoreMetric,
+		StopReason:         result.StopReason,
+		TaskID:             p.taskID,
+		Experiment:         p.experiment,
+		FeedbackStrategy:   p.feedback.Name(),
+		GuidelineMode:      p.guidelineMode,
+		TargetDialect:      p.targetDialect,
+		SemanticCheck:      p.semanticCheck,
+		PromptTemplates:    p.templates.Name,
+		TemplateHash:       p.templates.Hash,
 		IterationResults:   iterationResults,
 		Timestamp:          time.Now(),
 	}
+
+	if len(result.IterationResults) > 0 {
+		metrics.FinalScore = result.IterationResults[len(result.IterationResults)-1].Score
+		best := result.IterationResults[p.bestIteration(result.IterationResults)]
+		metrics.BestIteration = best.Iteration
+		metrics.BestScore = best.Score
+		metrics.BestSuccess = best.Success
+		for _, iteration := range result.IterationResults {
+			if iteration.RolledBack {
+				metrics.Rollbacks++
+			}
+		}
+	}
+
+	if session, err := p.sessionMgr.GetSession(result.SessionID); err == nil && session.HistoryStrategy != "" {
+		metrics.HistoryStrategy = session.HistoryStrategy
+		metrics.HistoryTurns = p.historyTurns
+		metrics.PeakContextTokens = session.PeakContextTokens
+		metrics.HistoryTrimmed = session.HistoryTrimmed
+		metrics.HistorySummaries = session.HistorySummaries
+	}
+
+	metrics.SchemaFidelity = result.TestResults.SchemaFidelity
+	metrics.Offline = result.TestResults.Offline
+	metrics.Analyzed = result.TestResults.AnalyzedCount
+	metrics.QueriesTotal = len(result.TestResults.QueryChecks)
+	for _, check := range result.TestResults.QueryChecks {
+		if check.Passed {
+			metrics.QueriesPassed++
+		}
+	}
+
+	return metrics
 }
 
 // createIterationMetrics creates metrics for a single iteration
@@ -698,7 +1234,7 @@ func (p *Pipeline) createIterationMetrics(iterationNum int, testResults models.T
 		overall = float64(testResults.ExecutedCount) / float64(testResults.TotalStatements) * 100
 	}
 
-	success := len(testResults.ParseErrors) == 0 && len(testResults.ExecutionErrors) == 0
+	success := testSucceeded(testResults)
 
 	return IterationMetrics{
 		IterationNumber:      iterationNum,
@@ -713,3 +1249,31 @@ func (p *Pipeline) createIterationMetrics(iterationNum int, testResults models.T
 		Success:              success,
 	}
 }
+
+// applyTruncationMetrics copies truncation details of an iteration into its metrics
+func applyTruncationMetrics(metrics *IterationMetrics, truncation *TruncationInfo) {
+	if truncation == nil {
+		return
+	}
+	metrics.Truncated = truncation.Truncated
+	metrics.Continuations = truncation.Continuations
+}
+
+// applyExtractionMetrics records which extraction path produced the SQL of an iteration
+func applyExtractionMetrics(metrics *IterationMetrics, extraction *ExtractionInfo) {
+	if extraction == nil {
+		return
+	}
+	metrics.ExtractionMethod = extraction.Method
+	metrics.ExtractionWarnings = len(extraction.Warnings)
+}
+
+func applyCandidateMetrics(metrics *IterationMetrics, candidates []CandidateScore) {
+	metrics.Candidates = len(candidates)
+	for _, candidate := range candidates {
+		metrics.CandidateScores = append(metrics.CandidateScores, candidate.Score)
+		if candidate.Success {
+			metrics.CandidatesPassed++
+		}
+	}
+}
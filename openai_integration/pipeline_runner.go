@@ -11,16 +11,49 @@ import (
 
 // PipelineConfig holds configuration for running a pipeline instance
 type PipelineConfig struct {
-	Mode               string
-	MaxIterations      int
-	OutputFile         string
-	Verbose            bool
-	DebugPrompt        bool
-	SaveAccumulated    bool
-	ShortPrompts       bool
-	MoreContextEnabled bool
-	UniqueID           string
-	Model              string
+	Mode                 string
+	MaxIterations        int
+	OutputFile           string
+	Verbose              bool
+	DebugPrompt          bool
+	SaveAccumulated      bool
+	ShortPrompts         bool
+	MoreContextEnabled   bool
+	UniqueID             string
+	Model                string
+	MaxContinuations     int
+	ToolBudget           int
+	StructuredOutput     bool
+	PersistSession       bool
+	ResumeSessionID      string
+	ConversationMode     string
+	ModelRegistryPath    string
+	ReasoningEffort      string
+	HistoryStrategy      string
+	HistoryTurns         int
+	PromptTemplates      string
+	Shots                int
+	ShotStrategy         string
+	ShotSeed             int64
+	ExamplesFile         string
+	Candidates           int
+	ScoreMetric          string
+	RollbackOnRegression bool
+	StopPolicy           StopPolicy
+	FeedbackStrategy     string
+	GuidelineMode        string
+	// TargetDialect is GoogleSQL (default) or PostgreSQL
+	TargetDialect string
+	// SemanticCheck is off (default), on or offline
+	SemanticCheck string
+	// Benchmark task: Prompt replaces prompt.txt and ExpectedResults are checked after every evaluation
+	TaskID          string
+	Prompt          string
+	ExpectedResults []ExpectedQuery
+	// Experiment tags the saved metrics with the experiment cell this run belongs to
+	Experiment *ExperimentTag
+	// Limiter is shared by all runs of a batch to respect rate limits and the spend cap
+	Limiter *UsageLimiter `json:"-"`
 }
 
 // PipelineRunner encapsulates the logic for running a single pipeline instance
@@ -41,6 +74,25 @@ func NewPipelineRunner(config PipelineConfig, basePath string) *PipelineRunner {
 func (pr *PipelineRunner) Run() (*PipelineResult, error) {
 	start := time.Now()
 
+	// When resuming, the persisted configuration replaces the one given on the command line
+	var snapshot *PersistedSession
+	store := NewSessionStore(filepath.Join(pr.basePath, DefaultSessionsDir))
+	if pr.config.ResumeSessionID != "" {
+		var err error
+		snapshot, err = store.Load(pr.config.ResumeSessionID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading session to resume: %w", err)
+		}
+		if snapshot.Config.Mode != "iterative" {
+			return nil, fmt.Errorf("cannot resume session %s: resume is only supported in iterative mode", pr.config.ResumeSessionID)
+		}
+		resumed := snapshot.Config
+		resumed.Verbose = pr.config.Verbose
+		resumed.ResumeSessionID = pr.config.ResumeSessionID
+		resumed.PersistSession = true
+		pr.config = resumed
+	}
+
 	// Create pipeline
 	pipelineStart := time.Now()
 	pipeline, err := NewPipelineWithModel(pr.basePath, pr.config.MaxIterations, pr.config.Model, pr.config.Verbose)
@@ -50,6 +102,142 @@ func (pr *PipelineRunner) Run() (*PipelineResult, error) {
 	pipeline.SetDebugPrompt(pr.config.DebugPrompt)
 	pipeline.SetShortPrompts(pr.config.ShortPrompts)
 	pipeline.SetMoreContextEnabled(pr.config.MoreContextEnabled)
+	if pr.config.GuidelineMode != "" {
+		if pr.config.MoreContextEnabled && pr.config.GuidelineMode != GuidelinesAll {
+			return nil, fmt.Errorf("--more-context cannot be combined with the '%s' guideline mode", pr.config.GuidelineMode)
+		}
+		if err := pipeline.SetGuidelineMode(pr.config.GuidelineMode); err != nil {
+			return nil, err
+		}
+	}
+	if pr.config.MaxContinuations > 0 {
+		pipeline.SetMaxContinuations(pr.config.MaxContinuations)
+	}
+	if pr.config.ModelRegistryPath != "" {
+		if err := pipeline.SetModelRegistry(pr.config.ModelRegistryPath); err != nil {
+			return nil, fmt.Errorf("error loading model registry: %w", err)
+		}
+	}
+	if pr.config.ReasoningEffort != "" {
+		pipeline.SetReasoningEffort(pr.config.ReasoningEffort)
+	}
+	if pr.config.PromptTemplates != "" {
+		if err := pipeline.SetPromptTemplates(pr.config.PromptTemplates); err != nil {
+			return nil, fmt.Errorf("error loading prompt templates: %w", err)
+		}
+	}
+	if pr.config.Shots > 0 {
+		store, err := LoadExampleStore(pr.config.ExamplesFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading few-shot examples: %w", err)
+		}
+		strategy := pr.config.ShotStrategy
+		if strategy == "" {
+			strategy = ShotStrategyFixed
+		}
+		if err := pipeline.SetFewShot(store, pr.config.Shots, strategy, pr.config.ShotSeed); err != nil {
+			return nil, err
+		}
+	}
+	if pr.config.StructuredOutput && pr.config.Mode == "agent" {
+		// The agent submits its SQL through the submit_sql tool, there is no response to structure
+		return nil, fmt.Errorf("structured output is not supported in agent mode")
+	}
+	pipeline.SetStructuredOutput(pr.config.StructuredOutput)
+	if pr.config.ConversationMode != "" {
+		if !ValidConversationMode(pr.config.ConversationMode) {
+			return nil, fmt.Errorf("invalid conversation mode '%s'. Use 'local', 'conversations' or 'responses'", pr.config.ConversationMode)
+		}
+		pipeline.SetConversationMode(pr.config.ConversationMode)
+	}
+	if pr.config.Mode == "agent" && pipeline.conversationMode != ConversationModeLocal {
+		// Tool calls go through chat completions with the local history, a server-side conversation would be left unused
+		return nil, fmt.Errorf("agent mode requires the 'local' conversation mode")
+	}
+	if pr.config.HistoryStrategy != "" && pr.config.HistoryStrategy != HistoryFull {
+		if pipeline.conversationMode != ConversationModeLocal {
+			return nil, fmt.Errorf("history strategy '%s' requires the 'local' conversation mode", pr.config.HistoryStrategy)
+		}
+		if err := pipeline.SetHistoryStrategy(pr.config.HistoryStrategy, pr.config.HistoryTurns); err != nil {
+			return nil, err
+		}
+	}
+	if pr.config.ScoreMetric != "" || pr.config.RollbackOnRegression {
+		metric := pr.config.ScoreMetric
+		if metric == "" {
+			metric = MetricOverall
+		}
+		if pr.config.RollbackOnRegression && pipeline.conversationMode == ConversationModeConversations {
+			return nil, fmt.Errorf("rollback on regression is not supported in the 'conversations' conversation mode")
+		}
+		if err := pipeline.SetBestIteration(metric, pr.config.RollbackOnRegression); err != nil {
+			return nil, err
+		}
+	}
+	if pr.config.TargetDialect != "" {
+		if err := pipeline.SetTargetDialect(pr.config.TargetDialect); err != nil {
+			return nil, err
+		}
+	}
+	if pr.config.SemanticCheck != "" {
+		if err := pipeline.SetSemanticCheck(pr.config.SemanticCheck); err != nil {
+			return nil, err
+		}
+		if pr.config.SemanticCheck != SemanticCheckOff && pipeline.targetDialect == TargetDialectPostgreSQL {
+			return nil, fmt.Errorf("the semantic check only supports the %s dialect", TargetDialectGoogleSQL)
+		}
+		if pr.config.SemanticCheck == SemanticCheckOffline && pr.config.Mode == "agent" {
+			return nil, fmt.Errorf("agent mode needs the emulator and cannot run with the offline semantic check")
+		}
+	}
+	pipeline.SetStopPolicy(pr.config.StopPolicy)
+	if pr.config.Limiter != nil {
+		pipeline.SetUsageLimiter(pr.config.Limiter)
+	}
+	if pr.config.Prompt != "" {
+		pipeline.SetTask(pr.config.TaskID, pr.config.Prompt, pr.config.ExpectedResults)
+	}
+	if pr.config.Experiment != nil {
+		pipeline.SetExperiment(*pr.config.Experiment)
+	}
+	if pr.config.FeedbackStrategy != "" {
+		strategy, err := NewFeedbackStrategy(pr.config.FeedbackStrategy)
+		if err != nil {
+			return nil, err
+		}
+		pipeline.SetFeedbackStrategy(strategy)
+	}
+	if pipeline.targetDialect == TargetDialectPostgreSQL {
+		// The guidelines, the FIX hints of the error taxonomy and the few-shot examples are all
+		// written for GoogleSQL, so they would steer the model away from the requested dialect
+		if pr.config.Mode == "agent" {
+			return nil, fmt.Errorf("agent mode only supports the %s dialect", TargetDialectGoogleSQL)
+		}
+		if pipeline.guidelineMode != GuidelinesNone {
+			return nil, fmt.Errorf("the Spanner guidelines only cover the %s dialect", TargetDialectGoogleSQL)
+		}
+		if name := pipeline.feedback.Name(); name == FeedbackGuidelines || name == FeedbackFixList {
+			return nil, fmt.Errorf("the '%s' feedback strategy only supports the %s dialect", name, TargetDialectGoogleSQL)
+		}
+		if pr.config.Shots > 0 {
+			return nil, fmt.Errorf("the few-shot examples only cover the %s dialect", TargetDialectGoogleSQL)
+		}
+	}
+	if pr.config.Candidates > 1 {
+		if pr.config.Mode == "agent" {
+			return nil, fmt.Errorf("candidate sampling is not supported in agent mode")
+		}
+		if pipeline.conversationMode != ConversationModeLocal {
+			return nil, fmt.Errorf("candidate sampling requires the 'local' conversation mode")
+		}
+		pipeline.SetCandidates(pr.config.Candidates)
+	}
+	if pr.config.PersistSession {
+		pipeline.SetSessionStore(store, pr.config)
+	}
+	if pr.config.ToolBudget > 0 {
+		pipeline.SetToolBudget(pr.config.ToolBudget)
+	}
 
 	// Set unique ID if provided (for concurrent execution)
 	if pr.config.UniqueID != "" {
@@ -70,9 +258,15 @@ func (pr *PipelineRunner) Run() (*PipelineResult, error) {
 	case "single":
 		result, err = pipeline.RunSingleShot()
 	case "iterative":
-		result, err = pipeline.RunIterative()
+		if snapshot != nil {
+			result, err = pipeline.ResumeIterative(snapshot)
+		} else {
+			result, err = pipeline.RunIterative()
+		}
+	case "agent":
+		result, err = pipeline.RunAgent()
 	default:
-		return nil, fmt.Errorf("invalid mode '%s'. Use 'single' or 'iterative'", pr.config.Mode)
+		return nil, fmt.Errorf("invalid mode '%s'. Use 'single', 'iterative' or 'agent'", pr.config.Mode)
 	}
 	executionTime := time.Since(executionStart)
 
@@ -148,6 +342,9 @@ func PrintResults(result *PipelineResult, verbose bool) {
 	fmt.Printf("Successfully parsed: %d\n", result.TestResults.ParsedCount)
 	fmt.Printf("Parse errors: %d\n", len(result.TestResults.ParseErrors))
 	fmt.Printf("Successfully executed: %d\n", result.TestResults.ExecutedCount)
+	if result.TestResults.Offline {
+		fmt.Printf("Passed semantic analysis (offline, not executed): %d\n", result.TestResults.AnalyzedCount)
+	}
 	fmt.Printf("Execution errors: %d\n", len(result.TestResults.ExecutionErrors))
 
 	if result.TestResults.TotalStatements > 0 {
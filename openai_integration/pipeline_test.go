@@ -0,0 +1,114 @@
+package integration
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedReply is a chat completion answer returned by continuationServer
+type scriptedReply struct {
+	content      string
+	finishReason string
+}
+
+// continuationServer stubs the chat completions endpoint: it records the last message of each
+// request and answers with the scripted replies in order
+func continuationServer(t *testing.T, replies []scriptedReply, requests *[]string) *OpenAIClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request OpenAIRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		*requests = append(*requests, request.Messages[len(request.Messages)-1].Content)
+		require.LessOrEqual(t, len(*requests), len(replies), "unexpected request")
+		reply := replies[len(*requests)-1]
+
+		var response OpenAIResponse
+		response.Choices = make([]struct {
+			Index   int `json:"index"`
+			Message struct {
+				Role      string     `json:"role"`
+				Content   string     `json:"content"`
+				ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		}, 1)
+		response.Choices[0].Message.Content = reply.content
+		response.Choices[0].FinishReason = reply.finishReason
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(server.Close)
+	return NewOpenAIClient(OpenAIConfig{APIKey: "test", BaseURL: server.URL})
+}
+
+func TestRequestResponseContinuations(t *testing.T) {
+	tests := []struct {
+		name             string
+		replies          []scriptedReply
+		maxContinuations int
+		content          string
+		truncation       *TruncationInfo
+	}{
+		{
+			name:             "complete response",
+			replies:          []scriptedReply{{"```sql\nSELECT 1;\n```", "stop"}},
+			maxContinuations: 2,
+			content:          "```sql\nSELECT 1;\n```",
+		},
+		{
+			name: "recovered with a reopened fence",
+			replies: []scriptedReply{
+				{"```sql\nCREATE TABLE T (\n", FinishReasonLength},
+				{"```sql\n  Id INT64,\n", FinishReasonLength},
+				{"```sql\n) PRIMARY KEY (Id);\n```", "stop"},
+			},
+			maxContinuations: 2,
+			content:          "```sql\nCREATE TABLE T (\n  Id INT64,\n) PRIMARY KEY (Id);\n```",
+			truncation: &TruncationInfo{
+				Truncated:     true,
+				Continuations: 2,
+				Recovered:     true,
+				FinishReasons: []string{FinishReasonLength, FinishReasonLength, "stop"},
+			},
+		},
+		{
+			name: "cut off after max continuations",
+			replies: []scriptedReply{
+				{"```sql\nSELECT 1,", FinishReasonLength},
+				{" 2,", FinishReasonLength},
+			},
+			maxContinuations: 1,
+			content:          "```sql\nSELECT 1, 2,",
+			truncation: &TruncationInfo{
+				Truncated:     true,
+				Continuations: 1,
+				Recovered:     false,
+				FinishReasons: []string{FinishReasonLength, FinishReasonLength},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			sm := NewSessionManager(continuationServer(t, tt.replies, &requests))
+			sm.RestoreSession(ConversationSession{ID: "s", Mode: ConversationModeLocal}, nil)
+			p := &Pipeline{sessionMgr: sm, maxContinuations: tt.maxContinuations}
+
+			content, truncation, err := p.requestResponse("s", "translate", "Test")
+			require.NoError(t, err)
+			assert.Equal(t, tt.content, content)
+			assert.Equal(t, tt.truncation, truncation)
+
+			// Every request after the first asks the model to continue
+			require.Len(t, requests, len(tt.replies))
+			assert.Equal(t, "translate", requests[0])
+			for _, request := range requests[1:] {
+				assert.Equal(t, ContinuationPrompt, request)
+			}
+		})
+	}
+}
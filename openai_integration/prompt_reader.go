@@ -10,6 +10,8 @@ import (
 // PromptReader handles reading and formatting prompts
 type PromptReader struct {
 	basePath string
+	// dialect selects how extracted SQL is split into statements, GoogleSQL when empty
+	dialect string
 }
 
 // NewPromptReader creates a new prompt reader
@@ -19,6 +21,11 @@ func NewPromptReader(basePath string) *PromptReader {
 	}
 }
 
+// SetTargetDialect selects the dialect extracted SQL is split in
+func (pr *PromptReader) SetTargetDialect(dialect string) {
+	pr.dialect = dialect
+}
+
 // ReadPromptFile reads the contents of prompt.txt
 func (pr *PromptReader) ReadPromptFile() (string, error) {
 	promptPath := filepath.Join(pr.basePath, "prompt.txt")
@@ -31,8 +38,17 @@ func (pr *PromptReader) ReadPromptFile() (string, error) {
 	return string(content), nil
 }
 
-// ReadGuidelinesFile reads the contents of spanner_sql_generation_guidelines.txt
+// ReadGuidelinesFile reads the contents of spanner_sql_generation_guidelines.txt, without the
+// retrieval tags
 func (pr *PromptReader) ReadGuidelinesFile() (string, error) {
+	content, err := pr.readRawGuidelinesFile()
+	if err != nil {
+		return "", err
+	}
+	return stripGuidelineTags(content), nil
+}
+
+func (pr *PromptReader) readRawGuidelinesFile() (string, error) {
 	guidelinesPath := filepath.Join(pr.basePath, "spanner_sql_generation_guidelines.txt")
 
 	content, err := os.ReadFile(guidelinesPath)
@@ -45,36 +61,84 @@ func (pr *PromptReader) ReadGuidelinesFile() (string, error) {
 
 // ExtractSQLFromResponse attempts to extract SQL code from an AI response
 func (pr *PromptReader) ExtractSQLFromResponse(response string) string {
-	// Try to find SQL code blocks first
-	if strings.Contains(response, "```sql") {
-		start := strings.Index(response, "```sql")
-		if start != -1 {
-			start += 6 // Skip "```sql"
-			end := strings.Index(response[start:], "```")
-			if end != -1 {
-				return strings.TrimSpace(response[start : start+end])
+	sql, _ := pr.ExtractSQLWithWarnings(response)
+	return sql
+}
+
+// ContinuationPrompt asks the model to resume a response that was cut off by the token limit
+const ContinuationPrompt = "Your previous response was cut off because it reached the maximum output length. " +
+	"Continue exactly where you stopped. Do not repeat any earlier content and do not add explanations, " +
+	"only output the remaining SQL code."
+
+// stitchContinuation appends a continuation chunk to a truncated response so the SQL can be extracted as a whole
+func stitchContinuation(partial, continuation string) string {
+	// If the partial response left a code block open, drop any fence the model used to reopen it
+	if strings.Count(partial, "```")%2 == 1 {
+		trimmed := strings.TrimLeft(continuation, " \t\r\n")
+		if strings.HasPrefix(trimmed, "```") {
+			if newline := strings.Index(trimmed, "\n"); newline != -1 {
+				continuation = trimmed[newline+1:]
+			} else {
+				continuation = ""
 			}
 		}
 	}
 
-	// Try to find generic code blocks
-	if strings.Contains(response, "```") {
-		start := strings.Index(response, "```")
-		if start != -1 {
-			// Skip the first ```
-			start = strings.Index(response[start+3:], "\n")
-			if start != -1 {
-				start += 4 // Skip "```\n"
-				end := strings.Index(response[start:], "```")
-				if end != -1 {
-					return strings.TrimSpace(response[start : start+end])
-				}
-			}
+	// The model resumes mid-token, so the chunks are joined without a separator
+	return partial + continuation
+}
+
+// GuidelineSection is a titled block of spanner_sql_generation_guidelines.txt
+type GuidelineSection struct {
+	Title   string
+	Content string
+	// Tags are only set on the retrieval units returned by ReadTaggedGuidelines
+	Tags []string
+}
+
+// ReadGuidelineSections splits the guidelines file into sections, using the
+// underlined headings ("Title" followed by a line of '-' or '=') as boundaries
+func (pr *PromptReader) ReadGuidelineSections() ([]GuidelineSection, error) {
+	content, err := pr.ReadGuidelinesFile()
+	if err != nil {
+		return nil, err
+	}
+	return splitGuidelineSections(content), nil
+}
+
+func splitGuidelineSections(content string) []GuidelineSection {
+	lines := strings.Split(content, "\n")
+	var sections []GuidelineSection
+	var current *GuidelineSection
+	var body []string
+
+	flush := func() {
+		if current != nil {
+			current.Content = strings.TrimSpace(strings.Join(body, "\n"))
+			sections = append(sections, *current)
+		}
+		body = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		title := strings.TrimSpace(lines[i])
+		if title != "" && i+1 < len(lines) && isHeadingUnderline(lines[i+1]) {
+			flush()
+			current = &GuidelineSection{Title: title}
+			i++ // Skip the underline
+			continue
 		}
+		body = append(body, lines[i])
 	}
+	flush()
 
-	// If no code blocks found, look for SQL keywords and return the relevant portion
-	response = strings.TrimSpace(response)
+	return sections
+}
 
-	return response
+func isHeadingUnderline(line string) bool {
+	line = strings.TrimSpace(line)
+	if len(line) < 3 {
+		return false
+	}
+	return strings.Trim(line, "-") == "" || strings.Trim(line, "=") == ""
 }
@@ -0,0 +1,47 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStitchContinuation(t *testing.T) {
+	tests := []struct {
+		name         string
+		partial      string
+		continuation string
+		expected     string
+	}{
+		{
+			name:         "joined mid-token",
+			partial:      "```sql\nCREATE TABLE T (Id INT",
+			continuation: "64) PRIMARY KEY (Id);\n```",
+			expected:     "```sql\nCREATE TABLE T (Id INT64) PRIMARY KEY (Id);\n```",
+		},
+		{
+			name:         "reopened fence is dropped",
+			partial:      "```sql\nCREATE TABLE T (\n",
+			continuation: "\n```sql\n  Id INT64\n) PRIMARY KEY (Id);\n```",
+			expected:     "```sql\nCREATE TABLE T (\n  Id INT64\n) PRIMARY KEY (Id);\n```",
+		},
+		{
+			name:         "reopened fence without content",
+			partial:      "```sql\nSELECT 1;\n",
+			continuation: "```sql",
+			expected:     "```sql\nSELECT 1;\n",
+		},
+		{
+			name:         "fence kept when the block was closed",
+			partial:      "```sql\nSELECT 1;\n```\n",
+			continuation: "```sql\nSELECT 2;\n```",
+			expected:     "```sql\nSELECT 1;\n```\n```sql\nSELECT 2;\n```",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, stitchContinuation(tt.partial, tt.continuation))
+		})
+	}
+}
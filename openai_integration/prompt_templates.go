@@ -0,0 +1,237 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"sql-parser/models"
+	"sql-parser/tools"
+)
+
+const (
+	// DefaultPromptTemplateSet reproduces the original prompts
+	DefaultPromptTemplateSet = "default"
+	// PromptTemplatesDir is the folder, relative to the base path, searched for template sets
+	// before the embedded ones
+	PromptTemplatesDir = "prompts"
+
+	// TargetDialectGoogleSQL is the dialect the generated SQL is evaluated against by default
+	TargetDialectGoogleSQL = "GoogleSQL"
+	// TargetDialectPostgreSQL evaluates against Spanner's PostgreSQL interface through PGAdapter
+	TargetDialectPostgreSQL = "PostgreSQL"
+
+	initialTemplate    = "initial.tmpl"
+	feedbackTemplate   = "feedback.tmpl"
+	guidelinesTemplate = "guidelines.tmpl"
+)
+
+//go:embed prompts
+var embeddedPrompts embed.FS
+
+// PromptTemplates is a set of text/template files used to build the prompts of a run
+type PromptTemplates struct {
+	Name string
+	// Hash identifies the exact template contents, so results can be attributed to them
+	Hash       string
+	initial    *template.Template
+	feedback   *template.Template
+	guidelines *template.Template
+}
+
+// InitialPromptData is passed to initial.tmpl
+type InitialPromptData struct {
+	// Prompt is prompt.txt verbatim, Instructions and SourceSQL are its two parts
+	Prompt        string
+	Instructions  string
+	SourceSQL     string
+	TargetDialect string
+	// Guidelines is the rendered guidelines.tmpl, empty when more context is disabled
+	Guidelines string
+	// OutputInstructions describes the answer format (structured output or agent mode)
+	OutputInstructions string
+	// Examples are the few-shot examples selected for the run, if any
+	Examples []FewShotExample
+}
+
+// GuidelinesData is passed to guidelines.tmpl
+type GuidelinesData struct {
+	Guidelines string
+	Sections   []GuidelineSection
+}
+
+// ErrorSummary is a counted error code, category or parse error type
+type ErrorSummary struct {
+	Name        string
+	Count       int
+	Description string
+}
+
+// StatementError is an error together with an excerpt of the failing statement
+type StatementError struct {
+	Error     string
+	Statement string
+}
+
+// FeedbackData is passed to feedback.tmpl
+type FeedbackData struct {
+	TargetDialect        string
+	ShortPrompts         bool
+	TotalStatements      int
+	ParsedCount          int
+	ParseErrorCount      int
+	ExecutedCount        int
+	ExecutionErrorCount  int
+	HasRates             bool
+	ParseRate            float64
+	ExecutionRate        float64
+	OverallRate          float64
+	ParseErrorSummary    []ErrorSummary
+	ErrorCodeSummary     []ErrorSummary
+	ErrorCategorySummary []ErrorSummary
+	ParseErrors          []StatementError
+	ExecutionErrors      []string
+	Recommendations      []string
+}
+
+var promptTemplateFuncs = template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}
+
+// LoadPromptTemplates loads a template set from <basePath>/prompts/<name>, falling back to the embedded sets
+func LoadPromptTemplates(basePath, name string) (*PromptTemplates, error) {
+	if name == "" {
+		name = DefaultPromptTemplateSet
+	}
+
+	var fsys fs.FS
+	dir := filepath.Join(basePath, PromptTemplatesDir, name)
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		fsys = os.DirFS(dir)
+	} else {
+		if _, err := fs.Stat(embeddedPrompts, PromptTemplatesDir+"/"+name); err != nil {
+			return nil, fmt.Errorf("prompt template set '%s' not found in %s or the embedded sets", name, dir)
+		}
+		fsys, _ = fs.Sub(embeddedPrompts, PromptTemplatesDir+"/"+name)
+	}
+
+	templates := &PromptTemplates{Name: name}
+	hash := sha256.New()
+	for _, file := range []string{feedbackTemplate, guidelinesTemplate, initialTemplate} {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s of set '%s': %w", file, name, err)
+		}
+		tmpl, err := template.New(file).Funcs(promptTemplateFuncs).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s of set '%s': %w", file, name, err)
+		}
+
+		fmt.Fprintf(hash, "%s\x00%s\x00", file, content)
+		switch file {
+		case initialTemplate:
+			templates.initial = tmpl
+		case feedbackTemplate:
+			templates.feedback = tmpl
+		case guidelinesTemplate:
+			templates.guidelines = tmpl
+		}
+	}
+	templates.Hash = hex.EncodeToString(hash.Sum(nil))[:12]
+
+	return templates, nil
+}
+
+// RenderInitial renders the initial prompt
+func (t *PromptTemplates) RenderInitial(data InitialPromptData) (string, error) {
+	return render(t.initial, data)
+}
+
+// RenderGuidelines renders the guidelines injected into the initial prompt
+func (t *PromptTemplates) RenderGuidelines(data GuidelinesData) (string, error) {
+	return render(t.guidelines, data)
+}
+
+// RenderFeedback renders the feedback prompt sent after an iteration
+func (t *PromptTemplates) RenderFeedback(data FeedbackData) (string, error) {
+	return render(t.feedback, data)
+}
+
+func render(tmpl *template.Template, data any) (string, error) {
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", tmpl.Name(), err)
+	}
+	return out.String(), nil
+}
+
+// NewFeedbackData collects the values available to feedback.tmpl from a test result
+func NewFeedbackData(fr models.TestFileResult, targetDialect string, shortPrompts bool) FeedbackData {
+	data := FeedbackData{
+		TargetDialect:        targetDialect,
+		ShortPrompts:         shortPrompts,
+		TotalStatements:      fr.TotalStatements,
+		ParsedCount:          fr.ParsedCount,
+		ParseErrorCount:      len(fr.ParseErrors),
+		ExecutedCount:        fr.ExecutedCount,
+		ExecutionErrorCount:  len(fr.ExecutionErrors),
+		ParseErrorSummary:    summarizeErrors(fr.ParseErrorCodes, tools.GetParseErrorDescription),
+		ErrorCodeSummary:     summarizeErrors(fr.ErrorCodes, tools.GetErrorCodeDescription),
+		ErrorCategorySummary: summarizeErrors(fr.ErrorCategories, tools.GetErrorCategoryDescription),
+		ExecutionErrors:      fr.ExecutionErrors,
+		Recommendations:      tools.GetAIRecommendations(fr),
+	}
+
+	if fr.TotalStatements > 0 {
+		data.HasRates = true
+		data.ParseRate = float64(fr.ParsedCount) / float64(fr.TotalStatements) * 100
+		if fr.ParsedCount > 0 {
+			data.ExecutionRate = float64(fr.ExecutedCount) / float64(fr.ParsedCount) * 100
+		}
+		data.OverallRate = float64(fr.ExecutedCount) / float64(fr.TotalStatements) * 100
+	}
+
+	if len(fr.ParseErrors) > 0 {
+		for _, e := range fr.ParseErrorDetails {
+			data.ParseErrors = append(data.ParseErrors, StatementError{
+				Error:     e.Error,
+				Statement: statementExcerpt(e.Statement, shortPrompts),
+			})
+		}
+	}
+
+	return data
+}
+
+// summarizeErrors turns an error count map into a list sorted by name
+func summarizeErrors(counts map[string]int, describe func(string) string) []ErrorSummary {
+	summary := make([]ErrorSummary, 0, len(counts))
+	for name, count := range counts {
+		summary = append(summary, ErrorSummary{Name: name, Count: count, Description: describe(name)})
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Name < summary[j].Name })
+	return summary
+}
+
+// statementExcerpt shortens a statement for the feedback prompt: the first line for
+// short prompts, otherwise the first and last 100 characters of long statements
+func statementExcerpt(stmt string, shortPrompts bool) string {
+	if shortPrompts {
+		lines := strings.Split(stmt, "\n")
+		if len(lines) > 1 {
+			return lines[0] + "..."
+		}
+		return lines[0]
+	}
+	if len(stmt) > 200 {
+		return stmt[:100] + "..." + stmt[len(stmt)-100:]
+	}
+	return stmt
+}
@@ -0,0 +1,69 @@
+package integration
+
+import (
+	"fmt"
+
+	"sql-parser/models"
+	"sql-parser/tools"
+)
+
+// Semantic check modes selectable with --semantic-check
+const (
+	// SemanticCheckOff executes every statement that parses
+	SemanticCheckOff = "off"
+	// SemanticCheckOn reports statements the semantic analysis rejects and executes the rest
+	SemanticCheckOn = "on"
+	// SemanticCheckOffline stops after the semantic analysis, no emulator is needed
+	SemanticCheckOffline = "offline"
+)
+
+// semanticErrorCode is the error code recorded for statements rejected by the semantic analysis
+const semanticErrorCode = "Semantic"
+
+// ValidSemanticCheck reports whether mode is a known semantic check mode
+func ValidSemanticCheck(mode string) bool {
+	switch mode {
+	case SemanticCheckOff, SemanticCheckOn, SemanticCheckOffline:
+		return true
+	}
+	return false
+}
+
+// SetSemanticCheck selects whether parsed statements are checked against the schema they build
+// before they are executed
+func (p *Pipeline) SetSemanticCheck(mode string) error {
+	if !ValidSemanticCheck(mode) {
+		return fmt.Errorf("invalid semantic check mode '%s'. Use 'off', 'on' or 'offline'", mode)
+	}
+	p.semanticCheck = mode
+	return nil
+}
+
+// analysisPassed reports whether an offline result has no parse or semantic errors. There is
+// nothing left to fix without an emulator, but it is not a success.
+func analysisPassed(fr models.TestFileResult) bool {
+	return fr.Offline && len(fr.ParseErrors) == 0 && len(fr.ExecutionErrors) == 0
+}
+
+// checkSemantics records the statements the semantic analysis rejects as execution errors of fr
+// and returns the statements that passed
+func checkSemantics(fr *models.TestFileResult, statements []string) []string {
+	var passed []string
+	for i, semErr := range tools.AnalyzeSemantics(statements) {
+		if semErr == nil {
+			passed = append(passed, statements[i])
+			continue
+		}
+		errMsg := "semantic analysis: " + semErr.Error()
+		fr.FailedCount++
+		fr.ExecutionErrors = append(fr.ExecutionErrors, errMsg)
+		fr.ExecutionErrorDetails = append(fr.ExecutionErrorDetails, models.ExecutionError{
+			Statement:   semErr.Statement,
+			Code:        semanticErrorCode,
+			Description: errMsg,
+		})
+		fr.ErrorCodes[semanticErrorCode]++
+		fr.ErrorCategories[semErr.Category]++
+	}
+	return passed
+}
@@ -13,6 +13,10 @@ type SessionManager struct {
 	client   *OpenAIClient
 	// Keep local message tracking for backward compatibility and reporting
 	messages map[string][]ConversationMessage
+	// mode selects where new sessions keep their history, see ConversationModeLocal
+	mode string
+	// history selects the part of a local history sent on each request
+	history HistoryStrategy
 }
 
 // NewSessionManager creates a new session manager
@@ -21,9 +25,21 @@ func NewSessionManager(client *OpenAIClient) *SessionManager {
 		sessions: make(map[string]*ConversationSession),
 		client:   client,
 		messages: make(map[string][]ConversationMessage),
+		mode:     ConversationModeLocal,
+		history:  fullHistory{},
 	}
 }
 
+// SetConversationMode selects the conversation mode used by sessions created afterwards
+func (sm *SessionManager) SetConversationMode(mode string) {
+	sm.mode = mode
+}
+
+// SetHistoryStrategy selects how much of a local conversation is resent on each request
+func (sm *SessionManager) SetHistoryStrategy(strategy HistoryStrategy) {
+	sm.history = strategy
+}
+
 // CreateSession creates a new conversation session using the OpenAI Conversations API
 func (sm *SessionManager) CreateSession(model string) (*ConversationSession, error) {
 	sessionID, err := generateSessionID()
@@ -35,7 +51,7 @@ func (sm *SessionManager) CreateSession(model string) (*ConversationSession, err
 		model = DefaultModel
 	}
 
-	conversationResp, err := sm.client.CreateConversation()
+	conversationResp, err := sm.client.CreateConversation(sm.mode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create conversation on OpenAI: %w", err)
 	}
@@ -49,6 +65,7 @@ func (sm *SessionManager) CreateSession(model string) (*ConversationSession, err
 		MessageCount:   0,
 		LastMessageID:  "",
 		LastResponseID: "",
+		Mode:           sm.mode,
 	}
 
 	sm.sessions[sessionID] = session
@@ -73,7 +90,7 @@ func (sm *SessionManager) AddMessage(sessionID string, role string, content stri
 	}
 
 	// Add the message to the conversation on OpenAI's side
-	messageResp, err := sm.client.AddMessage(session.ConversationID, role, content)
+	messageResp, err := sm.client.AddMessage(session.Mode, session.ConversationID, role, content)
 	if err != nil {
 		return fmt.Errorf("failed to add message to OpenAI conversation: %w", err)
 	}
@@ -95,21 +112,46 @@ func (sm *SessionManager) AddMessage(sessionID string, role string, content stri
 
 // SendMessage sends a user message and gets AI response using the Conversations API
 func (sm *SessionManager) SendMessage(sessionID string, userMessage string) (string, error) {
-	session, err := sm.GetSession(sessionID)
+	response, err := sm.SendMessageWithResponse(sessionID, userMessage)
 	if err != nil {
 		return "", err
 	}
+	return response.Content, nil
+}
 
-	// Add user message to the conversation
-	if err := sm.AddMessage(sessionID, "user", userMessage); err != nil {
-		return "", err
+// SendMessageWithResponse sends a user message and returns the full AI response, including finish reason and usage
+func (sm *SessionManager) SendMessageWithResponse(sessionID string, userMessage string) (*GetResponseResponse, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get AI response from the conversation by passing the current message history
-	currentMessages := sm.messages[sessionID]
-	responseResp, err := sm.client.GetResponse(session.ConversationID, currentMessages)
-	if err != nil {
-		return "", fmt.Errorf("failed to get response from OpenAI conversation: %w", err)
+	var responseResp *GetResponseResponse
+	if session.Mode == ConversationModeConversations || session.Mode == ConversationModeResponses {
+		// Only the new message is sent, the server already holds the earlier turns.
+		// The Responses API stores the input in the conversation, so it is not added as an item first.
+		message := ConversationMessage{Role: "user", Content: userMessage}
+		responseResp, err = sm.client.GetServerResponse(session.Mode, session.ConversationID, session.LastResponseID, message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get response from OpenAI conversation: %w", err)
+		}
+		sm.messages[sessionID] = append(sm.messages[sessionID], message)
+		session.MessageCount++
+	} else {
+		// Add user message to the conversation
+		if err := sm.AddMessage(sessionID, "user", userMessage); err != nil {
+			return nil, err
+		}
+
+		// Get AI response from the conversation by passing the history selected by the strategy
+		currentMessages, err := sm.selectHistory(session, sm.messages[sessionID])
+		if err != nil {
+			return nil, err
+		}
+		responseResp, err = sm.client.GetResponse(session.ConversationID, currentMessages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get response from OpenAI conversation: %w", err)
+		}
 	}
 
 	// Store AI response locally for backward compatibility
@@ -123,8 +165,137 @@ func (sm *SessionManager) SendMessage(sessionID string, userMessage string) (str
 	session.LastResponseID = responseResp.ID
 	session.MessageCount++
 	session.UpdatedAt = time.Now()
+	sm.recordUsage(session, responseResp.Usage.PromptTokens, responseResp.Usage.CompletionTokens, responseResp.Usage.TotalTokens)
 
-	return responseResp.Content, nil
+	return responseResp, nil
+}
+
+// SendMessageCandidates adds a user message and requests n candidate answers without storing them.
+// The caller picks one and stores it with AcceptCandidate. Only local conversations are supported,
+// since the server-side modes keep a single linear history.
+func (sm *SessionManager) SendMessageCandidates(sessionID string, userMessage string, n int) ([]*GetResponseResponse, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Mode != ConversationModeLocal {
+		return nil, fmt.Errorf("candidate sampling requires the 'local' conversation mode, session uses '%s'", session.Mode)
+	}
+
+	if err := sm.AddMessage(sessionID, "user", userMessage); err != nil {
+		return nil, err
+	}
+
+	currentMessages, err := sm.selectHistory(session, sm.messages[sessionID])
+	if err != nil {
+		return nil, err
+	}
+	response, err := sm.client.GetCandidateResponses(currentMessages, n)
+	if err != nil {
+		return nil, err
+	}
+	sm.recordUsage(session, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.TotalTokens)
+
+	candidates := make([]*GetResponseResponse, 0, len(response.Choices))
+	for i, choice := range response.Choices {
+		candidates = append(candidates, &GetResponseResponse{
+			ID:             fmt.Sprintf("%s_%d", response.ID, i),
+			Object:         "response",
+			CreatedAt:      time.Now().Unix(),
+			ConversationID: session.ConversationID,
+			Role:           "assistant",
+			Content:        choice.Message.Content,
+			FinishReason:   choice.FinishReason,
+		})
+	}
+	return candidates, nil
+}
+
+// AcceptCandidate stores the chosen candidate as the assistant answer of the latest user message
+func (sm *SessionManager) AcceptCandidate(sessionID string, candidate *GetResponseResponse) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	sm.messages[sessionID] = append(sm.messages[sessionID], ConversationMessage{
+		Role:    "assistant",
+		Content: candidate.Content,
+	})
+	session.LastResponseID = candidate.ID
+	session.MessageCount++
+	session.UpdatedAt = time.Now()
+	return nil
+}
+
+// SendMessagesWithTools appends the given messages (user prompts or tool results) to the session,
+// requests a response that may contain tool calls and stores the assistant turn in the history.
+// Tool calling always goes through chat completions with the locally held history.
+func (sm *SessionManager) SendMessagesWithTools(sessionID string, newMessages []ConversationMessage, tools []Tool, toolChoice string) (*OpenAIResponse, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	sm.messages[sessionID] = append(sm.messages[sessionID], newMessages...)
+	session.MessageCount += len(newMessages)
+
+	response, err := sm.client.SendMessageWithTools(sm.messages[sessionID], tools, toolChoice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response from OpenAI: %w", err)
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	choice := response.Choices[0]
+	sm.messages[sessionID] = append(sm.messages[sessionID], ConversationMessage{
+		Role:      "assistant",
+		Content:   choice.Message.Content,
+		ToolCalls: choice.Message.ToolCalls,
+	})
+
+	session.LastResponseID = response.ID
+	session.MessageCount++
+	session.UpdatedAt = time.Now()
+	sm.recordUsage(session, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.TotalTokens)
+
+	return response, nil
+}
+
+// selectHistory applies the history strategy and records the estimated context size on the session
+func (sm *SessionManager) selectHistory(session *ConversationSession, messages []ConversationMessage) ([]ConversationMessage, error) {
+	selected, err := sm.history.Select(session, messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply %s history strategy: %w", sm.history.Name(), err)
+	}
+	session.HistoryStrategy = sm.history.Name()
+
+	if len(selected) < len(messages) {
+		session.HistoryTrimmed++
+		if sm.client.config.Verbose {
+			fmt.Printf("  └─ History (%s): sending %d of %d messages, ~%d of ~%d tokens\n",
+				sm.history.Name(), len(selected), len(messages), EstimateMessagesTokens(selected), EstimateMessagesTokens(messages))
+		}
+	}
+	if estimated := EstimateMessagesTokens(selected); estimated > session.PeakContextTokens {
+		session.PeakContextTokens = estimated
+	}
+	return selected, nil
+}
+
+// recordUsage accumulates token usage on the session and warns when a single request
+// gets close to the model's context window
+func (sm *SessionManager) recordUsage(session *ConversationSession, promptTokens, completionTokens, totalTokens int) {
+	contextWindow := sm.client.Capabilities().ContextWindow
+	if contextWindow > 0 && float64(promptTokens+completionTokens) >= ContextWarningThreshold*float64(contextWindow) {
+		fmt.Printf("  └─ Warning: request used %d of %d context tokens (%.0f%%)\n",
+			promptTokens+completionTokens, contextWindow, 100*float64(promptTokens+completionTokens)/float64(contextWindow))
+	}
+
+	session.PromptTokens += promptTokens
+	session.CompletionTokens += completionTokens
+	session.TotalTokens += totalTokens
 }
 
 // GetConversationHistory returns the conversation history from local storage
@@ -195,3 +366,52 @@ func generateSessionID() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// RestoreSession registers a previously persisted session and its message history
+func (sm *SessionManager) RestoreSession(session ConversationSession, messages []ConversationMessage) *ConversationSession {
+	restored := session
+	sm.sessions[restored.ID] = &restored
+	sm.messages[restored.ID] = append([]ConversationMessage(nil), messages...)
+	restored.MessageCount = len(messages)
+	return &restored
+}
+
+// RollbackTo discards the messages after the first historyLength ones. In responses mode the
+// response chain continues from responseID; a server-side conversation cannot be rolled back.
+func (sm *SessionManager) RollbackTo(sessionID string, historyLength int, responseID string) error {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if session.Mode == ConversationModeConversations {
+		return fmt.Errorf("conversations mode does not support rolling back")
+	}
+
+	messages := sm.messages[sessionID]
+	if historyLength > len(messages) {
+		return fmt.Errorf("cannot roll back to %d messages, session has %d", historyLength, len(messages))
+	}
+	sm.messages[sessionID] = messages[:historyLength]
+	session.MessageCount = historyLength
+	session.LastResponseID = responseID
+	session.UpdatedAt = time.Now()
+	return nil
+}
+
+// PopLastMessage removes and returns the last message of a session, e.g. a prompt that never got an answer
+func (sm *SessionManager) PopLastMessage(sessionID string) (ConversationMessage, error) {
+	session, err := sm.GetSession(sessionID)
+	if err != nil {
+		return ConversationMessage{}, err
+	}
+
+	messages := sm.messages[sessionID]
+	if len(messages) == 0 {
+		return ConversationMessage{}, fmt.Errorf("session %s has no messages", sessionID)
+	}
+
+	last := messages[len(messages)-1]
+	sm.messages[sessionID] = messages[:len(messages)-1]
+	session.MessageCount--
+	return last, nil
+}
@@ -0,0 +1,85 @@
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultSessionsDir is the folder, relative to the base path, where sessions are persisted
+const DefaultSessionsDir = "sessions"
+
+// PersistedSession is the on-disk snapshot of a pipeline session, written after every step
+// so that an interrupted run can be resumed from the last completed iteration
+type PersistedSession struct {
+	Session          ConversationSession   `json:"session"`
+	Config           PipelineConfig        `json:"config"`
+	InitialPrompt    string                `json:"initial_prompt"`
+	Messages         []ConversationMessage `json:"messages"`
+	IterationResults []IterationResult     `json:"iteration_results"`
+	// Pending is set when PendingSQL was extracted from the latest response but not evaluated yet
+	Pending           bool             `json:"pending"`
+	PendingSQL        string           `json:"pending_sql"`
+	PendingTruncation *TruncationInfo  `json:"pending_truncation,omitempty"`
+	PendingExtraction *ExtractionInfo  `json:"pending_extraction,omitempty"`
+	PendingCandidates []CandidateScore `json:"pending_candidates,omitempty"`
+	PendingGuidelines []string         `json:"pending_guidelines,omitempty"`
+	// FewShot records the examples that went into InitialPrompt
+	FewShot   *FewShotSelection `json:"few_shot,omitempty"`
+	Completed bool              `json:"completed"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// SessionStore saves and loads persisted sessions as JSON files
+type SessionStore struct {
+	dir string
+}
+
+// NewSessionStore creates a store writing to dir
+func NewSessionStore(dir string) *SessionStore {
+	return &SessionStore{dir: dir}
+}
+
+// Path returns the file used for a session
+func (s *SessionStore) Path(sessionID string) string {
+	return filepath.Join(s.dir, sessionID+".json")
+}
+
+// Save writes the snapshot atomically, so a crash never leaves a half-written file behind
+func (s *SessionStore) Save(snapshot *PersistedSession) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	snapshot.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	path := s.Path(snapshot.Session.ID)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace session file: %w", err)
+	}
+	return nil
+}
+
+// Load reads a persisted session by ID
+func (s *SessionStore) Load(sessionID string) (*PersistedSession, error) {
+	data, err := os.ReadFile(s.Path(sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %w", sessionID, err)
+	}
+
+	var snapshot PersistedSession
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session %s: %w", sessionID, err)
+	}
+	return &snapshot, nil
+}
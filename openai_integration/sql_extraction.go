@@ -0,0 +1,201 @@
+package integration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sql-parser/tools"
+)
+
+// sqlBlockLabels are the code block languages treated as SQL; an unlabelled block is also accepted
+var sqlBlockLabels = map[string]bool{
+	"":           true,
+	"sql":        true,
+	"googlesql":  true,
+	"spanner":    true,
+	"spannersql": true,
+	"postgresql": true,
+	"postgres":   true,
+	"pgsql":      true,
+}
+
+// codeBlock is a fenced block found in a response
+type codeBlock struct {
+	label      string
+	content    string
+	terminated bool
+}
+
+// ExtractSQLWithWarnings extracts SQL from an AI response, concatenating all SQL code blocks in
+// order and stripping prose lines. The warnings describe any content that was discarded.
+func (pr *PromptReader) ExtractSQLWithWarnings(response string) (string, []string) {
+	var warnings []string
+	var candidate string
+
+	blocks, prose := splitCodeBlocks(response)
+	if len(blocks) > 0 {
+		var sqlParts []string
+		for i, block := range blocks {
+			if !sqlBlockLabels[block.label] {
+				warnings = append(warnings, fmt.Sprintf("discarded code block %d labelled %q", i+1, block.label))
+				continue
+			}
+			if !block.terminated {
+				warnings = append(warnings, fmt.Sprintf("code block %d is not terminated, using the remainder of the response", i+1))
+			}
+			if strings.TrimSpace(block.content) != "" {
+				sqlParts = append(sqlParts, strings.TrimSpace(block.content))
+			}
+		}
+		if proseLines := countNonEmptyLines(prose); proseLines > 0 && len(sqlParts) > 0 {
+			warnings = append(warnings, fmt.Sprintf("discarded %d line(s) of prose outside code blocks", proseLines))
+		}
+		candidate = strings.Join(sqlParts, "\n\n")
+		if len(sqlParts) == 0 {
+			// Only non-SQL blocks, fall back to scanning the whole response
+			candidate = response
+		}
+	} else {
+		candidate = response
+	}
+
+	sql, filterWarnings := pr.filterProseLines(candidate)
+	warnings = append(warnings, filterWarnings...)
+
+	return strings.TrimSpace(sql), warnings
+}
+
+// parsesAsStatement reports whether stmt is accepted by memefish, or by the PostgreSQL checks when
+// the target dialect is PostgreSQL
+func (pr *PromptReader) parsesAsStatement(stmt string) bool {
+	stmt = strings.TrimSuffix(strings.TrimSpace(stmt), ";")
+	if pr.dialect == TargetDialectPostgreSQL {
+		return tools.ParseStatementsPostgres([]string{stmt})[0].Parsed
+	}
+	// Splitting first rejects input the lexer cannot tokenize, which would make the parser panic
+	statements, err := tools.ExtractStatementsFromString(stmt)
+	if err != nil || len(statements) != 1 {
+		return false
+	}
+	return tools.ParseStatementsWithMemefish(statements, "")[0].Parsed
+}
+
+// splitCodeBlocks returns the fenced code blocks of a response and the text outside of them
+func splitCodeBlocks(response string) ([]codeBlock, string) {
+	var blocks []codeBlock
+	var prose strings.Builder
+
+	rest := response
+	for {
+		start := strings.Index(rest, "```")
+		if start == -1 {
+			prose.WriteString(rest)
+			break
+		}
+		prose.WriteString(rest[:start])
+		rest = rest[start+3:]
+
+		// The label runs until the end of the opening fence line
+		label := ""
+		if newline := strings.Index(rest, "\n"); newline != -1 {
+			label = strings.ToLower(strings.TrimSpace(rest[:newline]))
+			rest = rest[newline+1:]
+		} else {
+			label = strings.ToLower(strings.TrimSpace(rest))
+			rest = ""
+		}
+
+		end := strings.Index(rest, "```")
+		if end == -1 {
+			blocks = append(blocks, codeBlock{label: label, content: rest, terminated: false})
+			break
+		}
+		blocks = append(blocks, codeBlock{label: label, content: rest[:end], terminated: true})
+		rest = rest[end+3:]
+	}
+
+	return blocks, prose.String()
+}
+
+// dollarQuote matches the delimiters of PostgreSQL dollar quoted strings such as $$ or $body$
+var dollarQuote = regexp.MustCompile(`\$[A-Za-z_]*\$`)
+
+// insideFunctionBody reports whether lines leave a PostgreSQL dollar quoted body open. The
+// PostgreSQL checks are lenient enough to accept the body's own statements, so a statement must
+// not be cut there.
+func (pr *PromptReader) insideFunctionBody(lines []string) bool {
+	if pr.dialect != TargetDialectPostgreSQL {
+		return false
+	}
+	return len(dollarQuote.FindAllString(strings.Join(lines, "\n"), -1))%2 == 1
+}
+
+// filterProseLines groups lines into statements ending at a semicolon and validates each one with
+// the parser of the target dialect. A statement that does not parse has leading lines removed until
+// the rest does, so prose is only dropped where the parser rejects it; a semicolon inside a literal
+// or a function body simply extends the statement to the next line ending in one. Anything left
+// that never parses is dropped as well.
+func (pr *PromptReader) filterProseLines(content string) (string, []string) {
+	var kept, pending []string
+	dropped := 0
+
+	flush := func() bool {
+		for start, line := range pending {
+			if strings.TrimSpace(line) == "" || pr.insideFunctionBody(pending[:start]) ||
+				!pr.parsesAsStatement(strings.Join(pending[start:], "\n")) {
+				continue
+			}
+			dropped += countNonEmptyLines(strings.Join(pending[:start], "\n"))
+			kept = append(kept, pending[start:]...)
+			pending = nil
+			return true
+		}
+		return false
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if len(pending) == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			kept = append(kept, line)
+			continue
+		}
+		pending = append(pending, line)
+
+		code := trimmed
+		if commentPos := strings.Index(code, "--"); commentPos >= 0 {
+			code = strings.TrimSpace(code[:commentPos])
+		}
+		if strings.HasSuffix(code, ";") {
+			flush()
+		}
+	}
+	// The last statement may lack its semicolon
+	if len(pending) > 0 && !flush() {
+		dropped += countNonEmptyLines(strings.Join(pending, "\n"))
+	}
+
+	var warnings []string
+	if dropped > 0 {
+		warnings = append(warnings, fmt.Sprintf("discarded %d non-SQL line(s) between statements", dropped))
+	}
+	return strings.Join(kept, "\n"), warnings
+}
+
+func countNonEmptyLines(text string) int {
+	count := 0
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+func firstLine(text string) string {
+	line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(text), "\n", 2)[0])
+	if len(line) > 80 {
+		line = line[:80] + "..."
+	}
+	return line
+}
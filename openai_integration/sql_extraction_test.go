@@ -0,0 +1,148 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractSQLPostgreSQLDialect(t *testing.T) {
+	pr := NewPromptReader("")
+	pr.SetTargetDialect(TargetDialectPostgreSQL)
+
+	response := "Here is the schema:\n```postgresql\n" +
+		"CREATE TABLE notes (id bigint PRIMARY KEY, body text DEFAULT 'a;b');\n" +
+		"CREATE FUNCTION touch() RETURNS trigger AS $$ BEGIN NEW.id := 1; RETURN NEW; END $$ LANGUAGE plpgsql;\n" +
+		"```\n```pgsql\nINSERT INTO notes (id) VALUES (1);\n```\n"
+
+	sql, warnings := pr.ExtractSQLWithWarnings(response)
+	assert.Equal(t, "CREATE TABLE notes (id bigint PRIMARY KEY, body text DEFAULT 'a;b');\n"+
+		"CREATE FUNCTION touch() RETURNS trigger AS $$ BEGIN NEW.id := 1; RETURN NEW; END $$ LANGUAGE plpgsql;\n\n"+
+		"INSERT INTO notes (id) VALUES (1);", sql)
+	assert.Equal(t, []string{"discarded 1 line(s) of prose outside code blocks"}, warnings)
+}
+
+func TestSplitCodeBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		blocks   []codeBlock
+		prose    string
+	}{
+		{name: "no fences", response: "SELECT 1;", blocks: nil, prose: "SELECT 1;"},
+		{
+			name:     "mixed labels",
+			response: "Schema:\n```SQL\nCREATE TABLE T (Id INT64) PRIMARY KEY (Id);\n```\nRun it with\n```bash\ngcloud spanner databases ddl update\n```\n```\nSELECT 1;\n```",
+			blocks: []codeBlock{
+				{label: "sql", content: "CREATE TABLE T (Id INT64) PRIMARY KEY (Id);\n", terminated: true},
+				{label: "bash", content: "gcloud spanner databases ddl update\n", terminated: true},
+				{label: "", content: "SELECT 1;\n", terminated: true},
+			},
+			prose: "Schema:\n\nRun it with\n\n",
+		},
+		{
+			name:     "unterminated fence",
+			response: "```googlesql\nCREATE TABLE T (\n  Id INT64",
+			blocks:   []codeBlock{{label: "googlesql", content: "CREATE TABLE T (\n  Id INT64", terminated: false}},
+			prose:    "",
+		},
+		{
+			name:     "fence without newline",
+			response: "text ```sql",
+			blocks:   []codeBlock{{label: "sql", content: "", terminated: false}},
+			prose:    "text ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, prose := splitCodeBlocks(tt.response)
+			assert.Equal(t, tt.blocks, blocks)
+			assert.Equal(t, tt.prose, prose)
+		})
+	}
+}
+
+func TestExtractSQLWithWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		sql      string
+		warnings []string
+	}{
+		{
+			name:     "single block",
+			response: "```sql\nCREATE TABLE T (Id INT64) PRIMARY KEY (Id);\n```",
+			sql:      "CREATE TABLE T (Id INT64) PRIMARY KEY (Id);",
+		},
+		{
+			name:     "mixed labels",
+			response: "```sql\nCREATE TABLE T (Id INT64) PRIMARY KEY (Id);\n```\nThen:\n```bash\necho done\n```\n```spanner\nINSERT INTO T (Id) VALUES (1);\n```",
+			sql:      "CREATE TABLE T (Id INT64) PRIMARY KEY (Id);\n\nINSERT INTO T (Id) VALUES (1);",
+			warnings: []string{
+				`discarded code block 2 labelled "bash"`,
+				"discarded 1 line(s) of prose outside code blocks",
+			},
+		},
+		{
+			name:     "only non-SQL blocks fall back to the response",
+			response: "```text\nSELECT 1;\n```",
+			sql:      "SELECT 1;",
+			// The fence lines are dropped when the whole response is scanned
+			warnings: []string{`discarded code block 1 labelled "text"`, "discarded 2 non-SQL line(s) between statements"},
+		},
+		{
+			name:     "unterminated fence",
+			response: "```sql\nCREATE TABLE T (Id INT64) PRIMARY KEY (Id);\nSELECT Id FROM T;",
+			sql:      "CREATE TABLE T (Id INT64) PRIMARY KEY (Id);\nSELECT Id FROM T;",
+			warnings: []string{"code block 1 is not terminated, using the remainder of the response"},
+		},
+		{
+			name:     "prose between statements",
+			response: "Here is the translation.\nCREATE TABLE T (Id INT64) PRIMARY KEY (Id);\nNow some data:\nINSERT INTO T (Id) VALUES (1);",
+			sql:      "CREATE TABLE T (Id INT64) PRIMARY KEY (Id);\nINSERT INTO T (Id) VALUES (1);",
+			warnings: []string{"discarded 2 non-SQL line(s) between statements"},
+		},
+		{
+			name:     "multi-line statements keep their lines",
+			response: "```sql\nCREATE TABLE T (\n  Id INT64,\n  Name STRING(10)\n) PRIMARY KEY (Id);\n```",
+			sql:      "CREATE TABLE T (\n  Id INT64,\n  Name STRING(10)\n) PRIMARY KEY (Id);",
+		},
+		{
+			name:     "semicolon inside a literal continues the statement",
+			response: "```sql\nINSERT INTO T (Id, Name) VALUES\n  (1, '''first;\nsecond'''),\n  (2, 'third');\nSELECT Id FROM T;\n```",
+			sql:      "INSERT INTO T (Id, Name) VALUES\n  (1, '''first;\nsecond'''),\n  (2, 'third');\nSELECT Id FROM T;",
+		},
+		{
+			name:     "prose starting with a keyword",
+			response: "Create the table first:\nCREATE TABLE T (Id INT64) PRIMARY KEY (Id);\nSet up the index next.\nCREATE INDEX TById ON T (Id);\nWith this schema, lookups by Id are fast.",
+			sql:      "CREATE TABLE T (Id INT64) PRIMARY KEY (Id);\nCREATE INDEX TById ON T (Id);",
+			warnings: []string{"discarded 3 non-SQL line(s) between statements"},
+		},
+		{
+			name:     "comments are preserved",
+			response: "```sql\n-- Tables\nCREATE TABLE T (\n  Id INT64, -- the key\n) PRIMARY KEY (Id);\n\n-- Data\nINSERT INTO T (Id) VALUES (1);\n```",
+			sql:      "-- Tables\nCREATE TABLE T (\n  Id INT64, -- the key\n) PRIMARY KEY (Id);\n\n-- Data\nINSERT INTO T (Id) VALUES (1);",
+		},
+	}
+
+	pr := NewPromptReader("")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, warnings := pr.ExtractSQLWithWarnings(tt.response)
+			assert.Equal(t, tt.sql, sql)
+			assert.Equal(t, tt.warnings, warnings)
+		})
+	}
+}
+
+func TestExtractSQLPostgreSQLFunctionBody(t *testing.T) {
+	pr := NewPromptReader("")
+	pr.SetTargetDialect(TargetDialectPostgreSQL)
+
+	response := "```sql\nCREATE FUNCTION touch() RETURNS trigger AS $$\nBEGIN\n  NEW.updated := now();\n  RETURN NEW;\nEND\n$$ LANGUAGE plpgsql;\n```"
+
+	sql, warnings := pr.ExtractSQLWithWarnings(response)
+	assert.Equal(t, "CREATE FUNCTION touch() RETURNS trigger AS $$\nBEGIN\n  NEW.updated := now();\n  RETURN NEW;\nEND\n$$ LANGUAGE plpgsql;", sql)
+	assert.Empty(t, warnings)
+}
@@ -0,0 +1,102 @@
+package integration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sql-parser/models"
+)
+
+// Reasons an iterative run stopped, recorded in PipelineResult and ExecutionMetrics
+const (
+	StopSuccess         = "success"
+	StopMaxIterations   = "max_iterations"
+	StopNoImprovement   = "no_improvement"
+	StopIdenticalSQL    = "identical_sql"
+	StopUnchangedErrors = "unchanged_errors"
+	StopTokenBudget     = "token_budget"
+	// StopAnalyzed is recorded when an offline run passed the semantic analysis, see analysisPassed
+	StopAnalyzed = "analyzed"
+)
+
+// StopPolicy configures the early stopping checks run after every failed iteration.
+// Zero values disable the corresponding check.
+type StopPolicy struct {
+	// NoImprovement stops after this many iterations without beating the best score
+	NoImprovement int
+	// IdenticalSQL stops when the model returns SQL it already returned in an earlier iteration
+	IdenticalSQL bool
+	// UnchangedErrors stops when an iteration reports exactly the same errors as the previous one
+	UnchangedErrors bool
+	// TokenBudget stops once the session has used this many tokens
+	TokenBudget int
+}
+
+// SetStopPolicy configures early stopping for iterative runs
+func (p *Pipeline) SetStopPolicy(policy StopPolicy) {
+	p.stopPolicy = policy
+}
+
+// stopReason returns why the loop should stop after the latest iteration, or "" to continue
+func (p *Pipeline) stopReason(state *iterativeState) string {
+	results := state.iterationResults
+	latest := results[len(results)-1]
+
+	if p.stopPolicy.TokenBudget > 0 && state.session.TotalTokens >= p.stopPolicy.TokenBudget {
+		fmt.Printf("  └─ Stopping: token budget exhausted (%d/%d)\n", state.session.TotalTokens, p.stopPolicy.TokenBudget)
+		return StopTokenBudget
+	}
+
+	if p.stopPolicy.IdenticalSQL {
+		latestSQL := normalizeSQL(latest.GeneratedSQL)
+		for _, earlier := range results[:len(results)-1] {
+			if normalizeSQL(earlier.GeneratedSQL) == latestSQL {
+				fmt.Printf("  └─ Stopping: iteration %d returned the same SQL as iteration %d\n", latest.Iteration, earlier.Iteration)
+				return StopIdenticalSQL
+			}
+		}
+	}
+
+	if p.stopPolicy.UnchangedErrors && len(results) >= 2 {
+		previous := results[len(results)-2]
+		if errorSet(previous) == errorSet(latest) {
+			fmt.Printf("  └─ Stopping: iteration %d reported the same errors as iteration %d\n", latest.Iteration, previous.Iteration)
+			return StopUnchangedErrors
+		}
+	}
+
+	if p.stopPolicy.NoImprovement > 0 {
+		best := results[p.bestIteration(results)]
+		if since := latest.Iteration - best.Iteration; since >= p.stopPolicy.NoImprovement {
+			fmt.Printf("  └─ Stopping: no improvement in %d iterations (best was iteration %d)\n", since, best.Iteration)
+			return StopNoImprovement
+		}
+	}
+
+	return ""
+}
+
+// finalStopReason is the reason recorded when no early stopping policy triggered
+func finalStopReason(fr models.TestFileResult) string {
+	if testSucceeded(fr) {
+		return StopSuccess
+	}
+	if analysisPassed(fr) {
+		return StopAnalyzed
+	}
+	return StopMaxIterations
+}
+
+// normalizeSQL collapses whitespace and case so cosmetic differences do not count as changes
+func normalizeSQL(sql string) string {
+	return strings.ToLower(strings.Join(strings.Fields(sql), " "))
+}
+
+// errorSet builds a canonical representation of the parse and execution errors of an iteration
+func errorSet(result IterationResult) string {
+	errors := append([]string(nil), result.TestResults.ParseErrors...)
+	errors = append(errors, result.TestResults.ExecutionErrors...)
+	sort.Strings(errors)
+	return strings.Join(errors, "\n")
+}
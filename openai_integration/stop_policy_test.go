@@ -0,0 +1,141 @@
+package integration
+
+import (
+	"testing"
+
+	"sql-parser/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stopIteration is an iteration result with the given SQL, score and execution errors
+func stopIteration(iteration int, sql string, score float64, errors ...string) IterationResult {
+	return IterationResult{
+		Iteration:    iteration,
+		GeneratedSQL: sql,
+		Score:        score,
+		TestResults:  models.TestFileResult{ExecutionErrors: errors},
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     StopPolicy
+		tokens     int
+		iterations []IterationResult
+		expected   string
+	}{
+		{
+			name:       "no policy",
+			iterations: []IterationResult{stopIteration(1, "A", 0.5, "e1"), stopIteration(2, "A", 0.5, "e1")},
+			expected:   "",
+		},
+		{
+			name:       "token budget exhausted",
+			policy:     StopPolicy{TokenBudget: 1000},
+			tokens:     1000,
+			iterations: []IterationResult{stopIteration(1, "A", 0.5, "e1")},
+			expected:   StopTokenBudget,
+		},
+		{
+			name:       "token budget left",
+			policy:     StopPolicy{TokenBudget: 1000},
+			tokens:     999,
+			iterations: []IterationResult{stopIteration(1, "A", 0.5, "e1")},
+			expected:   "",
+		},
+		{
+			name:   "identical SQL up to case and whitespace",
+			policy: StopPolicy{IdenticalSQL: true},
+			iterations: []IterationResult{
+				stopIteration(1, "SELECT  1;", 0.5, "e1"),
+				stopIteration(2, "CREATE TABLE T;", 0.5, "e2"),
+				stopIteration(3, "select 1;\n", 0.5, "e3"),
+			},
+			expected: StopIdenticalSQL,
+		},
+		{
+			name:       "changed SQL",
+			policy:     StopPolicy{IdenticalSQL: true},
+			iterations: []IterationResult{stopIteration(1, "SELECT 1;", 0.5, "e1"), stopIteration(2, "SELECT 2;", 0.5, "e1")},
+			expected:   "",
+		},
+		{
+			name:       "unchanged errors in any order",
+			policy:     StopPolicy{UnchangedErrors: true},
+			iterations: []IterationResult{stopIteration(1, "A", 0.5, "e1", "e2"), stopIteration(2, "B", 0.5, "e2", "e1")},
+			expected:   StopUnchangedErrors,
+		},
+		{
+			name:       "changed errors",
+			policy:     StopPolicy{UnchangedErrors: true},
+			iterations: []IterationResult{stopIteration(1, "A", 0.5, "e1", "e2"), stopIteration(2, "B", 0.5, "e1")},
+			expected:   "",
+		},
+		{
+			name:       "unchanged errors need two iterations",
+			policy:     StopPolicy{UnchangedErrors: true},
+			iterations: []IterationResult{stopIteration(1, "A", 0.5, "e1")},
+			expected:   "",
+		},
+		{
+			name:   "no improvement",
+			policy: StopPolicy{NoImprovement: 2},
+			iterations: []IterationResult{
+				stopIteration(1, "A", 0.5, "e1"),
+				stopIteration(2, "B", 0.4, "e2"),
+				stopIteration(3, "C", 0.5, "e3"),
+			},
+			expected: StopNoImprovement,
+		},
+		{
+			name:   "improvement resets the count",
+			policy: StopPolicy{NoImprovement: 2},
+			iterations: []IterationResult{
+				stopIteration(1, "A", 0.5, "e1"),
+				stopIteration(2, "B", 0.6, "e2"),
+				stopIteration(3, "C", 0.4, "e3"),
+			},
+			expected: "",
+		},
+		{
+			name:       "token budget is checked first",
+			policy:     StopPolicy{TokenBudget: 10, IdenticalSQL: true},
+			tokens:     10,
+			iterations: []IterationResult{stopIteration(1, "A", 0.5, "e1"), stopIteration(2, "A", 0.5, "e1")},
+			expected:   StopTokenBudget,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Pipeline{stopPolicy: tt.policy}
+			state := &iterativeState{
+				session:          &ConversationSession{TotalTokens: tt.tokens},
+				iterationResults: tt.iterations,
+			}
+			assert.Equal(t, tt.expected, p.stopReason(state))
+		})
+	}
+}
+
+func TestFinalStopReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   models.TestFileResult
+		expected string
+	}{
+		{name: "success", result: models.TestFileResult{TotalStatements: 2, ExecutedCount: 2}, expected: StopSuccess},
+		{name: "parse errors", result: models.TestFileResult{ParseErrors: []string{"syntax error"}}, expected: StopMaxIterations},
+		{name: "execution errors", result: models.TestFileResult{ExecutionErrors: []string{"not found"}}, expected: StopMaxIterations},
+		{name: "offline without errors", result: models.TestFileResult{Offline: true, AnalyzedCount: 2}, expected: StopAnalyzed},
+		{name: "offline with semantic errors", result: models.TestFileResult{Offline: true, ExecutionErrors: []string{"semantic analysis: unknown column"}}, expected: StopMaxIterations},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, finalStopReason(tt.result))
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Extraction methods recorded in ExtractionInfo
+	ExtractionStructured  = "structured"
+	ExtractionFencedBlock = "fenced_block"
+
+	// DefaultStructuredRetries is how many times an invalid JSON response is re-requested
+	DefaultStructuredRetries = 2
+)
+
+// StructuredOutputInstructions is appended to the initial prompt when structured output is enabled
+const StructuredOutputInstructions = `Respond with a JSON object following the provided schema instead of a code block.
+Put every translated SQL statement, in execution order, as a separate entry of "statements".
+Use "notes" for a short explanation of the statement and "assumptions" for any assumption you made (empty list if none).`
+
+// StructuredStatement is a single translated statement returned in structured output mode
+type StructuredStatement struct {
+	SQL         string   `json:"sql"`
+	Notes       string   `json:"notes"`
+	Assumptions []string `json:"assumptions"`
+}
+
+// StructuredSQLResponse is the JSON document the model returns in structured output mode
+type StructuredSQLResponse struct {
+	Statements []StructuredStatement `json:"statements"`
+}
+
+// SQLResponseFormat returns the JSON schema response format for translated SQL
+func SQLResponseFormat() *ResponseFormat {
+	return &ResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &JSONSchemaSpec{
+			Name:   "translated_sql",
+			Strict: true,
+			Schema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"statements": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"sql":   map[string]any{"type": "string"},
+								"notes": map[string]any{"type": "string"},
+								"assumptions": map[string]any{
+									"type":  "array",
+									"items": map[string]any{"type": "string"},
+								},
+							},
+							"required":             []string{"sql", "notes", "assumptions"},
+							"additionalProperties": false,
+						},
+					},
+				},
+				"required":             []string{"statements"},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// ParseStructuredSQLResponse decodes and validates a structured output response
+func ParseStructuredSQLResponse(content string) (*StructuredSQLResponse, error) {
+	content = strings.TrimSpace(content)
+
+	// Some models still wrap the JSON in a code block
+	if strings.HasPrefix(content, "```") {
+		if newline := strings.Index(content, "\n"); newline != -1 {
+			content = content[newline+1:]
+		}
+		content = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(content), "```"))
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(content)))
+	decoder.DisallowUnknownFields()
+
+	var response StructuredSQLResponse
+	if err := decoder.Decode(&response); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if len(response.Statements) == 0 {
+		return nil, fmt.Errorf("no statements in response")
+	}
+	for i, stmt := range response.Statements {
+		if strings.TrimSpace(stmt.SQL) == "" {
+			return nil, fmt.Errorf("statement %d has empty sql", i+1)
+		}
+	}
+
+	return &response, nil
+}
+
+// Script joins the statements into a single SQL script
+func (r *StructuredSQLResponse) Script() string {
+	var script strings.Builder
+	for i, stmt := range r.Statements {
+		if i > 0 {
+			script.WriteString("\n\n")
+		}
+		sql := strings.TrimSpace(stmt.SQL)
+		script.WriteString(sql)
+		if !strings.HasSuffix(sql, ";") {
+			script.WriteString(";")
+		}
+	}
+	return script.String()
+}
+
+// structuredRetryPrompt asks the model to resend a response that failed validation
+func structuredRetryPrompt(validationErr error) string {
+	return fmt.Sprintf("Your previous response could not be used: %v. "+
+		"Reply again with only a JSON object that follows the schema, containing the complete translated SQL.", validationErr)
+}
+
+// extractSQL gets the SQL script out of a model response. In structured output mode the JSON
+// is validated and re-requested on failure, falling back to the fenced block extractor.
+func (p *Pipeline) extractSQL(sessionID, response, label string) (string, *ExtractionInfo, error) {
+	if !p.structuredOutput {
+		sql, warnings := p.promptReader.ExtractSQLWithWarnings(response)
+		p.printExtractionWarnings(warnings)
+		return sql, &ExtractionInfo{Method: ExtractionFencedBlock, Warnings: warnings}, nil
+	}
+
+	extraction := &ExtractionInfo{}
+	for {
+		structured, err := ParseStructuredSQLResponse(response)
+		if err == nil {
+			extraction.Method = ExtractionStructured
+			extraction.Statements = structured.Statements
+			return structured.Script(), extraction, nil
+		}
+
+		extraction.ValidationErrors = append(extraction.ValidationErrors, err.Error())
+		if extraction.Retries >= p.structuredRetries {
+			break
+		}
+
+		extraction.Retries++
+		fmt.Printf("  └─ Invalid structured response (%v), re-asking %d/%d...\n", err, extraction.Retries, p.structuredRetries)
+		retryPrompt := structuredRetryPrompt(err)
+		p.savePromptToDebugFile(fmt.Sprintf("STRUCTURED RETRY PROMPT (%s)", label), retryPrompt)
+
+		response, _, err = p.requestResponse(sessionID, retryPrompt, label)
+		if err != nil {
+			return "", extraction, fmt.Errorf("failed to re-ask for structured response: %w", err)
+		}
+		p.savePromptToDebugFile(fmt.Sprintf("AI STRUCTURED RETRY (%s)", label), response)
+	}
+
+	fmt.Printf("  └─ Warning: falling back to code block extraction\n")
+	extraction.Method = ExtractionFencedBlock
+	sql, warnings := p.promptReader.ExtractSQLWithWarnings(response)
+	p.printExtractionWarnings(warnings)
+	extraction.Warnings = warnings
+	return sql, extraction, nil
+}
+
+func (p *Pipeline) printExtractionWarnings(warnings []string) {
+	for _, warning := range warnings {
+		fmt.Printf("  └─ Extraction warning: %s\n", warning)
+	}
+}
@@ -6,8 +6,34 @@ import (
 )
 
 type ConversationMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a function call requested by the model
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Tool describes a function the model is allowed to call
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
 }
 
 type ConversationSession struct {
@@ -19,6 +45,16 @@ type ConversationSession struct {
 	MessageCount   int       `json:"message_count"`
 	LastMessageID  string    `json:"last_message_id"`
 	LastResponseID string    `json:"last_response_id"`
+	// Mode is the conversation mode (local, conversations or responses)
+	Mode             string `json:"mode"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+	// History strategy statistics, see HistoryStrategy
+	HistoryStrategy   string `json:"history_strategy,omitempty"`
+	PeakContextTokens int    `json:"peak_context_tokens,omitempty"`
+	HistoryTrimmed    int    `json:"history_trimmed,omitempty"`
+	HistorySummaries  int    `json:"history_summaries,omitempty"`
 }
 
 type OpenAIRequest struct {
@@ -28,6 +64,23 @@ type OpenAIRequest struct {
 	TopP                float64               `json:"top_p,omitempty"`
 	MaxTokens           int                   `json:"max_tokens,omitempty"`
 	MaxCompletionTokens int                   `json:"max_completion_tokens,omitempty"`
+	Tools               []Tool                `json:"tools,omitempty"`
+	ToolChoice          string                `json:"tool_choice,omitempty"`
+	ResponseFormat      *ResponseFormat       `json:"response_format,omitempty"`
+	ReasoningEffort     string                `json:"reasoning_effort,omitempty"`
+	N                   int                   `json:"n,omitempty"`
+}
+
+// ResponseFormat requests JSON or schema-constrained output from the API
+type ResponseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema *JSONSchemaSpec `json:"json_schema,omitempty"`
+}
+
+type JSONSchemaSpec struct {
+	Name   string         `json:"name"`
+	Strict bool           `json:"strict"`
+	Schema map[string]any `json:"schema"`
 }
 
 type OpenAIResponse struct {
@@ -38,8 +91,9 @@ type OpenAIResponse struct {
 	Choices []struct {
 		Index   int `json:"index"`
 		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
+			Role      string     `json:"role"`
+			Content   string     `json:"content"`
+			ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 		} `json:"message"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
@@ -55,6 +109,37 @@ type IterationResult struct {
 	TestResults  models.TestFileResult `json:"test_results"`
 	Success      bool                  `json:"success"`
 	GeneratedSQL string                `json:"generated_sql"`
+	// Truncation holds details when the model hit the token limit while producing this iteration's SQL
+	Truncation *TruncationInfo `json:"truncation,omitempty"`
+	Extraction *ExtractionInfo `json:"extraction,omitempty"`
+	// Candidates holds the score of every sampled candidate when best-of-N sampling is enabled
+	Candidates []CandidateScore `json:"candidates,omitempty"`
+	// Score is the iteration's value for the configured metric, see ScoreTestResultBy
+	Score float64 `json:"score"`
+	// HistoryLength and ResponseID locate the conversation right after this iteration's answer
+	HistoryLength int    `json:"history_length"`
+	ResponseID    string `json:"response_id,omitempty"`
+	// RolledBack is set when this iteration regressed and the conversation was restored to the best one
+	RolledBack bool `json:"rolled_back,omitempty"`
+	// Guidelines lists the guideline sections retrieved for the prompt that produced this iteration
+	Guidelines []string `json:"guidelines,omitempty"`
+}
+
+// ExtractionInfo records how the SQL of an iteration was obtained from the model response
+type ExtractionInfo struct {
+	Method           string                `json:"method"`
+	Retries          int                   `json:"retries"`
+	ValidationErrors []string              `json:"validation_errors,omitempty"`
+	Warnings         []string              `json:"warnings,omitempty"`
+	Statements       []StructuredStatement `json:"statements,omitempty"`
+}
+
+// TruncationInfo records how a truncated model output was recovered
+type TruncationInfo struct {
+	Truncated     bool     `json:"truncated"`
+	Continuations int      `json:"continuations"`
+	Recovered     bool     `json:"recovered"`
+	FinishReasons []string `json:"finish_reasons"`
 }
 
 type PipelineResult struct {
@@ -69,20 +154,113 @@ type PipelineResult struct {
 	Messages         []ConversationMessage `json:"messages"`
 	TotalTime        time.Duration         `json:"total_time"`
 	TokensUsed       int                   `json:"tokens_used"`
+	PromptTokens     int                   `json:"prompt_tokens"`
+	CompletionTokens int                   `json:"completion_tokens"`
 	ExecutionMode    string                `json:"execution_mode"`
+	StopReason       string                `json:"stop_reason"`
 	Timestamp        time.Time             `json:"timestamp"`
+	ToolCalls        []AgentToolCall       `json:"tool_calls,omitempty"`
+	// Best* describe the best scoring iteration, which may differ from the final one
+	BestIteration    int                   `json:"best_iteration"`
+	BestGeneratedSQL string                `json:"best_generated_sql"`
+	BestTestResults  models.TestFileResult `json:"best_test_results"`
+	BestSuccess      bool                  `json:"best_success"`
+}
+
+// AgentToolCall records a tool invocation made by the model in agent mode
+type AgentToolCall struct {
+	Name      string        `json:"name"`
+	Arguments string        `json:"arguments"`
+	Result    string        `json:"result"`
+	Failed    bool          `json:"failed"`
+	Duration  time.Duration `json:"duration"`
 }
 
 type OpenAIConfig struct {
-	APIKey      string  `json:"api_key"`
-	Model       string  `json:"model"`
-	Temperature float64 `json:"temperature"`
-	MaxTokens   int     `json:"max_tokens"`
-	BaseURL     string  `json:"base_url"`
-	Verbose     bool    `json:"verbose"`
+	APIKey          string  `json:"api_key"`
+	Model           string  `json:"model"`
+	Temperature     float64 `json:"temperature"`
+	TopP            float64 `json:"top_p"`
+	MaxTokens       int     `json:"max_tokens"`
+	ReasoningEffort string  `json:"reasoning_effort"`
+	BaseURL         string  `json:"base_url"`
+	Verbose         bool    `json:"verbose"`
 }
 
 type CreateConversationRequest struct {
+	Items []ResponseInputItem `json:"items,omitempty"`
+}
+
+// ResponseInputItem is a message item of the Responses and Conversations APIs
+type ResponseInputItem struct {
+	Type    string `json:"type"`
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type AddItemsRequest struct {
+	Items []ResponseInputItem `json:"items"`
+}
+
+type AddItemsResponse struct {
+	Object string `json:"object"`
+	Data   []struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"data"`
+}
+
+// ResponsesRequest is the request body of the Responses API
+type ResponsesRequest struct {
+	Model              string               `json:"model"`
+	Input              []ResponseInputItem  `json:"input"`
+	Conversation       string               `json:"conversation,omitempty"`
+	PreviousResponseID string               `json:"previous_response_id,omitempty"`
+	Store              bool                 `json:"store"`
+	Temperature        float64              `json:"temperature,omitempty"`
+	TopP               float64              `json:"top_p,omitempty"`
+	MaxOutputTokens    int                  `json:"max_output_tokens,omitempty"`
+	Text               *ResponsesTextConfig `json:"text,omitempty"`
+	Reasoning          *ResponsesReasoning  `json:"reasoning,omitempty"`
+}
+
+type ResponsesReasoning struct {
+	Effort string `json:"effort"`
+}
+
+type ResponsesTextConfig struct {
+	Format ResponsesTextFormat `json:"format"`
+}
+
+type ResponsesTextFormat struct {
+	Type   string         `json:"type"`
+	Name   string         `json:"name,omitempty"`
+	Strict bool           `json:"strict,omitempty"`
+	Schema map[string]any `json:"schema,omitempty"`
+}
+
+// ResponsesResponse is the response body of the Responses API
+type ResponsesResponse struct {
+	ID                string `json:"id"`
+	Object            string `json:"object"`
+	CreatedAt         int64  `json:"created_at"`
+	Status            string `json:"status"`
+	IncompleteDetails struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details"`
+	Output []struct {
+		Type    string `json:"type"`
+		Role    string `json:"role"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"output"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
 }
 
 type CreateConversationResponse struct {
@@ -119,6 +297,7 @@ type GetResponseResponse struct {
 	ConversationID string `json:"conversation_id"`
 	Role           string `json:"role"`
 	Content        string `json:"content"`
+	FinishReason   string `json:"finish_reason"`
 	Usage          struct {
 		PromptTokens     int `json:"prompt_tokens"`
 		CompletionTokens int `json:"completion_tokens"`
@@ -137,6 +316,16 @@ type IterationMetrics struct {
 	ExecutionSuccessRate float64 `json:"execution_success_rate"`
 	OverallSuccessRate   float64 `json:"overall_success_rate"`
 	Success              bool    `json:"success"`
+	Truncated            bool    `json:"truncated,omitempty"`
+	Continuations        int     `json:"continuations,omitempty"`
+	ExtractionMethod     string  `json:"extraction_method,omitempty"`
+	ExtractionWarnings   int     `json:"extraction_warnings,omitempty"`
+	// Candidate counts for pass@k: candidates sampled and candidates that fully succeeded
+	Candidates       int       `json:"candidates,omitempty"`
+	CandidatesPassed int       `json:"candidates_passed,omitempty"`
+	CandidateScores  []float64 `json:"candidate_scores,omitempty"`
+	RolledBack       bool      `json:"rolled_back,omitempty"`
+	Guidelines       []string  `json:"guidelines,omitempty"`
 }
 
 type ExecutionMetrics struct {
@@ -147,8 +336,47 @@ type ExecutionMetrics struct {
 	TotalIterations    int                `json:"total_iterations"`
 	ShortPrompts       bool               `json:"short_prompts"`
 	MoreContextEnabled bool               `json:"more_context"`
+	HadTruncation      bool               `json:"had_truncation,omitempty"`
+	ToolCallCount      int                `json:"tool_call_count,omitempty"`
+	StructuredOutput   bool               `json:"structured_output,omitempty"`
+	ConversationMode   string             `json:"conversation_mode,omitempty"`
+	PromptTokens       int                `json:"prompt_tokens,omitempty"`
+	TokensUsed         int                `json:"tokens_used,omitempty"`
+	EstimatedCostUSD   float64            `json:"estimated_cost_usd,omitempty"`
+	ReasoningEffort    string             `json:"reasoning_effort,omitempty"`
+	FewShot            *FewShotSelection  `json:"few_shot,omitempty"`
+	Candidates         int                `json:"candidates,omitempty"`
+	ScoreMetric        string             `json:"score_metric,omitempty"`
+	StopReason         string             `json:"stop_reason,omitempty"`
+	TaskID             string             `json:"task_id,omitempty"`
+	Experiment         *ExperimentTag     `json:"experiment,omitempty"`
+	QueriesPassed      int                `json:"queries_passed,omitempty"`
+	QueriesTotal       int                `json:"queries_total,omitempty"`
+	FeedbackStrategy   string             `json:"feedback_strategy,omitempty"`
+	GuidelineMode      string             `json:"guideline_mode,omitempty"`
+	TargetDialect      string             `json:"target_dialect,omitempty"`
+	SemanticCheck      string             `json:"semantic_check,omitempty"`
+	FinalScore         float64            `json:"final_score"`
+	BestIteration      int                `json:"best_iteration,omitempty"`
+	BestScore          float64            `json:"best_score"`
+	BestSuccess        bool               `json:"best_success"`
+	Rollbacks          int                `json:"rollbacks,omitempty"`
+	PromptTemplates    string             `json:"prompt_templates,omitempty"`
+	TemplateHash       string             `json:"template_hash,omitempty"`
+	HistoryStrategy    string             `json:"history_strategy,omitempty"`
+	HistoryTurns       int                `json:"history_turns,omitempty"`
+	PeakContextTokens  int                `json:"peak_context_tokens,omitempty"`
+	HistoryTrimmed     int                `json:"history_trimmed,omitempty"`
+	HistorySummaries   int                `json:"history_summaries,omitempty"`
 	IterationResults   []IterationMetrics `json:"iteration_results"`
 	Timestamp          time.Time          `json:"timestamp"`
+
+	// SchemaFidelity compares the final translation with the schema of the PostgreSQL source
+	SchemaFidelity *models.SchemaFidelity `json:"schema_fidelity,omitempty"`
+	// Offline runs only checked the final SQL with the semantic analysis: Analyzed statements passed
+	// it and none was executed, so the run never counts as a success
+	Offline  bool `json:"offline,omitempty"`
+	Analyzed int  `json:"analyzed,omitempty"`
 }
 
 type AccumulatedResults struct {
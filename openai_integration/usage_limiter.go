@@ -0,0 +1,127 @@
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrSpendCapReached is returned for requests made once the spend cap of a UsageLimiter is used up
+var ErrSpendCapReached = errors.New("spend cap reached")
+
+// limiterWindow is the period over which requests and tokens per minute are counted
+const limiterWindow = time.Minute
+
+// UsageLimiter is shared by every client of a batch of runs. It keeps the requests and tokens sent
+// in the last minute under the account limits and stops requests once the estimated spend reaches
+// the cap. A zero limit disables that check.
+type UsageLimiter struct {
+	rpm      int
+	tpm      int
+	spendCap float64
+
+	// now and sleep are the clock of the limiter, replaced in tests
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	mu       sync.Mutex
+	window   []*limiterReservation
+	requests int
+	tokens   int
+	spent    float64
+}
+
+// limiterReservation is a request counted in the window, with its estimated tokens until the
+// response reports the real usage
+type limiterReservation struct {
+	at     time.Time
+	tokens int
+}
+
+// NewUsageLimiter creates a limiter for requests per minute, tokens per minute and total spend in USD
+func NewUsageLimiter(rpm, tpm int, spendCapUSD float64) *UsageLimiter {
+	return &UsageLimiter{rpm: rpm, tpm: tpm, spendCap: spendCapUSD, now: time.Now, sleep: time.Sleep}
+}
+
+// acquire blocks until a request of about estimatedTokens fits in the per minute limits
+func (l *UsageLimiter) acquire(estimatedTokens int) (*limiterReservation, error) {
+	for {
+		l.mu.Lock()
+		if l.spendCap > 0 && l.spent >= l.spendCap {
+			l.mu.Unlock()
+			return nil, fmt.Errorf("%w ($%.4f of $%.4f)", ErrSpendCapReached, l.spent, l.spendCap)
+		}
+
+		now := l.now()
+		l.expire(now)
+		windowTokens := 0
+		for _, r := range l.window {
+			windowTokens += r.tokens
+		}
+
+		// A request larger than the token limit is still let through once the window is empty
+		fitsRequests := l.rpm <= 0 || len(l.window) < l.rpm
+		fitsTokens := l.tpm <= 0 || len(l.window) == 0 || windowTokens+estimatedTokens <= l.tpm
+		if fitsRequests && fitsTokens {
+			reservation := &limiterReservation{at: now, tokens: estimatedTokens}
+			l.window = append(l.window, reservation)
+			l.requests++
+			l.mu.Unlock()
+			return reservation, nil
+		}
+
+		wait := l.window[0].at.Add(limiterWindow).Sub(now)
+		l.mu.Unlock()
+		l.sleep(wait)
+	}
+}
+
+// record replaces the estimate of a reservation with the tokens and cost reported by the API
+func (l *UsageLimiter) record(reservation *limiterReservation, tokens int, costUSD float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	reservation.tokens = tokens
+	l.tokens += tokens
+	l.spent += costUSD
+}
+
+// expire drops the reservations older than the window; callers hold l.mu
+func (l *UsageLimiter) expire(now time.Time) {
+	i := 0
+	for i < len(l.window) && now.Sub(l.window[i].at) >= limiterWindow {
+		i++
+	}
+	l.window = l.window[i:]
+}
+
+// Exhausted reports whether the spend cap has been reached
+func (l *UsageLimiter) Exhausted() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.spendCap > 0 && l.spent >= l.spendCap
+}
+
+// Usage returns the requests, tokens and estimated spend recorded so far
+func (l *UsageLimiter) Usage() (requests, tokens int, spentUSD float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.requests, l.tokens, l.spent
+}
+
+// responseUsage reads the token usage of a chat completions or Responses API response body
+func responseUsage(body []byte) (promptTokens, completionTokens int) {
+	var response struct {
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			InputTokens      int `json:"input_tokens"`
+			OutputTokens     int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return 0, 0
+	}
+	return response.Usage.PromptTokens + response.Usage.InputTokens, response.Usage.CompletionTokens + response.Usage.OutputTokens
+}
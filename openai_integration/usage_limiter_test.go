@@ -0,0 +1,89 @@
+package integration
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock only moves when the limiter sleeps or the test advances it
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) sleep(d time.Duration) {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter(rpm, tpm int, spendCapUSD float64) (*UsageLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewUsageLimiter(rpm, tpm, spendCapUSD)
+	limiter.now = func() time.Time { return clock.now }
+	limiter.sleep = clock.sleep
+	return limiter, clock
+}
+
+func TestUsageLimiterRequestsPerMinute(t *testing.T) {
+	limiter, clock := newTestLimiter(2, 0, 0)
+
+	_, err := limiter.acquire(10)
+	require.NoError(t, err)
+	clock.now = clock.now.Add(10 * time.Second)
+	_, err = limiter.acquire(10)
+	require.NoError(t, err)
+	assert.Empty(t, clock.slept)
+
+	// The third request waits until the first one leaves the window
+	_, err = limiter.acquire(10)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{50 * time.Second}, clock.slept)
+
+	requests, _, _ := limiter.Usage()
+	assert.Equal(t, 3, requests)
+}
+
+func TestUsageLimiterTokensPerMinute(t *testing.T) {
+	limiter, clock := newTestLimiter(0, 100, 0)
+
+	// A request larger than the limit goes through on an empty window
+	first, err := limiter.acquire(500)
+	require.NoError(t, err)
+	assert.Empty(t, clock.slept)
+
+	// The reported usage replaces the estimate
+	limiter.record(first, 30, 0)
+	_, err = limiter.acquire(60)
+	require.NoError(t, err)
+	assert.Empty(t, clock.slept)
+
+	_, err = limiter.acquire(20)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Minute}, clock.slept)
+
+	_, tokens, _ := limiter.Usage()
+	assert.Equal(t, 30, tokens)
+}
+
+func TestUsageLimiterSpendCap(t *testing.T) {
+	limiter, _ := newTestLimiter(0, 0, 1.0)
+
+	reservation, err := limiter.acquire(10)
+	require.NoError(t, err)
+	assert.False(t, limiter.Exhausted())
+
+	limiter.record(reservation, 10, 1.0)
+	assert.True(t, limiter.Exhausted())
+
+	_, err = limiter.acquire(10)
+	assert.True(t, errors.Is(err, ErrSpendCapReached), err)
+
+	requests, tokens, spent := limiter.Usage()
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, 10, tokens)
+	assert.InDelta(t, 1.0, spent, 1e-9)
+}
@@ -0,0 +1,158 @@
+package integration
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval is how often a WorkerPool prints its progress line
+const DefaultProgressInterval = 10 * time.Second
+
+// WorkerPool runs a batch of jobs on a fixed number of workers, so a batch of any size only has
+// that many pipelines, API conversations and emulators active at a time
+type WorkerPool struct {
+	workers          int
+	limiter          *UsageLimiter
+	progressInterval time.Duration
+}
+
+// PoolStats counts the outcome of the jobs of a batch. Skipped jobs were never started because
+// the spend cap was reached.
+type PoolStats struct {
+	Total     int
+	Succeeded int
+	Failed    int
+	Skipped   int
+	Elapsed   time.Duration
+}
+
+// NewWorkerPool creates a pool with the given number of workers
+func NewWorkerPool(workers int) *WorkerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &WorkerPool{workers: workers, progressInterval: DefaultProgressInterval}
+}
+
+// SetLimiter makes the pool report the shared usage and stop starting jobs once the spend cap is reached
+func (wp *WorkerPool) SetLimiter(limiter *UsageLimiter) {
+	wp.limiter = limiter
+}
+
+// SetProgressInterval sets how often the progress line is printed, 0 disables it
+func (wp *WorkerPool) SetProgressInterval(interval time.Duration) {
+	wp.progressInterval = interval
+}
+
+// Run calls job for every index in [0, total) and waits for them to finish. A job fails when it
+// returns an error.
+func (wp *WorkerPool) Run(total int, job func(index int) error) PoolStats {
+	start := time.Now()
+	stats := PoolStats{Total: total}
+	var mu sync.Mutex
+	inFlight := 0
+
+	progress := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		wp.printProgress(stats, inFlight, time.Since(start))
+	}
+
+	indexes := make(chan int)
+	go func() {
+		defer close(indexes)
+		for i := 0; i < total; i++ {
+			indexes <- i
+		}
+	}()
+
+	// The cap is checked when a worker picks a job up, so a job is never started after an earlier
+	// one used up the budget. Spend only grows, so every later job is skipped too.
+	var capReached sync.Once
+	exhausted := func(index int) bool {
+		if wp.limiter == nil || !wp.limiter.Exhausted() {
+			return false
+		}
+		capReached.Do(func() {
+			fmt.Printf("Spend cap reached, skipping the remaining %d job(s)\n", total-index)
+		})
+		return true
+	}
+
+	stop := make(chan struct{})
+	if wp.progressInterval > 0 {
+		ticker := time.NewTicker(wp.progressInterval)
+		go func() {
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					progress()
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < wp.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if exhausted(i) {
+					mu.Lock()
+					stats.Skipped++
+					mu.Unlock()
+					continue
+				}
+
+				mu.Lock()
+				inFlight++
+				mu.Unlock()
+
+				err := job(i)
+
+				mu.Lock()
+				inFlight--
+				if err != nil {
+					stats.Failed++
+				} else {
+					stats.Succeeded++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+
+	stats.Elapsed = time.Since(start)
+	if wp.progressInterval > 0 {
+		progress()
+	}
+	return stats
+}
+
+// printProgress prints one line with the done, failed and in-flight jobs, the ETA and the spend
+func (wp *WorkerPool) printProgress(stats PoolStats, inFlight int, elapsed time.Duration) {
+	finished := stats.Succeeded + stats.Failed
+	remaining := stats.Total - finished - stats.Skipped
+
+	eta := "unknown"
+	if remaining == 0 {
+		eta = "0s"
+	} else if finished > 0 {
+		eta = (elapsed / time.Duration(finished) * time.Duration(remaining)).Round(time.Second).String()
+	}
+
+	line := fmt.Sprintf("Progress: %d/%d done | %d failed | %d in flight | elapsed %v | ETA %s",
+		finished, stats.Total, stats.Failed, inFlight, elapsed.Round(time.Second), eta)
+	if wp.limiter != nil {
+		requests, tokens, spent := wp.limiter.Usage()
+		line += fmt.Sprintf(" | %d requests, %d tokens, $%.4f", requests, tokens, spent)
+	}
+	fmt.Println(line)
+}
@@ -0,0 +1,58 @@
+package integration
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPoolRun(t *testing.T) {
+	pool := NewWorkerPool(3)
+	pool.SetProgressInterval(0)
+
+	var mu sync.Mutex
+	runs := make(map[int]int)
+	stats := pool.Run(10, func(index int) error {
+		mu.Lock()
+		runs[index]++
+		mu.Unlock()
+		if index%2 == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	assert.Equal(t, 10, stats.Total)
+	assert.Equal(t, 5, stats.Succeeded)
+	assert.Equal(t, 5, stats.Failed)
+	assert.Equal(t, 0, stats.Skipped)
+	require.Len(t, runs, 10)
+	for index, count := range runs {
+		assert.Equal(t, 1, count, "job %d", index)
+	}
+}
+
+func TestWorkerPoolSpendCap(t *testing.T) {
+	limiter, _ := newTestLimiter(0, 0, 1.0)
+	pool := NewWorkerPool(1)
+	pool.SetProgressInterval(0)
+	pool.SetLimiter(limiter)
+
+	var started []int
+	stats := pool.Run(6, func(index int) error {
+		started = append(started, index)
+		reservation, err := limiter.acquire(10)
+		if err != nil {
+			return err
+		}
+		limiter.record(reservation, 10, 0.4)
+		return nil
+	})
+
+	// The third job brings the spend to the cap, the remaining ones are never started
+	assert.Equal(t, []int{0, 1, 2}, started)
+	assert.Equal(t, PoolStats{Total: 6, Succeeded: 3, Skipped: 3, Elapsed: stats.Elapsed}, stats)
+}
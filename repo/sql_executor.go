@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -15,6 +16,8 @@ type SQLExecutor struct {
 	createdTables []string
 	tableSchemas  map[string]map[string]string // table -> column -> type
 	uuidRegistry  map[string]string            // logical_key -> actual_uuid
+	// postgres switches parameter handling and schema extraction to Spanner's PostgreSQL dialect
+	postgres bool
 }
 
 // NewSQLExecutor creates a new SQL executor instance
@@ -28,6 +31,14 @@ func NewSQLExecutor(db *sql.DB, repo Database) *SQLExecutor {
 	}
 }
 
+// NewPostgreSQLExecutor creates an executor for a PostgreSQL dialect database reached through
+// PGAdapter: parameters are $n only, and RETURNING takes the place of THEN RETURN
+func NewPostgreSQLExecutor(db *sql.DB, repo Database) *SQLExecutor {
+	e := NewSQLExecutor(db, repo)
+	e.postgres = true
+	return e
+}
+
 // ExecutionResult contains the results of executing SQL statements
 type ExecutionResult struct {
 	TotalStatements  int
@@ -42,6 +53,17 @@ type ExecutionResult struct {
 	QueryResults     []QueryResult
 }
 
+// StatementError is an execution error together with the statement that caused it.
+// Its message is the message of the wrapped error.
+type StatementError struct {
+	Statement string
+	Err       error
+}
+
+func (e *StatementError) Error() string { return e.Err.Error() }
+
+func (e *StatementError) Unwrap() error { return e.Err }
+
 // InsertResult contains information about an insert operation
 type InsertResult struct {
 	Statement string
@@ -91,7 +113,7 @@ func (e *SQLExecutor) ExecuteStatements(statements []string) (*ExecutionResult,
 	// 1. Execute DROP statements first (for cleanup)
 	for _, stmt := range dropStmts {
 		if err := e.executeDrop(stmt); err != nil {
-			result.Errors = append(result.Errors, fmt.Errorf("DROP failed: %w", err))
+			result.Errors = append(result.Errors, &StatementError{Statement: stmt, Err: fmt.Errorf("DROP failed: %w", err)})
 		} else {
 			result.ExecutedCount++
 		}
@@ -100,7 +122,7 @@ func (e *SQLExecutor) ExecuteStatements(statements []string) (*ExecutionResult,
 	// 2. Execute CREATE statements
 	for _, stmt := range createStmts {
 		if err := e.executeCreate(stmt); err != nil {
-			result.Errors = append(result.Errors, fmt.Errorf("CREATE failed: %w", err))
+			result.Errors = append(result.Errors, &StatementError{Statement: stmt, Err: fmt.Errorf("CREATE failed: %w", err)})
 		} else {
 			result.ExecutedCount++
 		}
@@ -114,7 +136,7 @@ func (e *SQLExecutor) ExecuteStatements(statements []string) (*ExecutionResult,
 		if insertResult.Error == nil {
 			result.ExecutedCount++
 		} else {
-			result.Errors = append(result.Errors, fmt.Errorf("INSERT failed: %w", insertResult.Error))
+			result.Errors = append(result.Errors, &StatementError{Statement: stmt, Err: fmt.Errorf("INSERT failed: %w", insertResult.Error)})
 		}
 	}
 
@@ -125,14 +147,14 @@ func (e *SQLExecutor) ExecuteStatements(statements []string) (*ExecutionResult,
 		if queryResult.Error == nil {
 			result.ExecutedCount++
 		} else {
-			result.Errors = append(result.Errors, fmt.Errorf("SELECT failed: %w", queryResult.Error))
+			result.Errors = append(result.Errors, &StatementError{Statement: stmt, Err: fmt.Errorf("SELECT failed: %w", queryResult.Error)})
 		}
 	}
 
 	// 5. Execute other statement types (UPDATE, DELETE, ALTER, etc.)
 	for _, stmt := range otherStmts {
 		if err := e.executeOther(stmt); err != nil {
-			result.Errors = append(result.Errors, fmt.Errorf("statement failed: %w", err))
+			result.Errors = append(result.Errors, &StatementError{Statement: stmt, Err: fmt.Errorf("statement failed: %w", err)})
 		} else {
 			result.ExecutedCount++
 		}
@@ -235,13 +257,14 @@ func (e *SQLExecutor) executeInsert(stmt string) InsertResult {
 	// Get table name for ID tracking
 	tableName := e.getTableFromInsert(populatedStmt)
 
-	// Check if this is a THEN RETURN statement
-	if strings.Contains(strings.ToUpper(populatedStmt), "THEN RETURN") {
+	// Check if this is a THEN RETURN (or, in the PostgreSQL dialect, RETURNING) statement
+	upperStmt := strings.ToUpper(populatedStmt)
+	if strings.Contains(upperStmt, "THEN RETURN") || (e.postgres && strings.Contains(upperStmt, " RETURNING ")) {
 		// Execute and capture the returned ID
 		var returnedID string
 		err = e.DB.QueryRow(populatedStmt).Scan(&returnedID)
 		if err != nil {
-			result.Error = fmt.Errorf("executing INSERT with THEN RETURN: %w", err)
+			result.Error = fmt.Errorf("executing INSERT with returned ID: %w", err)
 			return result
 		}
 
@@ -356,11 +379,30 @@ func (e *SQLExecutor) extractTableName(stmt string) string {
 	return ""
 }
 
+// postgresColumnTypes maps PostgreSQL dialect types to the GoogleSQL types the sample values are
+// generated for
+var postgresColumnTypes = map[string]string{
+	"VARCHAR": "STRING", "CHARACTER VARYING": "STRING", "TEXT": "STRING",
+	"BIGINT": "INT64", "INT8": "INT64", "INTEGER": "INT64", "INT": "INT64",
+	"DOUBLE PRECISION": "FLOAT64", "FLOAT8": "FLOAT64", "NUMERIC": "FLOAT64", "DECIMAL": "FLOAT64",
+	"TIMESTAMPTZ": "TIMESTAMP", "TIMESTAMP WITH TIME ZONE": "TIMESTAMP", "DATE": "DATE",
+	"BOOLEAN": "BOOL", "BOOL": "BOOL",
+}
+
 func (e *SQLExecutor) extractTableSchema(stmt, tableName string) {
 	if e.tableSchemas[tableName] == nil {
 		e.tableSchemas[tableName] = make(map[string]string)
 	}
 
+	if e.postgres {
+		colRe := regexp.MustCompile(`(?i)(\w+)\s+(CHARACTER\s+VARYING|VARCHAR|TEXT|BIGINT|INT8|INTEGER|INT|DOUBLE\s+PRECISION|FLOAT8|NUMERIC|DECIMAL|TIMESTAMPTZ|TIMESTAMP\s+WITH\s+TIME\s+ZONE|DATE|BOOLEAN|BOOL)\b`)
+		for _, match := range colRe.FindAllStringSubmatch(stmt, -1) {
+			columnType := strings.Join(strings.Fields(strings.ToUpper(match[2])), " ")
+			e.tableSchemas[tableName][strings.ToLower(match[1])] = postgresColumnTypes[columnType]
+		}
+		return
+	}
+
 	// Extract column definitions
 	// Look for patterns like: column_name TYPE
 	colRe := regexp.MustCompile(`(\w+)\s+(STRING\(\d+\)|INT64|FLOAT64|TIMESTAMP|DATE|BOOL)\s*(?:NOT\s+NULL|DEFAULT|,|\))`)
@@ -389,6 +431,10 @@ func (e *SQLExecutor) populateInsertParameters(stmt string) (string, error) {
 	// Get table name to understand column types
 	tableName := e.getTableFromInsert(stmt)
 
+	if e.postgres {
+		return e.populatePositionalParameters(stmt, tableName), nil
+	}
+
 	// Replace named parameters (@param) with sample data
 	namedParamRe := regexp.MustCompile(`@(\w+)`)
 	paramMap := make(map[string]string)
@@ -417,6 +463,27 @@ func (e *SQLExecutor) populateInsertParameters(stmt string) (string, error) {
 	return populated, nil
 }
 
+// populatePositionalParameters replaces each $n with sample data for the n-th column of the
+// INSERT column list, since the PostgreSQL dialect has no named parameters to go by
+func (e *SQLExecutor) populatePositionalParameters(stmt, tableName string) string {
+	var columns []string
+	columnsRe := regexp.MustCompile(`(?i)INSERT\s+INTO\s+\w+\s*\(([^)]*)\)`)
+	if matches := columnsRe.FindStringSubmatch(stmt); len(matches) > 1 {
+		for _, column := range strings.Split(matches[1], ",") {
+			columns = append(columns, strings.Trim(strings.TrimSpace(column), `"`))
+		}
+	}
+
+	positionalParamRe := regexp.MustCompile(`\$(\d+)`)
+	return positionalParamRe.ReplaceAllStringFunc(stmt, func(match string) string {
+		index, _ := strconv.Atoi(match[1:])
+		if index >= 1 && index <= len(columns) {
+			return e.getSampleValueForParameter(columns[index-1], tableName)
+		}
+		return e.getSampleValueForIndex(index, tableName)
+	})
+}
+
 // getSampleValueForParameter returns sample data based on parameter name and table schema
 func (e *SQLExecutor) getSampleValueForParameter(paramName, tableName string) string {
 	lower := strings.ToLower(paramName)
@@ -0,0 +1,54 @@
+package postgres_test
+
+import (
+	"testing"
+
+	"sql-parser/repo"
+	"sql-parser/tools"
+
+	"github.com/stretchr/testify/require"
+)
+
+const pgDialectScript = `
+CREATE TABLE departments (
+  dept_id varchar(36) DEFAULT spanner.generate_uuid() PRIMARY KEY,
+  dept_name varchar(100) NOT NULL,
+  location text
+);
+INSERT INTO departments (dept_name, location) VALUES ($1, $2) RETURNING dept_id;
+SELECT dept_id, dept_name FROM departments;
+`
+
+// TestPostgreSQLDialectEvaluation parses a PostgreSQL dialect script and runs it on a PG-dialect
+// database created through the PGAdapter emulator pool
+func TestPostgreSQLDialectEvaluation(t *testing.T) {
+	statements := tools.ExtractPostgresStatements(pgDialectScript)
+	for _, pr := range tools.ParseStatementsPostgres(statements) {
+		require.True(t, pr.Parsed, "parse %q: %v", pr.Statement, pr.Error)
+	}
+
+	pool := tools.NewPGEmulatorPool(1)
+	defer pool.Close()
+
+	db, release, err := pool.AcquireDB()
+	require.NoError(t, err)
+	defer release()
+
+	result, err := repo.NewPostgreSQLExecutor(db, nil).ExecuteStatements(statements)
+	require.NoError(t, err)
+	require.Empty(t, result.Errors)
+	require.Len(t, result.QueryResults, 1)
+	require.Equal(t, 1, result.QueryResults[0].RowCount)
+}
+
+// TestPostgreSQLDialectBool accepts bool, which PostgreSQL spells like GoogleSQL
+func TestPostgreSQLDialectBool(t *testing.T) {
+	statements := tools.ExtractPostgresStatements(`CREATE TABLE flags (id bigint PRIMARY KEY, active bool NOT NULL);
+SELECT id FROM flags WHERE active;`)
+	for _, pr := range tools.ParseStatementsPostgres(statements) {
+		require.True(t, pr.Parsed, "parse %q: %v", pr.Statement, pr.Error)
+	}
+
+	rejected := tools.ParseStatementsPostgres([]string{"CREATE TABLE flags (id INT64 PRIMARY KEY)"})
+	require.False(t, rejected[0].Parsed)
+}
@@ -0,0 +1,88 @@
+package spanner_test
+
+import (
+	"testing"
+
+	"sql-parser/models"
+	"sql-parser/tools"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const fidelitySource = `
+CREATE TABLE authors (
+    author_id SERIAL PRIMARY KEY,
+    author_name VARCHAR(100) NOT NULL
+);
+CREATE TABLE books (
+    book_id SERIAL PRIMARY KEY,
+    isbn VARCHAR(20),
+    copies INTEGER CHECK (copies >= 0),
+    author_id INTEGER REFERENCES authors
+);
+CREATE UNIQUE INDEX idx_book_isbn ON books(isbn);
+DROP TABLE books;
+`
+
+// TestSchemaFidelity maps the source schema to a translation that renamed the columns, kept some
+// constraints and lost others
+func TestSchemaFidelity(t *testing.T) {
+	translation := `
+CREATE TABLE Authors (
+  AuthorId STRING(36) NOT NULL DEFAULT (GENERATE_UUID()),
+  AuthorName STRING(100)
+) PRIMARY KEY (AuthorId);
+CREATE TABLE Books (
+  BookId INT64 NOT NULL,
+  Isbn STRING(20),
+  Copies INT64,
+  AuthorId STRING(36),
+  CONSTRAINT CK_Copies CHECK (Copies >= 0),
+  FOREIGN KEY (AuthorId) REFERENCES Authors (AuthorId)
+) PRIMARY KEY (BookId);
+CREATE INDEX BooksByIsbn ON Books(Isbn);
+DROP TABLE Books;
+`
+
+	fidelity := tools.CompareSchemaFidelity(fidelitySource, translation)
+
+	assert.Equal(t, 14, fidelity.Total)
+	assert.Equal(t, 11, fidelity.Preserved)
+	assert.Equal(t, 1, fidelity.Altered)
+	assert.Equal(t, 2, fidelity.Dropped)
+	assert.InDelta(t, 11.5/14, fidelity.Score, 1e-9)
+	assert.ElementsMatch(t, []models.SchemaChange{
+		{Kind: "not null", Object: "authors.author_name", Status: tools.SchemaChangeDropped, Detail: "the column is nullable"},
+		{Kind: "key generation", Object: "books.book_id", Status: tools.SchemaChangeDropped, Detail: "the column has no GENERATE_UUID() default, sequence or identity"},
+		{Kind: "unique", Object: "books(isbn)", Status: tools.SchemaChangeAltered, Detail: "the index on these columns is not UNIQUE"},
+	}, fidelity.Changes)
+}
+
+// TestSchemaFidelityToGold scores a translation against a reference translation
+func TestSchemaFidelityToGold(t *testing.T) {
+	gold := `
+CREATE TABLE Authors (
+  AuthorId STRING(36) NOT NULL DEFAULT (GENERATE_UUID()),
+  Name STRING(100) NOT NULL
+) PRIMARY KEY (AuthorId);
+CREATE UNIQUE INDEX AuthorsByName ON Authors(Name);
+`
+	translation := `
+CREATE TABLE authors (
+  author_id STRING(36) NOT NULL DEFAULT (GENERATE_UUID()),
+  name STRING(100)
+) PRIMARY KEY (author_id);
+CREATE INDEX authors_by_name ON authors(name);
+`
+
+	fidelity := tools.CompareSchemaToGold(gold, translation)
+
+	assert.Equal(t, 7, fidelity.Total)
+	assert.Equal(t, 5, fidelity.Preserved)
+	assert.Equal(t, 1, fidelity.Altered)
+	assert.Equal(t, 1, fidelity.Dropped)
+	assert.ElementsMatch(t, []models.SchemaChange{
+		{Kind: "not null", Object: "Authors.Name", Status: tools.SchemaChangeDropped, Detail: "the column is nullable"},
+		{Kind: "unique", Object: "Authors(Name)", Status: tools.SchemaChangeAltered, Detail: "the index on these columns is not UNIQUE"},
+	}, fidelity.Changes)
+}
@@ -0,0 +1,48 @@
+package spanner_test
+
+import (
+	"testing"
+
+	"sql-parser/tools"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSemanticAnalysis checks a schema against the statements that use it without an emulator
+func TestSemanticAnalysis(t *testing.T) {
+	statements := []string{
+		`CREATE TABLE Singers (SingerId INT64 NOT NULL, Name STRING(100) NOT NULL) PRIMARY KEY (SingerId)`,
+		`CREATE TABLE Albums (SingerId INT64 NOT NULL, AlbumId STRING(36) NOT NULL, Title STRING(MAX)) PRIMARY KEY (SingerId, AlbumId), INTERLEAVE IN PARENT Singers ON DELETE CASCADE`,
+		`CREATE TABLE Songs (SongId INT64 NOT NULL, AlbumId INT64, CONSTRAINT FK_Album FOREIGN KEY (AlbumId) REFERENCES Albums (AlbumId)) PRIMARY KEY (SongId)`,
+		`INSERT INTO Singers (SingerId, Name) VALUES (1, 'Marc')`,
+		`INSERT INTO Singers (SingerId, Name) VALUES ('2', 'Catalina')`,
+		`INSERT INTO Singers (SingerId) VALUES (3)`,
+		`SELECT s.Name, a.Title FROM Singers s JOIN Albums a ON a.SingerId = s.SingerId`,
+		`SELECT Genre FROM Singers`,
+	}
+
+	results := tools.AnalyzeSemantics(statements)
+	require.Len(t, results, len(statements))
+
+	expected := []string{
+		"",
+		"",
+		"Semantic: Foreign Key Mismatch",
+		"",
+		"Semantic: Type Mismatch",
+		"Semantic: Missing Required Column",
+		"",
+		"Semantic: Unknown Column",
+	}
+	for i, category := range expected {
+		if category == "" {
+			assert.Nil(t, results[i], statements[i])
+			continue
+		}
+		if assert.NotNil(t, results[i], statements[i]) {
+			assert.Equal(t, category, results[i].Category, results[i].Message)
+			assert.Equal(t, statements[i], results[i].Statement)
+		}
+	}
+}
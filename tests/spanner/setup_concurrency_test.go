@@ -0,0 +1,81 @@
+package spanner_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"sql-parser/tools"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConcurrentEmulatorSetups starts several emulators at once and checks that every connection
+// reaches its own container, without the setup touching SPANNER_EMULATOR_HOST
+func TestConcurrentEmulatorSetups(t *testing.T) {
+	const setups = 3
+	emulatorHost, hadEmulatorHost := os.LookupEnv("SPANNER_EMULATOR_HOST")
+
+	var wg sync.WaitGroup
+	errs := make([]error, setups)
+	for i := 0; i < setups; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = checkOwnEmulator(fmt.Sprintf("setup-%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		assert.NoError(t, err, "setup %d", i)
+	}
+
+	currentHost, hasEmulatorHost := os.LookupEnv("SPANNER_EMULATOR_HOST")
+	require.Equal(t, hadEmulatorHost, hasEmulatorHost, "SPANNER_EMULATOR_HOST was changed by the setup")
+	require.Equal(t, emulatorHost, currentHost, "SPANNER_EMULATOR_HOST was changed by the setup")
+}
+
+// checkOwnEmulator writes a marker row through a fresh emulator and reads back only that row
+func checkOwnEmulator(uniqueID string) error {
+	db, terminate, err := tools.GetDBWithIdentifier(true, uniqueID)
+	if err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+	defer func() {
+		db.Close()
+		terminate()
+	}()
+
+	if _, err := db.Exec("CREATE TABLE Marker (Id STRING(64) NOT NULL) PRIMARY KEY (Id)"); err != nil {
+		return fmt.Errorf("create table: %w", err)
+	}
+	if _, err := db.Exec("INSERT INTO Marker (Id) VALUES (@id)", sql.Named("id", uniqueID)); err != nil {
+		return fmt.Errorf("insert marker: %w", err)
+	}
+
+	rows, err := db.Query("SELECT Id FROM Marker")
+	if err != nil {
+		return fmt.Errorf("read markers: %w", err)
+	}
+	defer rows.Close()
+
+	var markers []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		markers = append(markers, id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(markers) != 1 || markers[0] != uniqueID {
+		return fmt.Errorf("expected only marker %s, found %v", uniqueID, markers)
+	}
+	return nil
+}
@@ -16,6 +16,10 @@ var (
 
 type config struct {
 	OpenAIAPIKey string `env:"OPENAI_API_KEY"`
+	// SpannerEmulatorHost is an already running emulator to use instead of starting containers
+	SpannerEmulatorHost string `env:"SPANNER_EMULATOR_HOST"`
+	// PGAdapterHost is an already running PGAdapter in front of SpannerEmulatorHost
+	PGAdapterHost string `env:"PGADAPTER_HOST"`
 }
 
 func Get() config {
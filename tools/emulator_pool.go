@@ -0,0 +1,335 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	"cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// errEmulatorDown is returned for an emulator already found down, until it is restarted
+var errEmulatorDown = errors.New("emulator did not answer")
+
+// DefaultEmulatorPoolSize is the number of emulator containers of the default pool
+const DefaultEmulatorPoolSize = 1
+
+const (
+	// emulatorHealthTimeout bounds the health check done before handing out a database
+	emulatorHealthTimeout = 5 * time.Second
+	// emulatorDownTimeout is how long a failing emulator is probed before it counts as down
+	emulatorDownTimeout = 30 * time.Second
+)
+
+// EmulatorPool shares a few Spanner emulator containers between evaluations. Every evaluation
+// gets its own database, dropped when it is released, so evaluations never see each other's
+// schema. Containers are started on first use and restarted once they are confirmed down and no
+// database on them is in use anymore. When an
+// emulator host is configured (see EmulatorHost) the pool attaches to it instead. A PostgreSQL
+// dialect pool (see NewPGEmulatorPool) runs PGAdapter in front of each emulator and connects
+// through it.
+type EmulatorPool struct {
+	emulators []*pooledEmulator
+	dialect   databasepb.DatabaseDialect
+	next      atomic.Uint64
+	databases atomic.Uint64
+	// prefix keeps database names apart when several processes share an attached emulator
+	prefix string
+}
+
+// pooledEmulator is one emulator of a pool, a container it owns or an attached endpoint when
+// container is nil; mu serialises starting and restarting it. pgEndpoint is the PGAdapter of a
+// PostgreSQL dialect emulator. leases counts the databases handed out and not released yet, the
+// container is never restarted while it has any.
+type pooledEmulator struct {
+	mu         sync.Mutex
+	postgres   bool
+	container  testcontainers.Container
+	endpoint   string
+	pgEndpoint string
+	admin      *database.DatabaseAdminClient
+	instances  *instance.InstanceAdminClient
+	leases     int
+	// down is set once the emulator did not answer for emulatorDownTimeout
+	down bool
+}
+
+var (
+	defaultPoolOnce sync.Once
+	defaultPool     *EmulatorPool
+	defaultPoolSize = DefaultEmulatorPoolSize
+
+	defaultPGPoolOnce sync.Once
+	defaultPGPool     *EmulatorPool
+)
+
+// NewEmulatorPool creates a pool of size emulator containers for GoogleSQL databases
+func NewEmulatorPool(size int) *EmulatorPool {
+	return newEmulatorPool(size, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+}
+
+// NewPGEmulatorPool creates a pool of size PGAdapter emulator containers for PostgreSQL dialect
+// databases, whose connections use the pgx driver
+func NewPGEmulatorPool(size int) *EmulatorPool {
+	return newEmulatorPool(size, databasepb.DatabaseDialect_POSTGRESQL)
+}
+
+func newEmulatorPool(size int, dialect databasepb.DatabaseDialect) *EmulatorPool {
+	if size <= 0 {
+		size = DefaultEmulatorPoolSize
+	}
+	pool := &EmulatorPool{
+		emulators: make([]*pooledEmulator, size),
+		dialect:   dialect,
+		prefix:    fmt.Sprintf("eval-%06x", rand.IntN(1<<24)),
+	}
+	for i := range pool.emulators {
+		pool.emulators[i] = &pooledEmulator{postgres: dialect == databasepb.DatabaseDialect_POSTGRESQL}
+	}
+	return pool
+}
+
+// SetDefaultEmulatorPoolSize sets the size of the default pool; it has no effect once the pool is in use
+func SetDefaultEmulatorPoolSize(size int) {
+	if size > 0 {
+		defaultPoolSize = size
+	}
+}
+
+// DefaultEmulatorPool returns the pool shared by the whole process
+func DefaultEmulatorPool() *EmulatorPool {
+	defaultPoolOnce.Do(func() {
+		defaultPool = NewEmulatorPool(defaultPoolSize)
+	})
+	return defaultPool
+}
+
+// DefaultPGEmulatorPool returns the PostgreSQL dialect pool shared by the whole process; it has
+// the size of the default pool
+func DefaultPGEmulatorPool() *EmulatorPool {
+	defaultPGPoolOnce.Do(func() {
+		defaultPGPool = NewPGEmulatorPool(defaultPoolSize)
+	})
+	return defaultPGPool
+}
+
+// AcquireDB creates a new database on one of the emulators and returns a connection to it. The
+// release function closes the connection and drops the database.
+func (p *EmulatorPool) AcquireDB() (*sql.DB, func(), error) {
+	ctx := context.Background()
+	emulator := p.emulators[p.next.Add(1)%uint64(len(p.emulators))]
+	dbName := fmt.Sprintf("%s-%d", p.prefix, p.databases.Add(1))
+
+	endpoint, admin, err := emulator.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := createDatabase(ctx, admin, dbName, p.dialect); err != nil {
+		emulator.release()
+		// The emulator may have died between the health check and the request. Only then it is
+		// restarted and the database created again, other failures are returned as they are.
+		if !emulator.confirmDown(ctx, endpoint) {
+			return nil, nil, &SetupError{Stage: SetupStageDatabase, Endpoint: endpoint, Err: err}
+		}
+		if endpoint, admin, err = emulator.acquire(ctx); err != nil {
+			return nil, nil, err
+		}
+		if err := createDatabase(ctx, admin, dbName, p.dialect); err != nil {
+			emulator.release()
+			return nil, nil, &SetupError{Stage: SetupStageDatabase, Endpoint: endpoint, Err: err}
+		}
+	}
+
+	var db *sql.DB
+	if emulator.postgres {
+		db, err = sql.Open("pgx/v4", pgAdapterDSN(emulator.pgEndpoint, dbName))
+	} else {
+		db, err = sql.Open("spanner", emulatorDSN(endpoint, dbName))
+	}
+	if err != nil {
+		dropPoolDatabase(ctx, admin, dbName)
+		emulator.release()
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			_ = db.Close()
+			dropPoolDatabase(ctx, admin, dbName)
+			emulator.release()
+		})
+	}
+	return db, release, nil
+}
+
+// Close terminates every container of the pool
+func (p *EmulatorPool) Close() {
+	for _, emulator := range p.emulators {
+		emulator.mu.Lock()
+		emulator.stop(context.Background())
+		emulator.mu.Unlock()
+	}
+}
+
+// acquire returns the endpoint and admin client of a healthy emulator and takes a lease on it,
+// starting the container when needed. A container that is down is only restarted once all its
+// leases are released; until then acquire fails.
+func (e *pooledEmulator) acquire(ctx context.Context) (string, *database.DatabaseAdminClient, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.admin != nil {
+		if !e.down && e.healthCheck(ctx) == nil {
+			e.leases++
+			return e.endpoint, e.admin, nil
+		}
+		// A failed or slow health check alone is not enough, the emulator must stay silent
+		err := e.probeDown(ctx)
+		if err == nil {
+			e.leases++
+			return e.endpoint, e.admin, nil
+		}
+		if e.leases > 0 {
+			return "", nil, &SetupError{Stage: SetupStageReady, Endpoint: e.endpoint,
+				Err: fmt.Errorf("emulator is down and %d of its databases are still in use: %w", e.leases, err)}
+		}
+		fmt.Printf("Spanner emulator at %s is down, restarting: %v\n", e.endpoint, err)
+		e.stop(ctx)
+	}
+
+	if err := e.start(ctx); err != nil {
+		return "", nil, err
+	}
+	e.leases++
+	return e.endpoint, e.admin, nil
+}
+
+// release gives back a lease taken by acquire
+func (e *pooledEmulator) release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leases--
+}
+
+// confirmDown reports whether the emulator at endpoint is down, probing it for
+// emulatorDownTimeout. An emulator that was replaced in the meantime counts as down.
+func (e *pooledEmulator) confirmDown(ctx context.Context, endpoint string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.admin == nil || e.endpoint != endpoint {
+		return true
+	}
+	return e.probeDown(ctx) != nil
+}
+
+// probeDown retries the health check until it succeeds or emulatorDownTimeout passes, and marks the
+// emulator down when it never answered. Callers hold mu.
+func (e *pooledEmulator) probeDown(ctx context.Context) error {
+	if e.down {
+		return errEmulatorDown
+	}
+	ctx, cancel := context.WithTimeout(ctx, emulatorDownTimeout)
+	defer cancel()
+	err := retrySetup(ctx, e.healthCheck)
+	if err != nil {
+		e.down = true
+	}
+	return err
+}
+
+// start starts a container, or connects to the configured emulator host
+func (e *pooledEmulator) start(ctx context.Context) error {
+	if e.postgres {
+		if err := e.startPGAdapter(ctx); err != nil {
+			return err
+		}
+	} else if e.endpoint = EmulatorHost(); e.endpoint == "" {
+		container, endpoint, err := startSpannerEmulator(ctx)
+		if err != nil {
+			return &SetupError{Stage: SetupStageStart, Err: err}
+		}
+		e.container = container
+		e.endpoint = endpoint
+	}
+
+	var err error
+	opts := emulatorClientOptions(e.endpoint)
+	if err = setupInstance(ctx, e.endpoint); err != nil {
+		e.stop(ctx)
+		return err
+	}
+	if e.admin, err = database.NewDatabaseAdminClient(ctx, opts...); err != nil {
+		e.stop(ctx)
+		return fmt.Errorf("failed to create database admin client: %w", err)
+	}
+	if e.instances, err = instance.NewInstanceAdminClient(ctx, opts...); err != nil {
+		e.stop(ctx)
+		return fmt.Errorf("failed to create instance admin client: %w", err)
+	}
+	return nil
+}
+
+// startPGAdapter starts a PGAdapter emulator container, or connects to the configured PGAdapter
+// and emulator hosts, which must be set together
+func (e *pooledEmulator) startPGAdapter(ctx context.Context) error {
+	e.endpoint, e.pgEndpoint = EmulatorHost(), PGAdapterHost()
+	if e.endpoint != "" || e.pgEndpoint != "" {
+		if e.endpoint == "" || e.pgEndpoint == "" {
+			return &SetupError{Stage: SetupStageStart, Err: fmt.Errorf("attaching to a PostgreSQL dialect emulator needs both an emulator host and a PGAdapter host")}
+		}
+		return nil
+	}
+
+	container, pgEndpoint, endpoint, err := startPGAdapterEmulator(ctx)
+	if err != nil {
+		return &SetupError{Stage: SetupStageStart, Err: fmt.Errorf("pgadapter emulator: %w", err)}
+	}
+	e.container = container
+	e.endpoint = endpoint
+	e.pgEndpoint = pgEndpoint
+	return nil
+}
+
+func (e *pooledEmulator) stop(ctx context.Context) {
+	e.down = false
+	if e.admin != nil {
+		_ = e.admin.Close()
+		e.admin = nil
+	}
+	if e.instances != nil {
+		_ = e.instances.Close()
+		e.instances = nil
+	}
+	if e.container != nil {
+		_ = e.container.Terminate(ctx)
+		e.container = nil
+	}
+}
+
+// healthCheck asks the emulator for the test instance
+func (e *pooledEmulator) healthCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, emulatorHealthTimeout)
+	defer cancel()
+	_, err := e.instances.GetInstance(ctx, &instancepb.GetInstanceRequest{
+		Name: fmt.Sprintf("projects/%s/instances/%s", testProject, testInstance),
+	})
+	return err
+}
+
+// dropPoolDatabase drops a released database; failures are ignored since a restarted emulator
+// no longer has it anyway
+func dropPoolDatabase(ctx context.Context, admin *database.DatabaseAdminClient, dbName string) {
+	_ = admin.DropDatabase(ctx, &databasepb.DropDatabaseRequest{
+		Database: fmt.Sprintf("projects/%s/instances/%s/databases/%s", testProject, testInstance, dbName),
+	})
+}
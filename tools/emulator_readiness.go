@@ -0,0 +1,143 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	"cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SetupStage names the step of an emulator setup that failed
+type SetupStage string
+
+const (
+	SetupStageStart    SetupStage = "start emulator"
+	SetupStageReady    SetupStage = "wait for emulator"
+	SetupStageInstance SetupStage = "create instance"
+	SetupStageDatabase SetupStage = "create database"
+)
+
+// SetupError is a failed emulator setup step. Callers can tell a container that did not start
+// from an emulator that never answered or a failed instance or database creation.
+type SetupError struct {
+	Stage SetupStage
+	// Endpoint is the emulator the step ran against, empty when it is not known yet
+	Endpoint string
+	Err      error
+}
+
+func (e *SetupError) Error() string {
+	if e.Endpoint == "" {
+		return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+	}
+	return fmt.Sprintf("%s at %s: %v", e.Stage, e.Endpoint, e.Err)
+}
+
+func (e *SetupError) Unwrap() error { return e.Err }
+
+const (
+	// initialSetupBackoff is the first wait between setup attempts; it doubles up to maxSetupBackoff
+	initialSetupBackoff = 50 * time.Millisecond
+	maxSetupBackoff     = 2 * time.Second
+	// setupProbeTimeout bounds a single readiness probe
+	setupProbeTimeout = 2 * time.Second
+)
+
+// errInstanceNotReady is returned while the test instance exists but does not serve yet
+var errInstanceNotReady = errors.New("instance is not ready yet")
+
+// retrySetup calls attempt until it succeeds, fails with an error that is not transient or ctx
+// is done, waiting with exponential backoff in between
+func retrySetup(ctx context.Context, attempt func(ctx context.Context) error) error {
+	backoff := initialSetupBackoff
+	for {
+		err := attempt(ctx)
+		if err == nil || !transientSetupError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxSetupBackoff)
+	}
+}
+
+// transientSetupError reports whether a setup step may succeed when retried, typically because
+// the emulator is still starting
+func transientSetupError(err error) bool {
+	// A probe timing out on its own deadline is transient too, retrySetup stops on ctx itself
+	if errors.Is(err, errInstanceNotReady) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// waitForEmulator probes the instance admin API until the emulator answers. Any answer counts,
+// including NotFound for an instance that is not created yet.
+func waitForEmulator(ctx context.Context, instanceAdmin *instance.InstanceAdminClient) error {
+	return retrySetup(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, setupProbeTimeout)
+		defer cancel()
+		_, err := instanceAdmin.GetInstance(ctx, &instancepb.GetInstanceRequest{
+			Name: fmt.Sprintf("projects/%s/instances/%s", testProject, testInstance),
+		})
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// ensureInstance creates the test instance unless it exists, and returns errInstanceNotReady
+// until it is READY
+func ensureInstance(ctx context.Context, instanceAdmin *instance.InstanceAdminClient) error {
+	instancePath := fmt.Sprintf("projects/%s/instances/%s", testProject, testInstance)
+	existing, err := instanceAdmin.GetInstance(ctx, &instancepb.GetInstanceRequest{Name: instancePath})
+	switch {
+	case err == nil:
+		if existing.State == instancepb.Instance_READY {
+			return nil
+		}
+		return errInstanceNotReady
+	case status.Code(err) != codes.NotFound:
+		return err
+	}
+
+	op, err := instanceAdmin.CreateInstance(ctx, &instancepb.CreateInstanceRequest{
+		Parent:     fmt.Sprintf("projects/%s", testProject),
+		InstanceId: testInstance,
+		Instance: &instancepb.Instance{
+			Config:      fmt.Sprintf("projects/%s/instanceConfigs/%s", testProject, "emulator-config"),
+			DisplayName: testInstance,
+			NodeCount:   1,
+		},
+	})
+	if err != nil {
+		// Another setup sharing the emulator created it first
+		if status.Code(err) == codes.AlreadyExists {
+			return errInstanceNotReady
+		}
+		return fmt.Errorf("could not create instance %s: %w", instancePath, err)
+	}
+
+	created, err := op.Wait(ctx)
+	if err != nil {
+		return fmt.Errorf("waiting for instance creation to finish failed: %w", err)
+	}
+	if created.State != instancepb.Instance_READY {
+		return errInstanceNotReady
+	}
+	return nil
+}
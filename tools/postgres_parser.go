@@ -0,0 +1,220 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sql-parser/models"
+)
+
+// memefish only understands GoogleSQL, so statements for Spanner's PostgreSQL dialect are split
+// and checked by a small lexer instead. It catches what can be decided without a grammar:
+// unterminated literals, unbalanced parentheses, unknown statements and GoogleSQL constructs that
+// are invalid in the PostgreSQL dialect. Everything else is left to the emulator.
+
+var (
+	postgresStatementKeywords = map[string]bool{
+		"CREATE": true, "ALTER": true, "DROP": true, "INSERT": true, "UPDATE": true, "DELETE": true,
+		"SELECT": true, "WITH": true, "VALUES": true, "SET": true, "SHOW": true, "GRANT": true,
+		"REVOKE": true, "BEGIN": true, "START": true, "COMMIT": true, "ROLLBACK": true, "ANALYZE": true,
+		"TRUNCATE": true,
+	}
+
+	// googleSQLOnlySyntax lists GoogleSQL constructs that do not exist in the PostgreSQL dialect
+	googleSQLOnlySyntax = []struct {
+		pattern *regexp.Regexp
+		name    string
+	}{
+		{regexp.MustCompile(`(?i)\b(STRING|BYTES)\s*\(`), "STRING/BYTES types (use varchar/text or bytea)"},
+		{regexp.MustCompile(`(?i)\b(INT64|FLOAT64|FLOAT32)\b`), "INT64/FLOAT64/FLOAT32 types (use bigint, double precision, real)"},
+		{regexp.MustCompile(`(?i)\bARRAY\s*<`), "ARRAY<T> types (use T[])"},
+		{regexp.MustCompile(`(?i)\bTHEN\s+RETURN\b`), "THEN RETURN (use RETURNING)"},
+		{regexp.MustCompile(`(?i)\)\s*PRIMARY\s+KEY\s*\(`), "PRIMARY KEY after the column list (declare it inside the parentheses)"},
+		{regexp.MustCompile(`(?i)(^|[^.\w])GENERATE_UUID\s*\(`), "GENERATE_UUID() (use spanner.generate_uuid())"},
+	}
+)
+
+// ExtractPostgresStatements splits a PostgreSQL dialect script at the semicolons that are outside
+// literals, quoted identifiers, comments and dollar-quoted bodies. An unterminated literal makes
+// the rest of the script one last statement, so the parse step can report it.
+func ExtractPostgresStatements(content string) []string {
+	var statements []string
+	start := 0
+	for i := 0; i < len(content); {
+		if content[i] == ';' {
+			statements = appendStatement(statements, content[start:i])
+			i++
+			start = i
+			continue
+		}
+		next, err := skipPostgresToken(content, i)
+		if err != nil {
+			break
+		}
+		i = next
+	}
+	return appendStatement(statements, content[start:])
+}
+
+// appendStatement appends stmt without its leading comments, unless nothing else is left
+func appendStatement(statements []string, stmt string) []string {
+	stmt = strings.TrimSpace(stmt)
+	for strings.HasPrefix(stmt, "--") || strings.HasPrefix(stmt, "/*") {
+		next, err := skipPostgresToken(stmt, 0)
+		if err != nil {
+			break
+		}
+		stmt = strings.TrimSpace(stmt[next:])
+	}
+	if stmt != "" {
+		statements = append(statements, stmt)
+	}
+	return statements
+}
+
+// ParseStatementsPostgres checks each statement for the PostgreSQL dialect and returns parse
+// results shaped like those of ParseStatementsWithMemefish
+func ParseStatementsPostgres(statements []string) []models.ParseResult {
+	results := make([]models.ParseResult, 0, len(statements))
+	for _, stmt := range statements {
+		pr := models.ParseResult{Statement: stmt}
+		if err := checkPostgresStatement(stmt); err != nil {
+			pr.Error = err
+		} else {
+			pr.Parsed = true
+			pr.Type = GetStatementType(nil, stmt)
+		}
+		results = append(results, pr)
+	}
+	return results
+}
+
+func checkPostgresStatement(stmt string) error {
+	masked, err := maskPostgresLiterals(stmt)
+	if err != nil {
+		return err
+	}
+
+	depth := 0
+	for i, c := range masked {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("syntax error at position %d: unbalanced parentheses, unexpected )", i+1)
+			}
+		case '`':
+			return fmt.Errorf("syntax error at position %d: GoogleSQL syntax is not valid in the PostgreSQL dialect: backtick quoted identifiers (use double quotes)", i+1)
+		}
+	}
+	if depth > 0 {
+		return fmt.Errorf("syntax error at end of statement: unbalanced parentheses, missing )")
+	}
+
+	words := strings.Fields(masked)
+	if len(words) == 0 {
+		return fmt.Errorf("syntax error: empty statement")
+	}
+	keyword := strings.ToUpper(strings.TrimLeft(words[0], "("))
+	if !postgresStatementKeywords[keyword] {
+		return fmt.Errorf("syntax error at or near \"%s\": unknown statement", words[0])
+	}
+
+	for _, syntax := range googleSQLOnlySyntax {
+		if loc := syntax.pattern.FindStringIndex(masked); loc != nil {
+			return fmt.Errorf("syntax error at position %d: GoogleSQL syntax is not valid in the PostgreSQL dialect: %s", loc[0]+1, syntax.name)
+		}
+	}
+	return nil
+}
+
+// maskPostgresLiterals replaces literals, quoted identifiers and comments with spaces, so the
+// remaining text only holds keywords, identifiers and punctuation
+func maskPostgresLiterals(stmt string) (string, error) {
+	masked := []byte(stmt)
+	for i := 0; i < len(stmt); {
+		next, err := skipPostgresToken(stmt, i)
+		if err != nil {
+			return "", err
+		}
+		if next > i+1 {
+			for j := i; j < next; j++ {
+				masked[j] = ' '
+			}
+		}
+		i = next
+	}
+	return string(masked), nil
+}
+
+var dollarQuoteTag = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// skipPostgresToken returns the index after the literal, quoted identifier or comment starting at
+// i, or i+1 when none starts there
+func skipPostgresToken(s string, i int) (int, error) {
+	rest := s[i:]
+	switch {
+	case rest[0] == '\'':
+		return skipQuoted(s, i, '\'', "quoted string")
+	case rest[0] == '"':
+		return skipQuoted(s, i, '"', "quoted identifier")
+	case strings.HasPrefix(rest, "--"):
+		if end := strings.IndexByte(rest, '\n'); end >= 0 {
+			return i + end + 1, nil
+		}
+		return len(s), nil
+	case strings.HasPrefix(rest, "/*"):
+		if end := strings.Index(rest[2:], "*/"); end >= 0 {
+			return i + 2 + end + 2, nil
+		}
+		return 0, fmt.Errorf("syntax error at position %d: unterminated /* comment", i+1)
+	case rest[0] == '$':
+		tag := dollarQuoteTag.FindString(rest)
+		if tag == "" {
+			return i + 1, nil // A $n parameter
+		}
+		if end := strings.Index(rest[len(tag):], tag); end >= 0 {
+			return i + len(tag) + end + len(tag), nil
+		}
+		return 0, fmt.Errorf("syntax error at position %d: unterminated dollar-quoted string", i+1)
+	}
+	return i + 1, nil
+}
+
+// skipQuoted skips a literal delimited by quote, where a doubled quote is an escaped one
+func skipQuoted(s string, i int, quote byte, kind string) (int, error) {
+	for j := i + 1; j < len(s); j++ {
+		if s[j] != quote {
+			continue
+		}
+		if j+1 < len(s) && s[j+1] == quote {
+			j++
+			continue
+		}
+		return j + 1, nil
+	}
+	return 0, fmt.Errorf("syntax error at position %d: unterminated %s", i+1, kind)
+}
+
+// CategorizePostgresParseError categorizes errors of ParseStatementsPostgres like
+// CategorizeMemefishError does for memefish errors
+func CategorizePostgresParseError(errMsg string) string {
+	lower := strings.ToLower(errMsg)
+	switch {
+	case strings.Contains(lower, "googlesql syntax is not valid"):
+		return "Dialect Mismatch: GoogleSQL Syntax"
+	case strings.Contains(lower, "unterminated"):
+		return "Syntax Error: Unterminated Literal"
+	case strings.Contains(lower, "missing )"):
+		return "Syntax Error: Missing Token"
+	case strings.Contains(lower, "unexpected )"):
+		return "Syntax Error: Unexpected Token"
+	case strings.Contains(lower, "unknown statement"):
+		return "Invalid Syntax"
+	default:
+		return "Parse Error: Other"
+	}
+}
@@ -0,0 +1,803 @@
+package tools
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"sql-parser/models"
+
+	"github.com/cloudspannerecosystem/memefish"
+	"github.com/cloudspannerecosystem/memefish/ast"
+)
+
+// Schema fidelity compares the schema a translation creates with the schema of its PostgreSQL
+// source. Both sides are reduced to the same model of tables, columns, NOT NULL, unique keys, CHECK
+// constraints, foreign keys and generated keys, and then matched by name. Names match
+// case-insensitively and without underscores, so author_id maps to AuthorId, and a table also
+// matches its singular or plural. Data types are not compared, the prompt allows changing them.
+
+// Statuses of a models.SchemaChange
+const (
+	SchemaChangeDropped = "dropped"
+	SchemaChangeAltered = "altered"
+)
+
+type schemaModel struct {
+	tables []*schemaTable
+}
+
+type schemaTable struct {
+	name        string
+	columns     []*schemaColumn
+	primaryKey  []string
+	uniques     [][]string
+	indexes     [][]string // indexes that are not unique
+	checks      []schemaCheck
+	foreignKeys []schemaForeignKey
+	parent      string // INTERLEAVE IN PARENT table
+}
+
+type schemaColumn struct {
+	name    string
+	notNull bool
+	keyGen  bool // SERIAL, identity, sequence or UUID default
+}
+
+type schemaCheck struct {
+	name string
+	// identifiers in the expression; those that are columns of the table are the checked columns
+	identifiers []string
+}
+
+type schemaForeignKey struct {
+	columns    []string
+	refTable   string
+	refColumns []string // empty for the primary key of refTable
+}
+
+// schemaKey normalizes a name for matching across dialects
+func schemaKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "_", "")
+}
+
+// keySet returns the normalized names, sorted
+func keySet(names []string) []string {
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = schemaKey(name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sameKeys(a, b []string) bool {
+	return slices.Equal(keySet(a), keySet(b))
+}
+
+// table returns the table matching name, falling back to its singular or plural
+func (m *schemaModel) table(name string) *schemaTable {
+	if t := m.exactTable(name); t != nil {
+		return t
+	}
+	singular := strings.TrimSuffix(schemaKey(name), "s")
+	for _, t := range m.tables {
+		if strings.TrimSuffix(schemaKey(t.name), "s") == singular {
+			return t
+		}
+	}
+	return nil
+}
+
+func (m *schemaModel) exactTable(name string) *schemaTable {
+	for _, t := range m.tables {
+		if schemaKey(t.name) == schemaKey(name) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (m *schemaModel) addTable(name string) *schemaTable {
+	if t := m.exactTable(name); t != nil {
+		return t
+	}
+	t := &schemaTable{name: name}
+	m.tables = append(m.tables, t)
+	return t
+}
+
+func (t *schemaTable) column(name string) *schemaColumn {
+	for _, col := range t.columns {
+		if schemaKey(col.name) == schemaKey(name) {
+			return col
+		}
+	}
+	return nil
+}
+
+func (t *schemaTable) addColumn(name string) *schemaColumn {
+	if col := t.column(name); col != nil {
+		return col
+	}
+	col := &schemaColumn{name: name}
+	t.columns = append(t.columns, col)
+	return col
+}
+
+func (t *schemaTable) addUnique(columns []string) {
+	if len(columns) == 0 {
+		return
+	}
+	for _, unique := range t.uniques {
+		if sameKeys(unique, columns) {
+			return
+		}
+	}
+	t.uniques = append(t.uniques, columns)
+}
+
+// columnSet returns the columns of t among names, in key order and without duplicates
+func (t *schemaTable) columnSet(names []string) []string {
+	var columns []string
+	for _, name := range names {
+		if col := t.column(name); col != nil && !slices.Contains(columns, col.name) {
+			columns = append(columns, col.name)
+		}
+	}
+	sort.Slice(columns, func(i, j int) bool { return schemaKey(columns[i]) < schemaKey(columns[j]) })
+	return columns
+}
+
+// hasUnique reports whether the columns are unique in t, through a unique index or the primary key
+func (t *schemaTable) hasUnique(columns []string) bool {
+	if len(t.primaryKey) > 0 && sameKeys(t.primaryKey, columns) {
+		return true
+	}
+	return slices.ContainsFunc(t.uniques, func(unique []string) bool { return sameKeys(unique, columns) })
+}
+
+func (t *schemaTable) hasCheck(columns []string) bool {
+	return slices.ContainsFunc(t.checks, func(check schemaCheck) bool {
+		return sameKeys(t.columnSet(check.identifiers), columns)
+	})
+}
+
+func (t *schemaTable) foreignKeyOn(columns []string) *schemaForeignKey {
+	for i, fk := range t.foreignKeys {
+		if sameKeys(fk.columns, columns) {
+			return &t.foreignKeys[i]
+		}
+	}
+	return nil
+}
+
+// CompareSchemaFidelity maps the schema objects created by postgresSQL to those created by
+// spannerSQL and scores how many of them the translation kept. Statements that do not parse are
+// ignored, so a table whose CREATE TABLE does not parse counts as dropped. DROP statements are
+// ignored too, the scripts usually end by removing what they created.
+func CompareSchemaFidelity(postgresSQL, spannerSQL string) *models.SchemaFidelity {
+	return compareSchemas(postgresSchema(postgresSQL), spannerSchema(spannerSQL))
+}
+
+// CompareSchemaToGold scores a translation against a reference GoogleSQL translation the same
+// way CompareSchemaFidelity scores it against the PostgreSQL source
+func CompareSchemaToGold(goldSQL, spannerSQL string) *models.SchemaFidelity {
+	return compareSchemas(spannerSchema(goldSQL), spannerSchema(spannerSQL))
+}
+
+// promptSQLKeywords are the words that mark the first paragraph of a prompt as SQL
+var promptSQLKeywords = map[string]bool{
+	"CREATE": true, "ALTER": true, "DROP": true, "INSERT": true, "UPDATE": true,
+	"DELETE": true, "SELECT": true, "WITH": true, "GRANT": true, "REVOKE": true,
+	"SET": true, "RENAME": true, "ANALYZE": true, "CALL": true,
+}
+
+// SplitPrompt separates the instructions at the top of prompt.txt from the PostgreSQL source.
+// The instructions are the first paragraph, unless it already starts with SQL.
+func SplitPrompt(prompt string) (instructions, sourceSQL string) {
+	trimmed := strings.TrimSpace(prompt)
+	paragraph, rest, found := strings.Cut(trimmed, "\n\n")
+	if !found {
+		return "", trimmed
+	}
+	if strings.HasPrefix(paragraph, "(") || promptSQLKeywords[strings.ToUpper(strings.TrimRight(strings.Fields(paragraph)[0], ";"))] {
+		return "", trimmed
+	}
+	return strings.TrimSpace(paragraph), strings.TrimSpace(rest)
+}
+
+func compareSchemas(source, target *schemaModel) *models.SchemaFidelity {
+	c := fidelityComparison{source: source, target: target, result: &models.SchemaFidelity{}}
+	for _, t := range source.tables {
+		c.compareTable(t)
+	}
+
+	result := c.result
+	result.Score = 1
+	if result.Total > 0 {
+		result.Score = (float64(result.Preserved) + float64(result.Altered)/2) / float64(result.Total)
+	}
+	return result
+}
+
+type fidelityComparison struct {
+	source, target *schemaModel
+	result         *models.SchemaFidelity
+}
+
+func (c *fidelityComparison) keep() {
+	c.result.Total++
+	c.result.Preserved++
+}
+
+// drop records a dropped object; objects counts the objects that went with it, which are not listed
+func (c *fidelityComparison) drop(kind, object, detail string, objects int) {
+	c.result.Total += objects
+	c.result.Dropped += objects
+	c.result.Changes = append(c.result.Changes, models.SchemaChange{Kind: kind, Object: object, Status: SchemaChangeDropped, Detail: detail})
+}
+
+func (c *fidelityComparison) alter(kind, object, detail string) {
+	c.result.Total++
+	c.result.Altered++
+	c.result.Changes = append(c.result.Changes, models.SchemaChange{Kind: kind, Object: object, Status: SchemaChangeAltered, Detail: detail})
+}
+
+func (c *fidelityComparison) compareTable(st *schemaTable) {
+	tt := c.target.table(st.name)
+	if tt == nil {
+		objects := 1 + len(st.uniques) + len(st.checks) + len(st.foreignKeys)
+		for _, col := range st.columns {
+			objects += columnObjects(col)
+		}
+		detail := ""
+		if objects > 1 {
+			detail = fmt.Sprintf("with its %d columns and constraints", objects-1)
+		}
+		c.drop("table", st.name, detail, objects)
+		return
+	}
+	c.keep()
+
+	for _, col := range st.columns {
+		object := st.name + "." + col.name
+		tc := tt.column(col.name)
+		if tc == nil {
+			c.drop("column", object, "", columnObjects(col))
+			continue
+		}
+		c.keep()
+		if col.notNull {
+			if tc.notNull {
+				c.keep()
+			} else {
+				c.drop("not null", object, "the column is nullable", 1)
+			}
+		}
+		if col.keyGen {
+			if tc.keyGen {
+				c.keep()
+			} else {
+				c.drop("key generation", object, "the column has no GENERATE_UUID() default, sequence or identity", 1)
+			}
+		}
+	}
+
+	for _, unique := range st.uniques {
+		object := fmt.Sprintf("%s(%s)", st.name, strings.Join(unique, ", "))
+		switch {
+		case tt.hasUnique(unique):
+			c.keep()
+		case slices.ContainsFunc(tt.indexes, func(index []string) bool { return sameKeys(index, unique) }):
+			c.alter("unique", object, "the index on these columns is not UNIQUE")
+		default:
+			c.drop("unique", object, "", 1)
+		}
+	}
+
+	for _, check := range st.checks {
+		columns := st.columnSet(check.identifiers)
+		object := fmt.Sprintf("%s CHECK (%s)", st.name, strings.Join(columns, ", "))
+		if check.name != "" {
+			object = st.name + "." + check.name
+		}
+		if tt.hasCheck(columns) {
+			c.keep()
+		} else {
+			c.drop("check", object, "", 1)
+		}
+	}
+
+	for _, fk := range st.foreignKeys {
+		c.compareForeignKey(st, tt, fk)
+	}
+}
+
+// columnObjects counts a column and the constraints that go with it
+func columnObjects(col *schemaColumn) int {
+	objects := 1
+	if col.notNull {
+		objects++
+	}
+	if col.keyGen {
+		objects++
+	}
+	return objects
+}
+
+func (c *fidelityComparison) compareForeignKey(st, tt *schemaTable, fk schemaForeignKey) {
+	refColumns := fk.refColumns
+	if ref := c.source.table(fk.refTable); len(refColumns) == 0 && ref != nil {
+		refColumns = ref.primaryKey
+	}
+	object := fmt.Sprintf("%s(%s) -> %s", st.name, strings.Join(fk.columns, ", "), fk.refTable)
+	if len(refColumns) > 0 {
+		object += "(" + strings.Join(refColumns, ", ") + ")"
+	}
+
+	targetRef := c.target.table(fk.refTable)
+	match := tt.foreignKeyOn(fk.columns)
+	switch {
+	// Without the referenced table in the source, its key columns are unknown and any match
+	case match != nil && targetRef != nil && c.target.table(match.refTable) == targetRef &&
+		(len(refColumns) == 0 || sameKeys(match.refColumns, refColumns)):
+		c.keep()
+	case match != nil:
+		c.alter("foreign key", object, fmt.Sprintf("references %s(%s) instead", match.refTable, strings.Join(match.refColumns, ", ")))
+	case targetRef != nil && tt.parent != "" && c.target.table(tt.parent) == targetRef:
+		c.alter("foreign key", object, "replaced by INTERLEAVE IN PARENT "+tt.parent)
+	default:
+		c.drop("foreign key", object, "", 1)
+	}
+}
+
+// spannerSchema builds the schema model of a GoogleSQL script with memefish
+func spannerSchema(content string) *schemaModel {
+	m := &schemaModel{}
+	statements, err := ExtractStatementsFromString(content)
+	if err != nil {
+		return m
+	}
+
+	for _, stmt := range statements {
+		parsed, err := memefish.ParseStatement("", stmt)
+		if err != nil {
+			continue
+		}
+		switch s := parsed.(type) {
+		case *ast.CreateTable:
+			t := m.addTable(pathName(s.Name))
+			for _, col := range s.Columns {
+				t.addSpannerColumn(col)
+				if col.PrimaryKey {
+					t.primaryKey = append(t.primaryKey, col.Name.Name)
+				}
+			}
+			for _, key := range s.PrimaryKeys {
+				t.primaryKey = append(t.primaryKey, key.Name.Name)
+			}
+			for _, constraint := range s.TableConstraints {
+				t.addSpannerConstraint(constraint)
+			}
+			if s.Cluster != nil {
+				t.parent = pathName(s.Cluster.TableName)
+			}
+		case *ast.CreateIndex:
+			if t := m.exactTable(pathName(s.TableName)); t != nil {
+				columns := make([]string, 0, len(s.Keys))
+				for _, key := range s.Keys {
+					columns = append(columns, key.Name.Name)
+				}
+				if s.Unique {
+					t.addUnique(columns)
+				} else {
+					t.indexes = append(t.indexes, columns)
+				}
+			}
+		case *ast.AlterTable:
+			if t := m.exactTable(pathName(s.Name)); t != nil {
+				t.alterSpannerTable(s.TableAlteration)
+			}
+		}
+	}
+	return m
+}
+
+func (t *schemaTable) addSpannerColumn(def *ast.ColumnDef) {
+	col := t.addColumn(def.Name.Name)
+	col.notNull = def.NotNull
+	switch semantics := def.DefaultSemantics.(type) {
+	case *ast.IdentityColumn, *ast.AutoIncrement:
+		col.keyGen = true
+	case *ast.ColumnDefaultExpr:
+		col.keyGen = generatesKeys(semantics)
+	}
+}
+
+// generatesKeys reports whether a default generates unique keys
+func generatesKeys(def *ast.ColumnDefaultExpr) bool {
+	expr := strings.ToUpper(def.Expr.SQL())
+	return strings.Contains(expr, "GENERATE_UUID(") || strings.Contains(expr, "GET_NEXT_SEQUENCE_VALUE(")
+}
+
+func (t *schemaTable) addSpannerConstraint(tc *ast.TableConstraint) {
+	switch constraint := tc.Constraint.(type) {
+	case *ast.ForeignKey:
+		t.foreignKeys = append(t.foreignKeys, schemaForeignKey{
+			columns:    identNames(constraint.Columns),
+			refTable:   pathName(constraint.ReferenceTable),
+			refColumns: identNames(constraint.ReferenceColumns),
+		})
+	case *ast.Check:
+		check := schemaCheck{}
+		if tc.Name != nil {
+			check.name = tc.Name.Name
+		}
+		ast.Inspect(constraint.Expr, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				check.identifiers = append(check.identifiers, ident.Name)
+			}
+			return true
+		})
+		t.checks = append(t.checks, check)
+	}
+}
+
+func (t *schemaTable) alterSpannerTable(alteration ast.TableAlteration) {
+	switch a := alteration.(type) {
+	case *ast.AddColumn:
+		t.addSpannerColumn(a.Column)
+	case *ast.AddTableConstraint:
+		t.addSpannerConstraint(a.TableConstraint)
+	case *ast.AlterColumn:
+		col := t.column(a.Name.Name)
+		if col == nil {
+			return
+		}
+		switch alter := a.Alteration.(type) {
+		case *ast.AlterColumnType:
+			col.notNull = alter.NotNull
+			if alter.DefaultExpr != nil {
+				col.keyGen = generatesKeys(alter.DefaultExpr)
+			}
+		case *ast.AlterColumnSetDefault:
+			col.keyGen = generatesKeys(alter.DefaultExpr)
+		}
+	}
+}
+
+func identNames(idents []*ast.Ident) []string {
+	names := make([]string, len(idents))
+	for i, ident := range idents {
+		names[i] = ident.Name
+	}
+	return names
+}
+
+var (
+	postgresSerialTypes = map[string]bool{
+		"SERIAL": true, "SERIAL2": true, "SERIAL4": true, "SERIAL8": true, "SMALLSERIAL": true, "BIGSERIAL": true,
+	}
+	// postgresKeyFunctions are defaults that generate keys
+	postgresKeyFunctions = map[string]bool{
+		"nextval": true, "gen_random_uuid": true, "uuid_generate_v1": true, "uuid_generate_v1mc": true, "uuid_generate_v4": true,
+	}
+)
+
+// pgToken is a token of a PostgreSQL statement. Literals are kept whole, comments are dropped.
+type pgToken struct {
+	text   string // unquoted for quoted identifiers
+	word   bool   // keyword or identifier
+	quoted bool   // quoted identifier, never a keyword
+}
+
+func (t pgToken) is(keyword string) bool {
+	return t.word && !t.quoted && strings.EqualFold(t.text, keyword)
+}
+
+func (t pgToken) punct(p string) bool {
+	return !t.word && t.text == p
+}
+
+func tokenizePostgres(stmt string) []pgToken {
+	var tokens []pgToken
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+		if isPostgresIdentByte(c, true) {
+			j := i + 1
+			for j < len(stmt) && isPostgresIdentByte(stmt[j], false) {
+				j++
+			}
+			tokens = append(tokens, pgToken{text: stmt[i:j], word: true})
+			i = j
+			continue
+		}
+
+		next, err := skipPostgresToken(stmt, i)
+		if err != nil {
+			return tokens
+		}
+		switch {
+		case next == i+1:
+			tokens = append(tokens, pgToken{text: stmt[i:next]})
+		case c == '"':
+			tokens = append(tokens, pgToken{text: strings.ReplaceAll(stmt[i+1:next-1], `""`, `"`), word: true, quoted: true})
+		case c == '\'' || c == '$':
+			tokens = append(tokens, pgToken{text: stmt[i:next]})
+		}
+		i = next
+	}
+	return tokens
+}
+
+func isPostgresIdentByte(c byte, first bool) bool {
+	switch {
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+		return true
+	case first:
+		return false
+	}
+	return c >= '0' && c <= '9' || c == '$'
+}
+
+// pgGroup returns the tokens inside the parentheses opening at tokens[i] and the index after them
+func pgGroup(tokens []pgToken, i int) ([]pgToken, int, bool) {
+	if i >= len(tokens) || !tokens[i].punct("(") {
+		return nil, i, false
+	}
+	depth := 0
+	for j := i; j < len(tokens); j++ {
+		switch {
+		case tokens[j].punct("("):
+			depth++
+		case tokens[j].punct(")"):
+			depth--
+			if depth == 0 {
+				return tokens[i+1 : j], j + 1, true
+			}
+		}
+	}
+	return tokens[i+1:], len(tokens), true
+}
+
+// pgNextGroup returns the first parenthesized group from tokens[i] on
+func pgNextGroup(tokens []pgToken, i int) ([]pgToken, int) {
+	for i < len(tokens) && !tokens[i].punct("(") {
+		i++
+	}
+	group, next, _ := pgGroup(tokens, i)
+	return group, next
+}
+
+// pgSplit splits tokens at the commas outside parentheses
+func pgSplit(tokens []pgToken) [][]pgToken {
+	var parts [][]pgToken
+	depth, start := 0, 0
+	for i, tok := range tokens {
+		switch {
+		case tok.punct("("):
+			depth++
+		case tok.punct(")"):
+			depth--
+		case tok.punct(",") && depth == 0:
+			parts = append(parts, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, tokens[start:])
+}
+
+// pgSkipWords skips the keywords at tokens[i] when all of them are there
+func pgSkipWords(tokens []pgToken, i int, keywords ...string) int {
+	for k, keyword := range keywords {
+		if i+k >= len(tokens) || !tokens[i+k].is(keyword) {
+			return i
+		}
+	}
+	return i + len(keywords)
+}
+
+// pgName reads a possibly schema qualified name at tokens[i] and returns its last part
+func pgName(tokens []pgToken, i int) (string, int) {
+	for i < len(tokens) && tokens[i].word {
+		if i+2 < len(tokens) && tokens[i+1].punct(".") {
+			i += 2
+			continue
+		}
+		return tokens[i].text, i + 1
+	}
+	return "", i
+}
+
+// pgColumnList returns the column of every element of a parenthesized key list
+func pgColumnList(tokens []pgToken) []string {
+	var columns []string
+	for _, element := range pgSplit(tokens) {
+		for k, tok := range element {
+			if tok.word && (k+1 == len(element) || !element[k+1].punct("(")) {
+				columns = append(columns, tok.text)
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// pgIdentifiers returns the words of an expression that are not function names
+func pgIdentifiers(tokens []pgToken) []string {
+	var identifiers []string
+	for k, tok := range tokens {
+		if tok.word && (k+1 == len(tokens) || !tokens[k+1].punct("(")) {
+			identifiers = append(identifiers, tok.text)
+		}
+	}
+	return identifiers
+}
+
+// postgresSchema builds the schema model of a PostgreSQL script from its CREATE TABLE, CREATE
+// INDEX and ALTER TABLE statements
+func postgresSchema(content string) *schemaModel {
+	m := &schemaModel{}
+	for _, stmt := range ExtractPostgresStatements(content) {
+		tokens := tokenizePostgres(stmt)
+		switch {
+		case len(tokens) > 2 && tokens[0].is("CREATE"):
+			m.postgresCreate(tokens)
+		case len(tokens) > 2 && tokens[0].is("ALTER") && tokens[1].is("TABLE"):
+			m.postgresAlterTable(tokens[2:])
+		}
+	}
+	return m
+}
+
+func (m *schemaModel) postgresCreate(tokens []pgToken) {
+	i := 1
+	for i < len(tokens) && (tokens[i].is("GLOBAL") || tokens[i].is("LOCAL") || tokens[i].is("TEMP") ||
+		tokens[i].is("TEMPORARY") || tokens[i].is("UNLOGGED")) {
+		i++
+	}
+	unique := i < len(tokens) && tokens[i].is("UNIQUE")
+	if unique {
+		i++
+	}
+
+	switch {
+	case i < len(tokens) && tokens[i].is("TABLE") && !unique:
+		name, next := pgName(tokens, pgSkipWords(tokens, i+1, "IF", "NOT", "EXISTS"))
+		// CREATE TABLE ... AS and PARTITION OF have no element list
+		body, _, ok := pgGroup(tokens, next)
+		if name == "" || !ok {
+			return
+		}
+		t := m.addTable(name)
+		for _, element := range pgSplit(body) {
+			t.addPostgresElement(element)
+		}
+	case i < len(tokens) && tokens[i].is("INDEX"):
+		on := slices.IndexFunc(tokens, func(tok pgToken) bool { return tok.is("ON") })
+		if on < 0 {
+			return
+		}
+		name, next := pgName(tokens, pgSkipWords(tokens, on+1, "ONLY"))
+		t := m.exactTable(name)
+		if t == nil {
+			return
+		}
+		keys, _ := pgNextGroup(tokens, next)
+		if columns := pgColumnList(keys); unique {
+			t.addUnique(columns)
+		} else if len(columns) > 0 {
+			t.indexes = append(t.indexes, columns)
+		}
+	}
+}
+
+func (m *schemaModel) postgresAlterTable(tokens []pgToken) {
+	i := pgSkipWords(tokens, 0, "IF", "EXISTS")
+	name, i := pgName(tokens, pgSkipWords(tokens, i, "ONLY"))
+	t := m.exactTable(name)
+	if t == nil {
+		return
+	}
+
+	for _, action := range pgSplit(tokens[i:]) {
+		switch {
+		case len(action) > 1 && action[0].is("ADD"):
+			element := action[pgSkipWords(action, 1, "COLUMN"):]
+			element = element[pgSkipWords(element, 0, "IF", "NOT", "EXISTS"):]
+			t.addPostgresElement(element)
+		case len(action) > 1 && action[0].is("ALTER"):
+			j := pgSkipWords(action, 1, "COLUMN")
+			if j+1 < len(action) && pgSkipWords(action, j+1, "SET", "NOT", "NULL") > j+1 {
+				if col := t.column(action[j].text); col != nil {
+					col.notNull = true
+				}
+			}
+		}
+	}
+}
+
+// addPostgresElement adds a column definition or table constraint of CREATE TABLE or ALTER TABLE ADD
+func (t *schemaTable) addPostgresElement(element []pgToken) {
+	if len(element) == 0 {
+		return
+	}
+	name := ""
+	if element[0].is("CONSTRAINT") && len(element) > 2 {
+		name, element = element[1].text, element[2:]
+	}
+
+	switch first := element[0]; {
+	case first.is("PRIMARY"):
+		keys, _ := pgNextGroup(element, 1)
+		t.primaryKey = pgColumnList(keys)
+	case first.is("UNIQUE"):
+		keys, _ := pgNextGroup(element, 1)
+		t.addUnique(pgColumnList(keys))
+	case first.is("CHECK"):
+		expr, _ := pgNextGroup(element, 1)
+		t.checks = append(t.checks, schemaCheck{name: name, identifiers: pgIdentifiers(expr)})
+	case first.is("FOREIGN"):
+		keys, next := pgNextGroup(element, 1)
+		if next < len(element) && element[next].is("REFERENCES") {
+			t.addPostgresReference(pgColumnList(keys), element, next+1)
+		}
+	case first.is("EXCLUDE") || first.is("LIKE") || name != "":
+	default:
+		t.addPostgresColumn(element)
+	}
+}
+
+func (t *schemaTable) addPostgresColumn(element []pgToken) {
+	col := t.addColumn(element[0].text)
+	if len(element) > 1 && postgresSerialTypes[strings.ToUpper(element[1].text)] {
+		col.keyGen = true
+	}
+
+	depth := 0
+	for i := 1; i < len(element); i++ {
+		tok := element[i]
+		switch {
+		case tok.punct("("):
+			depth++
+		case tok.punct(")"):
+			depth--
+		case tok.word && postgresKeyFunctions[strings.ToLower(tok.text)] && i+1 < len(element) && element[i+1].punct("("):
+			col.keyGen = true
+		case depth > 0:
+		case tok.is("NOT") && i+1 < len(element) && element[i+1].is("NULL"):
+			col.notNull = true
+		case tok.is("PRIMARY"):
+			t.primaryKey = []string{col.name}
+		case tok.is("UNIQUE"):
+			t.addUnique([]string{col.name})
+		case tok.is("IDENTITY"):
+			col.keyGen = true
+		case tok.is("CHECK"):
+			expr, next := pgNextGroup(element, i+1)
+			t.checks = append(t.checks, schemaCheck{identifiers: pgIdentifiers(expr)})
+			i = next - 1
+		case tok.is("REFERENCES"):
+			t.addPostgresReference([]string{col.name}, element, i+1)
+		}
+	}
+}
+
+// addPostgresReference adds a foreign key on columns whose REFERENCES target starts at tokens[i]
+func (t *schemaTable) addPostgresReference(columns []string, tokens []pgToken, i int) {
+	refTable, next := pgName(tokens, i)
+	if refTable == "" || len(columns) == 0 {
+		return
+	}
+	fk := schemaForeignKey{columns: columns, refTable: refTable}
+	if keys, _, ok := pgGroup(tokens, next); ok {
+		fk.refColumns = pgColumnList(keys)
+	}
+	t.foreignKeys = append(t.foreignKeys, fk)
+}
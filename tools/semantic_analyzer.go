@@ -0,0 +1,875 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudspannerecosystem/memefish"
+	"github.com/cloudspannerecosystem/memefish/ast"
+)
+
+// SemanticError is a statement that parses but does not fit the schema built by the statements
+// before it: an unknown table or column, a foreign key whose types differ, a value that cannot
+// be inserted into its column, and so on. Category groups them like parse error types.
+type SemanticError struct {
+	Statement string
+	Category  string
+	Message   string
+}
+
+func (e *SemanticError) Error() string { return e.Message }
+
+func semanticErrorf(category, format string, args ...any) *SemanticError {
+	return &SemanticError{Category: category, Message: fmt.Sprintf(format, args...)}
+}
+
+// Catalog is an in-process model of a GoogleSQL schema, built from the parsed DDL. It lets
+// statements be checked against the schema in milliseconds, without an emulator.
+type Catalog struct {
+	tables  map[string]*catalogTable
+	indexes map[string]*catalogIndex
+}
+
+type catalogTable struct {
+	name       string
+	columns    []*catalogColumn
+	primaryKey []string
+	view       bool
+	// opaque views have columns that could not be derived from their query
+	opaque bool
+}
+
+type catalogColumn struct {
+	name     string
+	typ      string // GoogleSQL type without size, e.g. STRING, INT64, ARRAY<STRING>
+	notNull  bool
+	defaults bool // DEFAULT, generated, identity or auto increment
+}
+
+type catalogIndex struct {
+	name  string
+	table string
+}
+
+// NewCatalog creates an empty catalog
+func NewCatalog() *Catalog {
+	return &Catalog{
+		tables:  make(map[string]*catalogTable),
+		indexes: make(map[string]*catalogIndex),
+	}
+}
+
+// AnalyzeSemantics checks statements that parsed with memefish against the schema they build. The
+// statements are visited in the order SQLExecutor runs them: CREATE, then INSERT and SELECT, then
+// the rest (ALTER, UPDATE, DELETE); DROP runs first on an empty database and is not checked. The
+// result has one entry per statement, nil when no problem was found.
+func AnalyzeSemantics(statements []string) []*SemanticError {
+	results := make([]*SemanticError, len(statements))
+	parsed := make([]ast.Statement, len(statements))
+	for i, stmt := range statements {
+		parsed[i], _ = memefish.ParseStatement("", stmt)
+	}
+
+	catalog := NewCatalog()
+	for _, phase := range []string{"CREATE", "QUERY", "OTHER"} {
+		for i, stmt := range parsed {
+			if stmt == nil || executionPhase(statements[i]) != phase {
+				continue
+			}
+			if err := catalog.Apply(stmt); err != nil {
+				err.Statement = statements[i]
+				results[i] = err
+			}
+		}
+	}
+	return results
+}
+
+// executionPhase mirrors the statement ordering of SQLExecutor.ExecuteStatements
+func executionPhase(stmt string) string {
+	switch GetStatementType(nil, stmt) {
+	case "CREATE":
+		return "CREATE"
+	case "INSERT", "SELECT":
+		return "QUERY"
+	case "DROP":
+		return "DROP"
+	default:
+		return "OTHER"
+	}
+}
+
+// Apply checks one statement and, for DDL that passes, adds its objects to the catalog
+func (c *Catalog) Apply(stmt ast.Statement) *SemanticError {
+	switch s := stmt.(type) {
+	case *ast.CreateTable:
+		return c.createTable(s)
+	case *ast.CreateIndex:
+		return c.createIndex(s)
+	case *ast.CreateView:
+		return c.createView(s)
+	case *ast.AlterTable:
+		return c.alterTable(s)
+	case *ast.Insert:
+		return c.insert(s)
+	case *ast.Update:
+		return c.update(s)
+	case *ast.Delete:
+		return c.delete(s)
+	case *ast.QueryStatement:
+		_, err := c.query(s.Query, nil)
+		return err
+	}
+	return nil
+}
+
+func (c *Catalog) table(name string) *catalogTable {
+	return c.tables[strings.ToLower(name)]
+}
+
+func (t *catalogTable) column(name string) *catalogColumn {
+	for _, col := range t.columns {
+		if strings.EqualFold(col.name, name) {
+			return col
+		}
+	}
+	return nil
+}
+
+// lookupTable returns the base table name refers to, or an Unknown Table error
+func (c *Catalog) lookupTable(name string) (*catalogTable, *SemanticError) {
+	t := c.table(name)
+	switch {
+	case t == nil:
+		return nil, semanticErrorf("Semantic: Unknown Table", "table %s does not exist", name)
+	case t.view:
+		return nil, semanticErrorf("Semantic: Unknown Table", "%s is a view, not a table", name)
+	}
+	return t, nil
+}
+
+func (c *Catalog) createTable(ct *ast.CreateTable) *SemanticError {
+	name := pathName(ct.Name)
+	if c.table(name) != nil {
+		if ct.IfNotExists {
+			return nil
+		}
+		return semanticErrorf("Semantic: Duplicate Object", "table %s already exists", name)
+	}
+
+	t := &catalogTable{name: name}
+	for _, col := range ct.Columns {
+		if t.column(col.Name.Name) != nil {
+			return semanticErrorf("Semantic: Duplicate Object", "column %s is defined twice in table %s", col.Name.Name, name)
+		}
+		t.columns = append(t.columns, newCatalogColumn(col))
+		if col.PrimaryKey {
+			t.primaryKey = append(t.primaryKey, col.Name.Name)
+		}
+	}
+	for _, key := range ct.PrimaryKeys {
+		t.primaryKey = append(t.primaryKey, key.Name.Name)
+	}
+
+	// PRIMARY KEY () is a valid key for single row tables
+	if len(t.primaryKey) == 0 && ct.PrimaryKeyRparen.Invalid() {
+		return semanticErrorf("Semantic: Invalid Primary Key", "table %s has no PRIMARY KEY", name)
+	}
+	for _, key := range t.primaryKey {
+		if t.column(key) == nil {
+			return semanticErrorf("Semantic: Invalid Primary Key", "primary key column %s is not a column of table %s", key, name)
+		}
+	}
+
+	if ct.Cluster != nil {
+		parentName := pathName(ct.Cluster.TableName)
+		parent, err := c.lookupTable(parentName)
+		if err != nil {
+			return err
+		}
+		for i, key := range parent.primaryKey {
+			if i >= len(t.primaryKey) || !strings.EqualFold(t.primaryKey[i], key) {
+				return semanticErrorf("Semantic: Invalid Primary Key", "table %s is interleaved in %s, so its primary key must start with (%s)",
+					name, parent.name, strings.Join(parent.primaryKey, ", "))
+			}
+		}
+	}
+
+	for _, constraint := range ct.TableConstraints {
+		if fk, ok := constraint.Constraint.(*ast.ForeignKey); ok {
+			if err := c.checkForeignKey(t, fk); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.tables[strings.ToLower(name)] = t
+	return nil
+}
+
+func newCatalogColumn(col *ast.ColumnDef) *catalogColumn {
+	return &catalogColumn{
+		name:     col.Name.Name,
+		typ:      schemaTypeName(col.Type),
+		notNull:  col.NotNull,
+		defaults: col.DefaultSemantics != nil,
+	}
+}
+
+// checkForeignKey checks a foreign key of t, which may refer to t itself
+func (c *Catalog) checkForeignKey(t *catalogTable, fk *ast.ForeignKey) *SemanticError {
+	refName := pathName(fk.ReferenceTable)
+	ref := t
+	if !strings.EqualFold(refName, t.name) {
+		var err *SemanticError
+		if ref, err = c.lookupTable(refName); err != nil {
+			return err
+		}
+	}
+	if len(fk.Columns) != len(fk.ReferenceColumns) {
+		return semanticErrorf("Semantic: Foreign Key Mismatch", "foreign key of %s has %d columns but references %d columns of %s",
+			t.name, len(fk.Columns), len(fk.ReferenceColumns), ref.name)
+	}
+
+	for i, ident := range fk.Columns {
+		col := t.column(ident.Name)
+		if col == nil {
+			return semanticErrorf("Semantic: Unknown Column", "foreign key column %s is not a column of table %s", ident.Name, t.name)
+		}
+		refCol := ref.column(fk.ReferenceColumns[i].Name)
+		if refCol == nil {
+			return semanticErrorf("Semantic: Unknown Column", "foreign key references column %s, which is not a column of table %s",
+				fk.ReferenceColumns[i].Name, ref.name)
+		}
+		if col.typ != "" && refCol.typ != "" && col.typ != refCol.typ {
+			return semanticErrorf("Semantic: Foreign Key Mismatch", "foreign key column %s.%s (%s) does not match the type of %s.%s (%s)",
+				t.name, col.name, col.typ, ref.name, refCol.name, refCol.typ)
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) createIndex(ci *ast.CreateIndex) *SemanticError {
+	name := pathName(ci.Name)
+	if _, exists := c.indexes[strings.ToLower(name)]; exists {
+		if ci.IfNotExists {
+			return nil
+		}
+		return semanticErrorf("Semantic: Duplicate Object", "index %s already exists", name)
+	}
+
+	t, err := c.lookupTable(pathName(ci.TableName))
+	if err != nil {
+		return err
+	}
+	columns := make([]*ast.Ident, 0, len(ci.Keys))
+	for _, key := range ci.Keys {
+		columns = append(columns, key.Name)
+	}
+	if ci.Storing != nil {
+		columns = append(columns, ci.Storing.Columns...)
+	}
+	for _, ident := range columns {
+		if t.column(ident.Name) == nil {
+			return semanticErrorf("Semantic: Unknown Column", "index %s uses column %s, which is not a column of table %s", name, ident.Name, t.name)
+		}
+	}
+	if ci.InterleaveIn != nil {
+		if _, err := c.lookupTable(ci.InterleaveIn.TableName.Name); err != nil {
+			return err
+		}
+	}
+
+	c.indexes[strings.ToLower(name)] = &catalogIndex{name: name, table: t.name}
+	return nil
+}
+
+func (c *Catalog) createView(cv *ast.CreateView) *SemanticError {
+	name := pathName(cv.Name)
+	if existing := c.table(name); existing != nil && !(existing.view && cv.OrReplace) {
+		return semanticErrorf("Semantic: Duplicate Object", "%s already exists", name)
+	}
+
+	columns, err := c.query(cv.Query, nil)
+	if err != nil {
+		return err
+	}
+	view := &catalogTable{name: name, view: true, opaque: columns == nil}
+	for _, column := range columns {
+		view.columns = append(view.columns, &catalogColumn{name: column})
+	}
+	c.tables[strings.ToLower(name)] = view
+	return nil
+}
+
+func (c *Catalog) alterTable(at *ast.AlterTable) *SemanticError {
+	t, err := c.lookupTable(pathName(at.Name))
+	if err != nil {
+		return err
+	}
+
+	switch alteration := at.TableAlteration.(type) {
+	case *ast.AddColumn:
+		if t.column(alteration.Column.Name.Name) != nil {
+			if alteration.IfNotExists {
+				return nil
+			}
+			return semanticErrorf("Semantic: Duplicate Object", "column %s already exists in table %s", alteration.Column.Name.Name, t.name)
+		}
+		t.columns = append(t.columns, newCatalogColumn(alteration.Column))
+	case *ast.AddTableConstraint:
+		if fk, ok := alteration.TableConstraint.Constraint.(*ast.ForeignKey); ok {
+			return c.checkForeignKey(t, fk)
+		}
+	case *ast.DropColumn:
+		if t.column(alteration.Name.Name) == nil {
+			return semanticErrorf("Semantic: Unknown Column", "column %s is not a column of table %s", alteration.Name.Name, t.name)
+		}
+		for i, col := range t.columns {
+			if strings.EqualFold(col.name, alteration.Name.Name) {
+				t.columns = append(t.columns[:i], t.columns[i+1:]...)
+				break
+			}
+		}
+	case *ast.AlterColumn:
+		if t.column(alteration.Name.Name) == nil {
+			return semanticErrorf("Semantic: Unknown Column", "column %s is not a column of table %s", alteration.Name.Name, t.name)
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) insert(ins *ast.Insert) *SemanticError {
+	t, err := c.lookupTable(pathName(ins.TableName))
+	if err != nil {
+		return err
+	}
+
+	columns := make([]*catalogColumn, 0, len(ins.Columns))
+	for _, ident := range ins.Columns {
+		col := t.column(ident.Name)
+		if col == nil {
+			return semanticErrorf("Semantic: Unknown Column", "column %s is not a column of table %s", ident.Name, t.name)
+		}
+		columns = append(columns, col)
+	}
+	for _, col := range t.columns {
+		if col.notNull && !col.defaults && !containsColumn(columns, col) {
+			return semanticErrorf("Semantic: Missing Required Column", "INSERT into %s does not set the NOT NULL column %s, which has no default", t.name, col.name)
+		}
+	}
+
+	switch input := ins.Input.(type) {
+	case *ast.ValuesInput:
+		for i, row := range input.Rows {
+			if len(row.Exprs) != len(columns) {
+				return semanticErrorf("Semantic: Column Count Mismatch", "row %d of the INSERT into %s has %d values for %d columns", i+1, t.name, len(row.Exprs), len(columns))
+			}
+			for j, value := range row.Exprs {
+				if value.Default {
+					continue
+				}
+				if err := checkAssignment(t, columns[j], value.Expr); err != nil {
+					return err
+				}
+			}
+		}
+	case *ast.SubQueryInput:
+		results, err := c.query(input.Query, nil)
+		if err != nil {
+			return err
+		}
+		if results != nil && len(results) != len(columns) {
+			return semanticErrorf("Semantic: Column Count Mismatch", "the query of the INSERT into %s returns %d columns for %d columns", t.name, len(results), len(columns))
+		}
+	}
+	return nil
+}
+
+func containsColumn(columns []*catalogColumn, col *catalogColumn) bool {
+	for _, c := range columns {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAssignment checks that a literal value fits its column
+func checkAssignment(t *catalogTable, col *catalogColumn, value ast.Expr) *SemanticError {
+	literal := literalType(value)
+	if literal == "NULL" {
+		if col.notNull {
+			return semanticErrorf("Semantic: Missing Required Column", "NULL is set for the NOT NULL column %s.%s", t.name, col.name)
+		}
+		return nil
+	}
+	if !literalAssignable(literal, col.typ) {
+		return semanticErrorf("Semantic: Type Mismatch", "a %s value cannot be stored in %s.%s, which has type %s", literal, t.name, col.name, col.typ)
+	}
+	return nil
+}
+
+func (c *Catalog) update(u *ast.Update) *SemanticError {
+	t, err := c.lookupTable(pathName(u.TableName))
+	if err != nil {
+		return err
+	}
+	scope := &queryScope{complete: true}
+	scope.add(aliasOr(u.As, t.name), t)
+
+	for _, item := range u.Updates {
+		col := t.column(item.Path[len(item.Path)-1].Name)
+		if col == nil {
+			return semanticErrorf("Semantic: Unknown Column", "column %s is not a column of table %s", identsName(item.Path), t.name)
+		}
+		if !item.DefaultExpr.Default {
+			if err := checkAssignment(t, col, item.DefaultExpr.Expr); err != nil {
+				return err
+			}
+			if err := scope.checkRefs(item.DefaultExpr.Expr); err != nil {
+				return err
+			}
+		}
+	}
+	if u.Where != nil {
+		return scope.checkRefs(u.Where.Expr)
+	}
+	return nil
+}
+
+func (c *Catalog) delete(d *ast.Delete) *SemanticError {
+	t, err := c.lookupTable(pathName(d.TableName))
+	if err != nil {
+		return err
+	}
+	scope := &queryScope{complete: true}
+	scope.add(aliasOr(d.As, t.name), t)
+	if d.Where != nil {
+		return scope.checkRefs(d.Where.Expr)
+	}
+	return nil
+}
+
+// query checks the table and column references of a query and returns its column names, or
+// nil when they cannot be derived. ctes are the names defined by enclosing WITH clauses.
+func (c *Catalog) query(q ast.QueryExpr, ctes map[string]bool) ([]string, *SemanticError) {
+	switch q := q.(type) {
+	case *ast.Query:
+		if q.With != nil {
+			ctes = withCTEs(ctes, q.With)
+			for _, cte := range q.With.CTEs {
+				if _, err := c.query(cte.QueryExpr, ctes); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return c.query(q.Query, ctes)
+	case *ast.SubQuery:
+		return c.query(q.Query, ctes)
+	case *ast.CompoundQuery:
+		var columns []string
+		for i, part := range q.Queries {
+			partColumns, err := c.query(part, ctes)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				columns = partColumns
+			}
+		}
+		return columns, nil
+	case *ast.Select:
+		return c.selectQuery(q, ctes)
+	}
+	return nil, nil
+}
+
+func withCTEs(outer map[string]bool, with *ast.With) map[string]bool {
+	ctes := make(map[string]bool, len(outer)+len(with.CTEs))
+	for name := range outer {
+		ctes[name] = true
+	}
+	for _, cte := range with.CTEs {
+		ctes[strings.ToLower(cte.Name.Name)] = true
+	}
+	return ctes
+}
+
+func (c *Catalog) selectQuery(s *ast.Select, ctes map[string]bool) ([]string, *SemanticError) {
+	scope := &queryScope{complete: true}
+	if s.From != nil {
+		if err := c.addTableExpr(scope, s.From.Source, ctes); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range s.Results {
+		if a, ok := item.(*ast.Alias); ok {
+			scope.aliases = append(scope.aliases, a.As.Alias.Name)
+		}
+	}
+
+	var exprs []ast.Expr
+	for _, item := range s.Results {
+		switch item := item.(type) {
+		case *ast.Alias:
+			exprs = append(exprs, item.Expr)
+		case *ast.ExprSelectItem:
+			exprs = append(exprs, item.Expr)
+		}
+	}
+	exprs = append(exprs, scope.conditions...)
+	if s.Where != nil {
+		exprs = append(exprs, s.Where.Expr)
+	}
+	if s.GroupBy != nil {
+		exprs = append(exprs, s.GroupBy.Exprs...)
+	}
+	if s.Having != nil {
+		exprs = append(exprs, s.Having.Expr)
+	}
+	for _, expr := range exprs {
+		if err := scope.checkRefs(expr); err != nil {
+			return nil, err
+		}
+	}
+	if !scope.complete {
+		return nil, nil
+	}
+
+	var columns []string
+	for _, item := range s.Results {
+		switch item := item.(type) {
+		case *ast.Star:
+			if item.Except != nil || item.Replace != nil {
+				return nil, nil
+			}
+			for _, st := range scope.tables {
+				for _, col := range st.table.columns {
+					columns = append(columns, col.name)
+				}
+			}
+		case *ast.Alias:
+			columns = append(columns, item.As.Alias.Name)
+		case *ast.ExprSelectItem:
+			switch expr := item.Expr.(type) {
+			case *ast.Ident:
+				columns = append(columns, expr.Name)
+			case *ast.Path:
+				columns = append(columns, expr.Idents[len(expr.Idents)-1].Name)
+			default:
+				return nil, nil
+			}
+		default:
+			return nil, nil
+		}
+	}
+	return columns, nil
+}
+
+// addTableExpr adds the tables of a FROM clause to scope. Sources the catalog cannot describe,
+// like subqueries and UNNEST, make the scope incomplete so column references are not checked.
+func (c *Catalog) addTableExpr(scope *queryScope, te ast.TableExpr, ctes map[string]bool) *SemanticError {
+	switch te := te.(type) {
+	case *ast.TableName:
+		return c.addTable(scope, te.Table.Name, te.As, te.Hint, ctes)
+	case *ast.PathTableExpr:
+		first := te.Path.Idents[0].Name
+		if len(te.Path.Idents) > 1 && scope.lookup(first) != nil {
+			scope.complete = false // UNNEST of an array column
+			return nil
+		}
+		return c.addTable(scope, pathName(te.Path), te.As, te.Hint, ctes)
+	case *ast.Join:
+		if err := c.addTableExpr(scope, te.Left, ctes); err != nil {
+			return err
+		}
+		if err := c.addTableExpr(scope, te.Right, ctes); err != nil {
+			return err
+		}
+		switch cond := te.Cond.(type) {
+		case *ast.On:
+			scope.conditions = append(scope.conditions, cond.Expr)
+		case *ast.Using:
+			for _, ident := range cond.Idents {
+				scope.conditions = append(scope.conditions, ident)
+			}
+		}
+		return nil
+	case *ast.ParenTableExpr:
+		return c.addTableExpr(scope, te.Source, ctes)
+	case *ast.SubQueryTableExpr:
+		scope.complete = false
+		_, err := c.query(te.Query, ctes)
+		return err
+	}
+	scope.complete = false
+	return nil
+}
+
+func (c *Catalog) addTable(scope *queryScope, name string, as *ast.AsAlias, hint *ast.Hint, ctes map[string]bool) *SemanticError {
+	if ctes[strings.ToLower(name)] {
+		scope.complete = false
+		return nil
+	}
+	t := c.table(name)
+	if t == nil {
+		return semanticErrorf("Semantic: Unknown Table", "table %s does not exist", name)
+	}
+	if t.opaque {
+		scope.complete = false
+	}
+	if err := c.checkIndexHint(t, hint); err != nil {
+		return err
+	}
+	scope.add(aliasOr(as, t.name), t)
+	return nil
+}
+
+// checkIndexHint checks that a FORCE_INDEX hint names an index of the table
+func (c *Catalog) checkIndexHint(t *catalogTable, hint *ast.Hint) *SemanticError {
+	if hint == nil {
+		return nil
+	}
+	for _, record := range hint.Records {
+		if !strings.EqualFold(pathName(record.Key), "FORCE_INDEX") {
+			continue
+		}
+		ident, ok := record.Value.(*ast.Ident)
+		if !ok || strings.EqualFold(ident.Name, "_BASE_TABLE") {
+			continue
+		}
+		index, exists := c.indexes[strings.ToLower(ident.Name)]
+		if !exists {
+			return semanticErrorf("Semantic: Unknown Index", "index %s does not exist", ident.Name)
+		}
+		if !strings.EqualFold(index.table, t.name) {
+			return semanticErrorf("Semantic: Unknown Index", "index %s is an index of %s, not of %s", index.name, index.table, t.name)
+		}
+	}
+	return nil
+}
+
+// queryScope holds the tables a query can refer to by alias, and the select list aliases
+type queryScope struct {
+	tables     []scopeTable
+	aliases    []string
+	conditions []ast.Expr // join conditions, checked once every table is in scope
+	// complete is false when a source of the query is unknown, so a missing column proves nothing
+	complete bool
+}
+
+type scopeTable struct {
+	alias string
+	table *catalogTable
+}
+
+func (s *queryScope) add(alias string, t *catalogTable) {
+	s.tables = append(s.tables, scopeTable{alias: alias, table: t})
+}
+
+func (s *queryScope) lookup(alias string) *catalogTable {
+	for _, st := range s.tables {
+		if strings.EqualFold(st.alias, alias) {
+			return st.table
+		}
+	}
+	return nil
+}
+
+func (s *queryScope) hasColumn(name string) bool {
+	for _, st := range s.tables {
+		if st.table.column(name) != nil {
+			return true
+		}
+	}
+	for _, alias := range s.aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRefs checks the column references of expr against the scope
+func (s *queryScope) checkRefs(expr ast.Expr) *SemanticError {
+	if !s.complete {
+		return nil
+	}
+	for _, ref := range columnRefs(expr) {
+		first := ref[0].Name
+		if len(ref) > 1 {
+			if t := s.lookup(first); t != nil {
+				if t.opaque || t.column(ref[1].Name) != nil {
+					continue
+				}
+				return semanticErrorf("Semantic: Unknown Column", "column %s is not a column of %s", ref[1].Name, t.name)
+			}
+		}
+		if s.hasColumn(first) || s.lookup(first) != nil || bareKeywords[strings.ToUpper(first)] {
+			continue
+		}
+		return semanticErrorf("Semantic: Unknown Column", "column %s is not a column of %s", first, s.tableNames())
+	}
+	return nil
+}
+
+func (s *queryScope) tableNames() string {
+	names := make([]string, 0, len(s.tables))
+	for _, st := range s.tables {
+		names = append(names, st.table.name)
+	}
+	if len(names) == 0 {
+		return "any table in the query"
+	}
+	return strings.Join(names, ", ")
+}
+
+// bareKeywords are identifiers that are not column references: date parts passed to date
+// functions and the CURRENT_* functions written without parentheses
+var bareKeywords = map[string]bool{
+	"NANOSECOND": true, "MICROSECOND": true, "MILLISECOND": true, "SECOND": true, "MINUTE": true,
+	"HOUR": true, "DAY": true, "DAYOFWEEK": true, "DAYOFYEAR": true, "WEEK": true, "ISOWEEK": true,
+	"MONTH": true, "QUARTER": true, "YEAR": true, "ISOYEAR": true, "DATE": true, "TIME": true,
+	"CURRENT_DATE": true, "CURRENT_TIMESTAMP": true,
+}
+
+// columnRefs returns the identifiers and paths of expr that can be column references. Function
+// names, types, subqueries and constructs that introduce their own names are skipped.
+func columnRefs(expr ast.Expr) [][]*ast.Ident {
+	var refs [][]*ast.Ident
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Ident:
+			refs = append(refs, []*ast.Ident{n})
+			return false
+		case *ast.Path:
+			refs = append(refs, n.Idents)
+			return false
+		case *ast.CallExpr:
+			for _, arg := range n.Args {
+				if exprArg, ok := arg.(*ast.ExprArg); ok {
+					ast.Inspect(exprArg.Expr, visit)
+				}
+			}
+			for _, named := range n.NamedArgs {
+				ast.Inspect(named.Value, visit)
+			}
+			return false
+		case *ast.CastExpr:
+			ast.Inspect(n.Expr, visit)
+			return false
+		case *ast.ExtractExpr:
+			ast.Inspect(n.Expr, visit)
+			return false
+		case *ast.SelectorExpr:
+			ast.Inspect(n.Expr, visit)
+			return false
+		case *ast.ScalarSubQuery, *ast.ArraySubQuery, *ast.ExistsSubQuery, *ast.SubQuery,
+			*ast.Query, *ast.Select, *ast.CompoundQuery, *ast.WithExpr, *ast.ReplaceFieldsExpr,
+			*ast.NewConstructor, *ast.BracedNewConstructor, *ast.BracedConstructor,
+			*ast.TypedStructLiteral, *ast.TypelessStructLiteral:
+			return false
+		}
+		return true
+	}
+	ast.Inspect(expr, visit)
+	return refs
+}
+
+// literalType returns the type of a literal value, NULL for NULL and "" for other expressions
+func literalType(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return literalType(e.Expr)
+	case *ast.UnaryExpr:
+		if e.Op == ast.OpMinus || e.Op == ast.OpPlus {
+			return literalType(e.Expr)
+		}
+	case *ast.NullLiteral:
+		return "NULL"
+	case *ast.StringLiteral:
+		return "STRING"
+	case *ast.IntLiteral:
+		return "INT64"
+	case *ast.FloatLiteral:
+		return "FLOAT64"
+	case *ast.BoolLiteral:
+		return "BOOL"
+	case *ast.DateLiteral:
+		return "DATE"
+	case *ast.TimestampLiteral:
+		return "TIMESTAMP"
+	case *ast.NumericLiteral:
+		return "NUMERIC"
+	case *ast.JSONLiteral:
+		return "JSON"
+	case *ast.BytesLiteral:
+		return "BYTES"
+	}
+	return ""
+}
+
+// literalAssignable reports whether a literal of type literal can be stored in a column of
+// type column, following the literal coercions of GoogleSQL
+func literalAssignable(literal, column string) bool {
+	if literal == "" || column == "" || strings.HasPrefix(column, "ARRAY") {
+		return true
+	}
+	allowed := map[string][]string{
+		"STRING":    {"STRING", "DATE", "TIMESTAMP"},
+		"INT64":     {"INT64", "FLOAT64", "FLOAT32", "NUMERIC"},
+		"FLOAT64":   {"FLOAT64", "FLOAT32", "NUMERIC"},
+		"NUMERIC":   {"NUMERIC", "FLOAT64", "FLOAT32"},
+		"BOOL":      {"BOOL"},
+		"DATE":      {"DATE", "TIMESTAMP"},
+		"TIMESTAMP": {"TIMESTAMP"},
+		"JSON":      {"JSON"},
+		"BYTES":     {"BYTES"},
+	}
+	types, known := allowed[literal]
+	if !known {
+		return true
+	}
+	for _, t := range types {
+		if t == column {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaTypeName returns the GoogleSQL type of a column without its size
+func schemaTypeName(t ast.SchemaType) string {
+	switch t := t.(type) {
+	case *ast.ScalarSchemaType:
+		return string(t.Name)
+	case *ast.SizedSchemaType:
+		return string(t.Name)
+	case *ast.ArraySchemaType:
+		return "ARRAY<" + schemaTypeName(t.Item) + ">"
+	}
+	return ""
+}
+
+// pathName returns the object name of a possibly schema qualified path
+func pathName(p *ast.Path) string {
+	return p.Idents[len(p.Idents)-1].Name
+}
+
+func identsName(idents []*ast.Ident) string {
+	names := make([]string, 0, len(idents))
+	for _, ident := range idents {
+		names = append(names, ident.Name)
+	}
+	return strings.Join(names, ".")
+}
+
+func aliasOr(as *ast.AsAlias, name string) string {
+	if as != nil {
+		return as.Alias.Name
+	}
+	return name
+}
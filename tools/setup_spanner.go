@@ -4,18 +4,22 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
+	"net/url"
 	"time"
 
 	database "cloud.google.com/go/spanner/admin/database/apiv1"
 	"cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
 	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
-	"cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/go-connections/nat"
 	"github.com/moby/moby/pkg/namesgenerator"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 
 	_ "github.com/googleapis/go-sql-spanner"
 	_ "github.com/jackc/pgx/v4/stdlib"
@@ -107,11 +111,46 @@ func setupSpannerForPGAdapter() (dsn string, terminate func(), err error) {
 	return dsn, func() { dbContainer.Terminate(ctx) }, nil
 }
 
+var emulatorHostOverride string
+
+// SetEmulatorHost makes every setup attach to the emulator at host:port instead of starting a
+// container. Without it the SPANNER_EMULATOR_HOST environment variable is used when set.
+func SetEmulatorHost(host string) {
+	emulatorHostOverride = host
+}
+
+// EmulatorHost returns the running emulator to attach to, or "" to start containers
+func EmulatorHost() string {
+	if emulatorHostOverride != "" {
+		return emulatorHostOverride
+	}
+	return Get().SpannerEmulatorHost
+}
+
+var pgAdapterHostOverride string
+
+// SetPGAdapterHost makes PostgreSQL dialect setups connect through the PGAdapter at host:port,
+// which must serve the emulator returned by EmulatorHost. Without it the PGADAPTER_HOST
+// environment variable is used when set.
+func SetPGAdapterHost(host string) {
+	pgAdapterHostOverride = host
+}
+
+// PGAdapterHost returns the running PGAdapter to attach to, or "" to start containers
+func PGAdapterHost() string {
+	if pgAdapterHostOverride != "" {
+		return pgAdapterHostOverride
+	}
+	return Get().PGAdapterHost
+}
+
 const (
 	testProject  = "test-project"
 	testInstance = "test-instance"
 	SpannerDB    = "test-database"
 	listenPort   = "9010/tcp"
+	// pgAdapterPort is where the pgadapter-emulator image serves the PostgreSQL protocol
+	pgAdapterPort = "5432/tcp"
 )
 
 func setupSpannerForGoogleSQLWithIdentifier(uniqueID string) (dsn string, terminate func(), err error) {
@@ -123,9 +162,36 @@ func setupSpannerForGoogleSQLWithIdentifier(uniqueID string) (dsn string, termin
 		dbName = fmt.Sprintf("%s-%s", SpannerDB, uniqueID)
 	}
 
-	dsn = fmt.Sprintf("projects/%s/instances/%s/databases/%s?x-clean-statements=true", testProject, testInstance, dbName)
 	terminate = func() {}
 
+	// Attach to a running emulator when one is configured, it is left running afterwards
+	emulatorHost := EmulatorHost()
+	if emulatorHost == "" {
+		spannerEmulator, host, err := startSpannerEmulator(ctx)
+		if err != nil {
+			return "", terminate, &SetupError{Stage: SetupStageStart, Err: err}
+		}
+		terminate = func() { _ = spannerEmulator.Terminate(ctx) }
+		emulatorHost = host
+	}
+
+	// The endpoint is passed explicitly rather than through SPANNER_EMULATOR_HOST, so concurrent
+	// setups each talk to their own container
+	if err := setupInstance(ctx, emulatorHost); err != nil {
+		return "", terminate, err
+	}
+
+	// A long-lived emulator may already have the database from an earlier run
+	err = createDatabaseWithName(ctx, dbName, emulatorClientOptions(emulatorHost)...)
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return "", terminate, &SetupError{Stage: SetupStageDatabase, Endpoint: emulatorHost, Err: err}
+	}
+
+	return emulatorDSN(emulatorHost, dbName), terminate, nil
+}
+
+// startSpannerEmulator starts an emulator container and returns it with its gRPC endpoint
+func startSpannerEmulator(ctx context.Context) (testcontainers.Container, string, error) {
 	req := testcontainers.GenericContainerRequest{
 		ContainerRequest: testcontainers.ContainerRequest{
 			Image:        "gcr.io/cloud-spanner-emulator/emulator",
@@ -141,106 +207,134 @@ func setupSpannerForGoogleSQLWithIdentifier(uniqueID string) (dsn string, termin
 
 	spannerEmulator, err := testcontainers.GenericContainer(ctx, req)
 	if err != nil {
-		return dsn, terminate, err
+		return nil, "", err
 	}
 
-	terminate = func() { _ = spannerEmulator.Terminate(ctx) }
-
 	host, err := spannerEmulator.Host(ctx)
 	if err != nil {
-		return dsn, terminate, err
+		_ = spannerEmulator.Terminate(ctx)
+		return nil, "", err
 	}
 
 	port, err := spannerEmulator.MappedPort(ctx, "9010")
 	if err != nil {
-		return dsn, terminate, err
+		_ = spannerEmulator.Terminate(ctx)
+		return nil, "", err
 	}
 
-	// OS environment needed for setting up instance and database
-	emulatorHost := fmt.Sprintf("%s:%d", host, port.Int())
-	os.Setenv("SPANNER_EMULATOR_HOST", emulatorHost)
+	return spannerEmulator, fmt.Sprintf("%s:%d", host, port.Int()), nil
+}
 
-	// Give the emulator a moment to fully initialize before setting up instances
-	time.Sleep(2 * time.Second)
+// startPGAdapterEmulator starts a container running PGAdapter in front of an emulator and returns
+// it with the PostgreSQL endpoint of PGAdapter and the gRPC endpoint of the emulator
+func startPGAdapterEmulator(ctx context.Context) (testcontainers.Container, string, string, error) {
+	req := testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "gcr.io/cloud-spanner-pg-adapter/pgadapter-emulator",
+			ExposedPorts: []string{pgAdapterPort, listenPort},
+			Name:         namesgenerator.GetRandomName(42),
+			WaitingFor: wait.ForAll(
+				wait.ForListeningPort(pgAdapterPort),
+				wait.ForListeningPort(listenPort),
+			).WithDeadline(120 * time.Second),
+			HostConfigModifier: func(hostConfig *container.HostConfig) {
+				hostConfig.AutoRemove = true
+			},
+		},
+		Started: true,
+	}
 
-	if err := setupInstance(ctx); err != nil {
-		return dsn, terminate, err
+	pgAdapter, err := testcontainers.GenericContainer(ctx, req)
+	if err != nil {
+		return nil, "", "", err
 	}
 
-	if err := createDatabaseWithName(ctx, dbName); err != nil {
-		return dsn, terminate, err
+	host, err := pgAdapter.Host(ctx)
+	if err != nil {
+		_ = pgAdapter.Terminate(ctx)
+		return nil, "", "", err
+	}
+	pgPort, err := pgAdapter.MappedPort(ctx, pgAdapterPort)
+	if err != nil {
+		_ = pgAdapter.Terminate(ctx)
+		return nil, "", "", err
+	}
+	emulatorPort, err := pgAdapter.MappedPort(ctx, listenPort)
+	if err != nil {
+		_ = pgAdapter.Terminate(ctx)
+		return nil, "", "", err
 	}
 
-	return dsn, terminate, nil
+	return pgAdapter, fmt.Sprintf("%s:%d", host, pgPort.Int()), fmt.Sprintf("%s:%d", host, emulatorPort.Int()), nil
 }
 
-func setupInstance(ctx context.Context) error {
-	instanceAdmin, err := instance.NewInstanceAdminClient(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to create instance admin client: %w", err)
+// emulatorClientOptions connects admin clients to the emulator at endpoint instead of the one
+// named by SPANNER_EMULATOR_HOST
+func emulatorClientOptions(endpoint string) []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint("passthrough:///" + endpoint),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		option.WithoutAuthentication(),
 	}
-	defer instanceAdmin.Close()
+}
 
-	// Try to get the instance first to see if it already exists
-	instancePath := fmt.Sprintf("projects/%s/instances/%s", testProject, testInstance)
-	existingInstance, err := instanceAdmin.GetInstance(ctx, &instancepb.GetInstanceRequest{
-		Name: instancePath,
-	})
+// emulatorDSN returns the go-sql-spanner DSN of a database on the emulator at endpoint
+func emulatorDSN(endpoint, dbName string) string {
+	return fmt.Sprintf("%s/projects/%s/instances/%s/databases/%s;usePlainText=true", endpoint, testProject, testInstance, dbName)
+}
 
-	if err == nil {
-		// Instance already exists, check if it's ready
-		if existingInstance.State == instancepb.Instance_READY {
-			return nil // Instance exists and is ready
-		}
-		// Instance exists but not ready, continue to wait for it
-	} else {
-		// Instance doesn't exist, create it
-		op, err := instanceAdmin.CreateInstance(ctx, &instancepb.CreateInstanceRequest{
-			Parent:     fmt.Sprintf("projects/%s", testProject),
-			InstanceId: testInstance,
-			Instance: &instancepb.Instance{
-				Config:      fmt.Sprintf("projects/%s/instanceConfigs/%s", testProject, "emulator-config"),
-				DisplayName: testInstance,
-				NodeCount:   1,
-			},
-		})
-		if err != nil {
-			// Check if error is because instance already exists (race condition)
-			if existingInstance, getErr := instanceAdmin.GetInstance(ctx, &instancepb.GetInstanceRequest{
-				Name: instancePath,
-			}); getErr == nil {
-				// Instance was created by another concurrent process
-				if existingInstance.State == instancepb.Instance_READY {
-					return nil
-				}
-			}
-			return fmt.Errorf("could not create instance %s: %w", instancePath, err)
-		}
+// pgAdapterDSN returns the pgx DSN of a PostgreSQL dialect database reached through the PGAdapter
+// at endpoint. The fully qualified database name lets one PGAdapter serve every database.
+func pgAdapterDSN(endpoint, dbName string) string {
+	database := fmt.Sprintf("projects/%s/instances/%s/databases/%s", testProject, testInstance, dbName)
+	return fmt.Sprintf("postgres://postgres:postgres@%s/%s?sslmode=disable", endpoint, url.PathEscape(database))
+}
 
-		createdInstance, err := op.Wait(ctx)
-		if err != nil {
-			return fmt.Errorf("waiting for instance creation to finish failed: %w", err)
-		}
+// emulatorSetupTimeout bounds the instance setup, so an unreachable emulator host fails instead
+// of being retried forever
+const emulatorSetupTimeout = 30 * time.Second
 
-		// The instance may not be ready to serve yet.
-		if createdInstance.State != instancepb.Instance_READY {
-			fmt.Printf("instance state is not READY yet. Got state %v\n", createdInstance.State)
-		}
+// setupInstance waits until the emulator at endpoint answers and creates the test instance on it,
+// retrying transient errors until emulatorSetupTimeout
+func setupInstance(ctx context.Context, endpoint string) error {
+	ctx, cancel := context.WithTimeout(ctx, emulatorSetupTimeout)
+	defer cancel()
+
+	instanceAdmin, err := instance.NewInstanceAdminClient(ctx, emulatorClientOptions(endpoint)...)
+	if err != nil {
+		return &SetupError{Stage: SetupStageReady, Endpoint: endpoint, Err: fmt.Errorf("failed to create instance admin client: %w", err)}
 	}
+	defer instanceAdmin.Close()
 
+	if err := waitForEmulator(ctx, instanceAdmin); err != nil {
+		return &SetupError{Stage: SetupStageReady, Endpoint: endpoint, Err: err}
+	}
+	if err := retrySetup(ctx, func(ctx context.Context) error { return ensureInstance(ctx, instanceAdmin) }); err != nil {
+		return &SetupError{Stage: SetupStageInstance, Endpoint: endpoint, Err: err}
+	}
 	return nil
 }
 
-func createDatabaseWithName(ctx context.Context, dbName string) error {
-	adminClient, err := database.NewDatabaseAdminClient(ctx)
+func createDatabaseWithName(ctx context.Context, dbName string, opts ...option.ClientOption) error {
+	adminClient, err := database.NewDatabaseAdminClient(ctx, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to create database admin client: %w", err)
 	}
 	defer adminClient.Close()
 
+	return createDatabase(ctx, adminClient, dbName, databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL)
+}
+
+// createDatabase creates dbName with the given dialect; each dialect quotes the name its own way
+func createDatabase(ctx context.Context, adminClient *database.DatabaseAdminClient, dbName string, dialect databasepb.DatabaseDialect) error {
+	createStatement := fmt.Sprintf("CREATE DATABASE `%s`", dbName)
+	if dialect == databasepb.DatabaseDialect_POSTGRESQL {
+		createStatement = fmt.Sprintf(`CREATE DATABASE "%s"`, dbName)
+	}
 	op, err := adminClient.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
 		Parent:          fmt.Sprintf("projects/%s/instances/%s", testProject, testInstance),
-		CreateStatement: fmt.Sprintf("CREATE DATABASE `%s`", dbName),
+		CreateStatement: createStatement,
+		DatabaseDialect: dialect,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create database %s: %w", dbName, err)
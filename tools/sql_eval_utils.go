@@ -173,6 +173,7 @@ func GetErrorCodeDescription(code string) string {
 		"ResourceExhausted":  "Resource limits exceeded. FIX: Reduce query complexity, add pagination, or increase quotas",
 		"Cancelled":          "Operation was cancelled. FIX: Check for client-side cancellation or timeouts",
 		"Unknown":            "Unknown error occurred. FIX: Check error details for more specific information",
+		"Semantic":           "Statement rejected by the offline semantic analysis before execution. FIX: Make the statement consistent with the schema created by the earlier DDL",
 	}
 	if desc, ok := descriptions[code]; ok {
 		return desc
@@ -206,6 +207,15 @@ func GetErrorCategoryDescription(category string) string {
 		"PermissionDenied":                          "Insufficient permissions for the operation. FIX: Grant necessary permissions or use appropriate service account",
 		"Unimplemented":                             "Features not yet implemented in Spanner. FIX: Check Spanner roadmap or use alternative approaches",
 		"InvalidArgument: Other":                    "InvalidArgument errors not matching specific patterns. FIX: Review error message details for specific syntax issues",
+		"Semantic: Unknown Table":                   "Statement references a table or view that no earlier DDL creates. FIX: Create the table first or fix the table name",
+		"Semantic: Unknown Column":                  "Statement references a column the table does not have. FIX: Use the column names from the CREATE TABLE statement",
+		"Semantic: Unknown Index":                   "Index hint references an index that does not exist on the table. FIX: Create the index or remove the hint",
+		"Semantic: Duplicate Object":                "A table, column, index or view is defined twice. FIX: Remove the duplicate definition or rename it",
+		"Semantic: Invalid Primary Key":             "PRIMARY KEY references unknown columns or does not start with the parent key of an interleaved table. FIX: Declare all key columns and prefix the key with the parent's primary key",
+		"Semantic: Foreign Key Mismatch":            "FOREIGN KEY columns do not match the referenced columns in number or type. FIX: Reference columns of the same types, usually the parent's primary key",
+		"Semantic: Column Count Mismatch":           "INSERT lists a different number of values than columns. FIX: Provide one value per listed column",
+		"Semantic: Type Mismatch":                   "A literal does not fit the type of the column it is stored in. FIX: Use literals of the column type, e.g. quote strings and do not quote numbers",
+		"Semantic: Missing Required Column":         "INSERT omits a NOT NULL column without a DEFAULT or stores NULL in it. FIX: Provide a value for every NOT NULL column",
 	}
 	if desc, ok := descriptions[category]; ok {
 		return desc
@@ -227,6 +237,8 @@ func GetParseErrorDescription(errorType string) string {
 		"Unsupported Feature":                         "SQL features that are not supported by Spanner. FIX: Replace with Spanner-compatible alternatives (e.g., use ARRAY instead of arrays)",
 		"Unknown Element":                             "Unknown SQL elements or identifiers. FIX: Check spelling of keywords, functions, and identifiers against Spanner documentation",
 		"Parse Error: Other":                          "Other parsing errors not categorized above. FIX: Review error message for specific guidance",
+		"Syntax Error: Unterminated Literal":          "A string, quoted identifier, comment or dollar-quoted body is never closed. FIX: Close it with the matching quote or comment terminator",
+		"Dialect Mismatch: GoogleSQL Syntax":          "GoogleSQL syntax used against Spanner's PostgreSQL interface. FIX: Use the PostgreSQL form named in the error, e.g. varchar/bigint types, RETURNING, double quoted identifiers and PRIMARY KEY inside the column list",
 	}
 	if desc, ok := descriptions[errorType]; ok {
 		return desc
@@ -234,6 +246,47 @@ func GetParseErrorDescription(errorType string) string {
 	return "No description available for this parse error type"
 }
 
+// GetGuidelineTags maps parse error types, InvalidArgument categories and Spanner error codes to
+// the tags of the guideline sections that explain how to fix them.
+func GetGuidelineTags(category string) []string {
+	tags := map[string][]string{
+		// Parse error types
+		"Syntax Error: PRIMARY/FOREIGN KEY Placement": {"primary-key", "foreign-key"},
+		"Syntax Error: CURRENT_TIMESTAMP Parentheses": {"default-value"},
+		"Syntax Error: String Literal Quotes":         {"string-literal"},
+		"Syntax Error: Missing Token":                 {"syntax"},
+		"Syntax Error: Unexpected Token":              {"syntax"},
+		"Syntax Error: Expected Token":                {"syntax", "default-value"},
+		"Invalid Syntax":                              {"syntax"},
+		"Unsupported Feature":                         {"returning", "array"},
+		"Unknown Element":                             {"function"},
+		// Execution error categories
+		"Syntax Error: CURRENT_TIMESTAMP":           {"default-value"},
+		"Syntax Error: Missing Parentheses":         {"default-value", "syntax"},
+		"Syntax Error: Missing Closing Parentheses": {"syntax"},
+		"Syntax Error: General":                     {"syntax"},
+		"Type Mismatch: GENERATE_UUID on INT64":     {"uuid", "type-mismatch"},
+		"Type Mismatch: General":                    {"type-mismatch"},
+		"Unsupported Feature: Sequence Kind":        {"sequence", "uuid"},
+		"Unsupported Feature: General":              {"returning", "array"},
+		"Missing Clause: SQL SECURITY":              {"view"},
+		"Missing Clause: General":                   {"syntax"},
+		"Function Not Found: NEXTVAL":               {"sequence", "function"},
+		"Function Not Found: General":               {"function"},
+		"Identity Column: Missing Sequence Kind":    {"sequence", "uuid"},
+		"Table Not Found (InvalidArgument)":         {"creation-order"},
+		"Foreign Key: Syntax Error":                 {"foreign-key"},
+		"Default Value: Parsing Error":              {"default-value"},
+		"Constraint: Unsupported":                   {"check-constraint"},
+		"View Definition: Error":                    {"view"},
+		"NotFound":                                  {"creation-order", "not-found"},
+		"FailedPrecondition":                        {"not-null", "foreign-key"},
+		"AlreadyExists":                             {"creation-order"},
+		"InvalidArgument: Other":                    {"syntax"},
+	}
+	return tags[category]
+}
+
 // GetAIRecommendations generates AI-specific recommendations based on error patterns
 func GetAIRecommendations(fr models.TestFileResult) []string {
 	var recommendations []string